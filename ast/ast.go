@@ -2,6 +2,7 @@ package ast
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 
 	"github.com/pro0o/sup-bud/token"
@@ -31,9 +32,18 @@ type Program struct {
 
 // buffer to write return value of each stmt's
 func (p *Program) String() string {
+	return statementList(p.Statements)
+}
+
+// statements as source, an expression statement is only ended by ;
+// where another one follows it
+func statementList(statements []Statement) string {
 	var out bytes.Buffer
-	for _, s := range p.Statements {
+	for i, s := range statements {
 		out.WriteString(s.String())
+		if _, ok := s.(*ExpressionStatement); ok && i < len(statements)-1 {
+			out.WriteString(";")
+		}
 	}
 	return out.String()
 }
@@ -50,6 +60,13 @@ func (p *Program) TokenLiteral() string {
 type Identifier struct {
 	Token token.Token // token.IDENT in question
 	Value string
+
+	// filled in by the resolver, the binding lives Depth scopes out
+	// in slot Slot. Slot is -1 for names of the top level, which
+	// are still looked up by name.
+	Resolved bool
+	Depth    int
+	Slot     int
 }
 
 func (i *Identifier) expressionNode()      {}
@@ -57,19 +74,47 @@ func (i *Identifier) TokenLiteral() string { return i.Token.Literal }
 
 func (i *Identifier) String() string { return i.Value }
 
+// sup name = value;
+//
+// record Point { x, y } is one too, binding a RecordDefinition under
+// its name, so records can be exported like any other sup.
+//
+// infixl 6 <+> = bud(a, b) { ... } is one too, it declares the
+// operator and binds the function under the name "<+>". uses of the
+// operator are CallExpressions of that name.
 type LetStatement struct {
-	Token token.Token // the token.LET in question.
-	Name  *Identifier
-	Value Expression // evaluated value
+	Token      token.Token // the token.LET in question, or RECORD, INFIX, INFIXL or INFIXR
+	Name       *Identifier
+	Type       *TypeExpression // sup x: int = 1, nil when left out
+	Value      Expression      // evaluated value
+	Precedence int             // of an operator, as declared
 }
 
 func (ls *LetStatement) statementNode()       {}
 func (ls *LetStatement) TokenLiteral() string { return ls.Token.Literal }
 
+// IsOperator reports whether ls declares an operator.
+func (ls *LetStatement) IsOperator() bool {
+	switch ls.Token.Type {
+	case token.INFIX, token.INFIXL, token.INFIXR:
+		return true
+	}
+	return false
+}
+
 func (ls *LetStatement) String() string {
+	if ls.Token.Type == token.RECORD {
+		return ls.Value.String()
+	}
 	var out bytes.Buffer
 	out.WriteString(ls.TokenLiteral() + " ")
+	if ls.IsOperator() {
+		out.WriteString(strconv.Itoa(ls.Precedence) + " ")
+	}
 	out.WriteString(ls.Name.String())
+	if ls.Type != nil {
+		out.WriteString(": " + ls.Type.String())
+	}
 	out.WriteString(" = ")
 	if ls.Value != nil {
 		out.WriteString(ls.Value.String())
@@ -78,6 +123,30 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// sup [a, b, ...rest] = xs; or sup {name, age} = h;
+type DestructureStatement struct {
+	Token   token.Token // the token.LET
+	Pattern Pattern     // an array or hash pattern
+	Type    *TypeExpression
+	Value   Expression
+}
+
+func (ds *DestructureStatement) statementNode()       {}
+func (ds *DestructureStatement) TokenLiteral() string { return ds.Token.Literal }
+func (ds *DestructureStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(ds.TokenLiteral() + " " + ds.Pattern.String())
+	if ds.Type != nil {
+		out.WriteString(": " + ds.Type.String())
+	}
+	out.WriteString(" = ")
+	if ds.Value != nil {
+		out.WriteString(ds.Value.String())
+	}
+	out.WriteString(";")
+	return out.String()
+}
+
 // return stmt
 type ReturnStatement struct {
 	Token       token.Token // return token type
@@ -181,13 +250,13 @@ func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
-	out.WriteString("if")
+	out.WriteString("if (")
 	out.WriteString(ie.Condition.String())
-	out.WriteString(" ")
-	out.WriteString(ie.Consequence.String())
+	out.WriteString(") ")
+	out.WriteString(braced(ie.Consequence))
 	if ie.Alternative != nil {
-		out.WriteString("else ")
-		out.WriteString(ie.Alternative.String())
+		out.WriteString(" else ")
+		out.WriteString(braced(ie.Alternative))
 	}
 	return out.String()
 }
@@ -200,17 +269,32 @@ type BlockStatement struct {
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
 func (bs *BlockStatement) String() string {
-	var out bytes.Buffer
-	for _, s := range bs.Statements {
-		out.WriteString(s.String())
+	return statementList(bs.Statements)
+}
+
+// { a; b }, a block as it is written
+func braced(bs *BlockStatement) string {
+	if bs == nil || len(bs.Statements) == 0 {
+		return "{ }"
 	}
-	return out.String()
+	return "{ " + bs.String() + " }"
 }
 
 type FunctionLiteral struct {
 	Token      token.Token // The 'bud' token
 	Parameters []*Identifier
 	Body       *BlockStatement
+	Scope      *Scope // names bound per call, set by the resolver
+
+	// bud(a: int, b) -> int, nil where left out. ParameterTypes goes
+	// along with Parameters and is nil when no parameter has a type.
+	ParameterTypes []*TypeExpression
+	ReturnType     *TypeExpression
+
+	// bud([a, b], c), nil where a parameter is a plain name and nil
+	// when none is a pattern. the parameter of a pattern is a name no
+	// code can refer to, holding the argument the pattern takes apart.
+	Patterns []Pattern
 }
 
 func (fl *FunctionLiteral) expressionNode()      {}
@@ -218,19 +302,87 @@ func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 	params := []string{}
-	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+	for i, p := range fl.Parameters {
+		param := p.String()
+		if i < len(fl.Patterns) && fl.Patterns[i] != nil {
+			param = fl.Patterns[i].String()
+		}
+		if i < len(fl.ParameterTypes) && fl.ParameterTypes[i] != nil {
+			param += ": " + fl.ParameterTypes[i].String()
+		}
+		params = append(params, param)
 	}
 	out.WriteString(fl.TokenLiteral())
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") ")
-	out.WriteString(fl.Body.String())
+	if fl.ReturnType != nil {
+		out.WriteString("-> " + fl.ReturnType.String() + " ")
+	}
+	out.WriteString(braced(fl.Body))
+	return out.String()
+}
+
+// a type in an annotation, one of
+//
+//	int  bool  string  null  any  [int]  {string: int}  bud(int, int) -> int
+//
+// which one goes by the token. it is checked before a program runs
+// and means nothing to the evaluator.
+type TypeExpression struct {
+	Token      token.Token       // the name, '[', '{' or 'bud'
+	Name       string            // of a named type
+	Element    *TypeExpression   // of an array
+	Key        *TypeExpression   // of a hash
+	Value      *TypeExpression   // of a hash
+	Parameters []*TypeExpression // of a bud
+	Return     *TypeExpression   // of a bud
+}
+
+func (te *TypeExpression) TokenLiteral() string { return te.Token.Literal }
+func (te *TypeExpression) String() string {
+	switch te.Token.Type {
+	case token.LBRACKET:
+		return "[" + te.Element.String() + "]"
+	case token.LBRACE:
+		return "{" + te.Key.String() + ": " + te.Value.String() + "}"
+	case token.FUNCTION:
+		params := []string{}
+		for _, p := range te.Parameters {
+			params = append(params, p.String())
+		}
+		return "bud(" + strings.Join(params, ", ") + ") -> " + te.Return.String()
+	}
+	return te.Name
+}
+
+// macro(a, b) { quote(...) }
+// only bound by a sup at the top level, the expander takes it out of
+// the program before evaluation.
+type MacroLiteral struct {
+	Token      token.Token // The 'macro' token
+	Parameters []*Identifier
+	Body       *BlockStatement
+}
+
+func (ml *MacroLiteral) expressionNode()      {}
+func (ml *MacroLiteral) TokenLiteral() string { return ml.Token.Literal }
+func (ml *MacroLiteral) String() string {
+	var out bytes.Buffer
+	params := []string{}
+	for _, p := range ml.Parameters {
+		params = append(params, p.String())
+	}
+	out.WriteString(ml.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(") ")
+	out.WriteString(braced(ml.Body))
 	return out.String()
 }
 
 type CallExpression struct {
-	Token     token.Token // The '(' token
+	Token     token.Token // The '(' token, or the OPERATOR of a <+> b
 	Function  Expression  // Identifier or FunctionLiteral
 	Arguments []Expression
 }
@@ -239,6 +391,9 @@ func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
+	if ce.Token.Type == token.OPERATOR && len(ce.Arguments) == 2 {
+		return "(" + ce.Arguments[0].String() + " " + ce.Token.Literal + " " + ce.Arguments[1].String() + ")"
+	}
 	args := []string{}
 	for _, a := range ce.Arguments {
 		args = append(args, a.String())
@@ -249,3 +404,416 @@ func (ce *CallExpression) String() string {
 	out.WriteString(")")
 	return out.String()
 }
+
+// string lit
+type StringLiteral struct {
+	Token token.Token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode()      {}
+func (sl *StringLiteral) TokenLiteral() string { return sl.Token.Literal }
+func (sl *StringLiteral) String() string       { return QuoteString(sl.Value) }
+
+// QuoteString renders s back into a source string literal,
+// escaping whatever the lexer knows how to unescape.
+func QuoteString(s string) string {
+	var out bytes.Buffer
+	out.WriteByte('"')
+	escapeString(&out, s)
+	out.WriteByte('"')
+	return out.String()
+}
+
+func escapeString(out *bytes.Buffer, s string) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '$':
+			if i+1 < len(s) && s[i+1] == '{' {
+				out.WriteString(`\$`)
+			} else {
+				out.WriteByte('$')
+			}
+		default:
+			out.WriteByte(s[i])
+		}
+	}
+}
+
+// "hello ${name}!" is the parts "hello " and "!" around the value of
+// name. there is one more part than there are values.
+type InterpolatedString struct {
+	Token  token.Token // the TEMPLATE_START token
+	Parts  []string
+	Values []Expression
+}
+
+func (is *InterpolatedString) expressionNode()      {}
+func (is *InterpolatedString) TokenLiteral() string { return is.Token.Literal }
+func (is *InterpolatedString) String() string {
+	var out bytes.Buffer
+	out.WriteByte('"')
+	for i, part := range is.Parts {
+		escapeString(&out, part)
+		if i < len(is.Values) {
+			out.WriteString("${" + is.Values[i].String() + "}")
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+// import "path/to/mod.sb" as m;
+type ImportStatement struct {
+	Token token.Token // the 'import' token
+	Path  *StringLiteral
+	Alias *Identifier
+}
+
+func (is *ImportStatement) statementNode()       {}
+func (is *ImportStatement) TokenLiteral() string { return is.Token.Literal }
+func (is *ImportStatement) String() string {
+	var out bytes.Buffer
+	out.WriteString(is.TokenLiteral() + " ")
+	out.WriteString(is.Path.String())
+	out.WriteString(" as ")
+	out.WriteString(is.Alias.String())
+	out.WriteString(";")
+	return out.String()
+}
+
+// export sup name = value;
+type ExportStatement struct {
+	Token     token.Token // the 'export' token
+	Statement *LetStatement
+}
+
+func (es *ExportStatement) statementNode()       {}
+func (es *ExportStatement) TokenLiteral() string { return es.Token.Literal }
+func (es *ExportStatement) String() string {
+	return es.TokenLiteral() + " " + es.Statement.String()
+}
+
+// member access exp, m.name
+type MemberExpression struct {
+	Token  token.Token // the '.' token
+	Object Expression
+	Member *Identifier
+}
+
+func (me *MemberExpression) expressionNode()      {}
+func (me *MemberExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MemberExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(me.Object.String())
+	out.WriteString(".")
+	out.WriteString(me.Member.String())
+	out.WriteString(")")
+	return out.String()
+}
+
+// [1, 2, 3]
+type ArrayLiteral struct {
+	Token    token.Token // the '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// arr[0]
+type IndexExpression struct {
+	Token token.Token // the '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+	return out.String()
+}
+
+// {"key": value}
+type HashLiteral struct {
+	Token token.Token // the '{' token
+	Keys  []Expression
+	Pairs map[Expression]Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+": "+hl.Pairs[key].String())
+	}
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// select { recv(ch) as v { ... } send(ch, x) { ... } default { ... } }
+type SelectExpression struct {
+	Token   token.Token // the 'select' token
+	Cases   []*SelectCase
+	Default *BlockStatement
+}
+
+func (se *SelectExpression) expressionNode()      {}
+func (se *SelectExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SelectExpression) String() string {
+	var out bytes.Buffer
+	out.WriteString("select { ")
+	for _, c := range se.Cases {
+		out.WriteString(c.String())
+		out.WriteString(" ")
+	}
+	if se.Default != nil {
+		out.WriteString("default { ")
+		out.WriteString(se.Default.String())
+		out.WriteString(" } ")
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// one arm of a select, either a recv or a send
+type SelectCase struct {
+	Token   token.Token // the 'recv' or 'send' identifier
+	Send    bool
+	Channel Expression
+	Value   Expression  // value to send, nil for recv
+	Binding *Identifier // recv(ch) as v, optional
+	Body    *BlockStatement
+	Scope   *Scope // set by the resolver when there is a binding
+}
+
+func (sc *SelectCase) TokenLiteral() string { return sc.Token.Literal }
+func (sc *SelectCase) String() string {
+	var out bytes.Buffer
+	out.WriteString(sc.TokenLiteral())
+	out.WriteString("(")
+	out.WriteString(sc.Channel.String())
+	if sc.Send {
+		out.WriteString(", ")
+		out.WriteString(sc.Value.String())
+	}
+	out.WriteString(")")
+	if sc.Binding != nil {
+		out.WriteString(" as ")
+		out.WriteString(sc.Binding.String())
+	}
+	out.WriteString(" { ")
+	out.WriteString(sc.Body.String())
+	out.WriteString(" }")
+	return out.String()
+}
+
+// record Point { x, y; sup norm = bud() { self.x * self.x + self.y * self.y }; }
+// methods are buds, self is the record they are looked up on.
+type RecordDefinition struct {
+	Token   token.Token // the 'record' token
+	Name    string
+	Fields  []*Identifier
+	Methods []*LetStatement
+	Scope   *Scope // holds self, set by the resolver
+}
+
+func (rd *RecordDefinition) expressionNode()      {}
+func (rd *RecordDefinition) TokenLiteral() string { return rd.Token.Literal }
+func (rd *RecordDefinition) String() string {
+	var out bytes.Buffer
+	fields := []string{}
+	for _, f := range rd.Fields {
+		fields = append(fields, f.String())
+	}
+	out.WriteString("record " + rd.Name + " { ")
+	out.WriteString(strings.Join(fields, ", "))
+	if len(rd.Fields) > 0 && len(rd.Methods) > 0 {
+		out.WriteString("; ")
+	}
+	for _, m := range rd.Methods {
+		out.WriteString(m.String() + " ")
+	}
+	if len(rd.Fields) > 0 && len(rd.Methods) == 0 {
+		out.WriteString(" ")
+	}
+	out.WriteString("}")
+	return out.String()
+}
+
+// Point{x: 1, y: 2}
+type RecordLiteral struct {
+	Token  token.Token // the '{' token
+	Type   Expression  // Point, or m.Point for an imported one
+	Fields []*Identifier
+	Values []Expression
+}
+
+func (rl *RecordLiteral) expressionNode()      {}
+func (rl *RecordLiteral) TokenLiteral() string { return rl.Token.Literal }
+func (rl *RecordLiteral) String() string {
+	return rl.Type.String() + fieldList(rl.Fields, rl.Values)
+}
+
+// p with {x: 3}, a copy of p with x changed
+type WithExpression struct {
+	Token  token.Token // the 'with' token
+	Record Expression
+	Fields []*Identifier
+	Values []Expression
+}
+
+func (we *WithExpression) expressionNode()      {}
+func (we *WithExpression) TokenLiteral() string { return we.Token.Literal }
+func (we *WithExpression) String() string {
+	return "(" + we.Record.String() + " with " + fieldList(we.Fields, we.Values) + ")"
+}
+
+// {x: 1, y: 2}
+func fieldList(fields []*Identifier, values []Expression) string {
+	pairs := []string{}
+	for i, f := range fields {
+		pairs = append(pairs, f.String()+": "+values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Pattern is what a match arm compares its value with: a literal, a
+// name to bind it to (_ binds nothing) or an array or hash pattern
+// made of more patterns.
+type Pattern interface {
+	Node
+	patternNode()
+}
+
+func (i *Identifier) patternNode()      {}
+func (il *IntegerLiteral) patternNode() {}
+func (sl *StringLiteral) patternNode()  {}
+func (b *Boolean) patternNode()         {}
+
+// [first, second, ...rest]
+type ArrayPattern struct {
+	Token    token.Token // the '[' token
+	Elements []Pattern
+	Rest     *Identifier // nil without ...rest
+}
+
+func (ap *ArrayPattern) patternNode()         {}
+func (ap *ArrayPattern) TokenLiteral() string { return ap.Token.Literal }
+func (ap *ArrayPattern) String() string {
+	elements := []string{}
+	for _, el := range ap.Elements {
+		elements = append(elements, el.String())
+	}
+	if ap.Rest != nil {
+		elements = append(elements, "..."+ap.Rest.String())
+	}
+	return "[" + strings.Join(elements, ", ") + "]"
+}
+
+// {"kind": k, name}, where name is short for "name": name. keys are
+// literals.
+type HashPattern struct {
+	Token  token.Token // the '{' token
+	Keys   []Expression
+	Values []Pattern
+}
+
+func (hp *HashPattern) patternNode()         {}
+func (hp *HashPattern) TokenLiteral() string { return hp.Token.Literal }
+func (hp *HashPattern) String() string {
+	pairs := []string{}
+	for i, key := range hp.Keys {
+		pairs = append(pairs, key.String()+": "+hp.Values[i].String())
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+// Bindings lists the names pattern binds, in source order.
+func Bindings(pattern Pattern) []*Identifier {
+	var names []*Identifier
+	Inspect(pattern, func(node Node) bool {
+		if id, ok := node.(*Identifier); ok && id.Value != "_" {
+			names = append(names, id)
+		}
+		return true
+	})
+	return names
+}
+
+// match value { [x, ...rest] if x > 0 => x, _ => 0 }
+type MatchExpression struct {
+	Token   token.Token // the 'match' token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+func (me *MatchExpression) expressionNode()      {}
+func (me *MatchExpression) TokenLiteral() string { return me.Token.Literal }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+	subject := me.Subject.String()
+	if _, ok := me.Subject.(*RecordLiteral); ok {
+		subject = "(" + subject + ")" // or its { would start the arms
+	}
+	out.WriteString("match " + subject + " {")
+	for i, arm := range me.Arms {
+		if i > 0 {
+			out.WriteString(",")
+		}
+		out.WriteString(" " + arm.String())
+	}
+	out.WriteString(" }")
+	return out.String()
+}
+
+// pattern if guard => body, the first arm that matches is taken
+type MatchArm struct {
+	Token   token.Token // the '=>' token
+	Pattern Pattern
+	Guard   Expression // nil without if
+	Body    Expression
+	Scope   *Scope // what the pattern binds, set by the resolver
+}
+
+func (ma *MatchArm) TokenLiteral() string { return ma.Token.Literal }
+func (ma *MatchArm) String() string {
+	var out bytes.Buffer
+	out.WriteString(ma.Pattern.String())
+	if ma.Guard != nil {
+		out.WriteString(" if " + ma.Guard.String())
+	}
+	out.WriteString(" => ")
+	out.WriteString(ma.Body.String())
+	return out.String()
+}
@@ -0,0 +1,909 @@
+package ast
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/pro0o/sup-bud/token"
+)
+
+// every node encodes as
+//
+//	{"kind": "InfixExpression", "token": {...}, "span": {...},
+//	 "value": ..., "children": {"left": {...}, "right": {...}}}
+//
+// value holds the node's own data (a name, number, operator) and
+// children its sub nodes by field name, lists as arrays. hash pairs
+// are [{"key": ..., "value": ...}] in source order, and so are the
+// fields given to a record literal or a with. what the resolver
+// fills in is left out, evaluation redoes it.
+
+type jsonToken struct {
+	Type     token.TokenType `json:"type"`
+	Literal  string          `json:"literal"`
+	Position int             `json:"position"`
+}
+
+type jsonNode struct {
+	Kind     string                 `json:"kind"`
+	Token    *jsonToken             `json:"token,omitempty"`
+	Span     *Span                  `json:"span,omitempty"`
+	Value    interface{}            `json:"value,omitempty"`
+	Children map[string]interface{} `json:"children,omitempty"`
+}
+
+type jsonPair struct {
+	Key   *jsonNode `json:"key"`
+	Value *jsonNode `json:"value"`
+}
+
+// MarshalNode encodes node and everything below it. every node nests
+// two JSON levels deep and encoding/json gives up at 10000, so a tree
+// more than about 5000 nodes deep fails to encode.
+func MarshalNode(node Node) ([]byte, error) {
+	return json.Marshal(encode(node))
+}
+
+func (p *Program) MarshalJSON() ([]byte, error) {
+	return MarshalNode(p)
+}
+
+func (p *Program) UnmarshalJSON(data []byte) error {
+	node, err := UnmarshalNode(data)
+	if err != nil {
+		return err
+	}
+	program, ok := node.(*Program)
+	if !ok {
+		return fmt.Errorf("ast json: expected Program, got %s", kindOf(node))
+	}
+	*p = *program
+	return nil
+}
+
+func kindOf(node Node) string {
+	return fmt.Sprintf("%T", node)[len("*ast."):]
+}
+
+func encodeToken(tok token.Token) *jsonToken {
+	return &jsonToken{Type: tok.Type, Literal: tok.Literal, Position: tok.Position}
+}
+
+func isNil(node Node) bool {
+	switch node := node.(type) {
+	case nil:
+		return true
+	case *Identifier:
+		return node == nil
+	case *LetStatement:
+		return node == nil
+	case *BlockStatement:
+		return node == nil
+	case *StringLiteral:
+		return node == nil
+	case *TypeExpression:
+		return node == nil
+	case *SelectCase:
+		return node == nil
+	case *MatchArm:
+		return node == nil
+	}
+	return false
+}
+
+func encode(node Node) *jsonNode {
+	if isNil(node) {
+		return nil
+	}
+
+	n := &jsonNode{Kind: kindOf(node), Children: map[string]interface{}{}}
+	if _, ok := node.(*Program); !ok {
+		span := SpanOf(node)
+		n.Span = &span
+	}
+	child := func(name string, node Node) {
+		if c := encode(node); c != nil {
+			n.Children[name] = c
+		}
+	}
+	statements := func(name string, list []Statement) {
+		out := make([]*jsonNode, len(list))
+		for i, stmt := range list {
+			out[i] = encode(stmt)
+		}
+		n.Children[name] = out
+	}
+	expressions := func(name string, list []Expression) {
+		out := make([]*jsonNode, len(list))
+		for i, exp := range list {
+			out[i] = encode(exp)
+		}
+		n.Children[name] = out
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		statements("statements", node.Statements)
+	case *Identifier:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Value
+	case *DestructureStatement:
+		n.Token = encodeToken(node.Token)
+		child("pattern", node.Pattern)
+		child("type", node.Type)
+		child("value", node.Value)
+	case *LetStatement:
+		n.Token = encodeToken(node.Token)
+		if node.IsOperator() {
+			n.Value = node.Precedence
+		}
+		child("name", node.Name)
+		child("type", node.Type)
+		child("value", node.Value)
+	case *ReturnStatement:
+		n.Token = encodeToken(node.Token)
+		child("returnValue", node.ReturnValue)
+	case *ExpressionStatement:
+		n.Token = encodeToken(node.Token)
+		child("expression", node.Expression)
+	case *IntegerLiteral:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Value
+	case *Boolean:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Value
+	case *StringLiteral:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Value
+	case *InterpolatedString:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Parts
+		expressions("values", node.Values)
+	case *PrefixExpression:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Operator
+		child("right", node.Right)
+	case *InfixExpression:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Operator
+		child("left", node.Left)
+		child("right", node.Right)
+	case *IfExpression:
+		n.Token = encodeToken(node.Token)
+		child("condition", node.Condition)
+		child("consequence", node.Consequence)
+		child("alternative", node.Alternative)
+	case *BlockStatement:
+		n.Token = encodeToken(node.Token)
+		statements("statements", node.Statements)
+	case *FunctionLiteral:
+		n.Token = encodeToken(node.Token)
+		params := make([]*jsonNode, len(node.Parameters))
+		for i, param := range node.Parameters {
+			params[i] = encode(param)
+		}
+		n.Children["parameters"] = params
+		if node.ParameterTypes != nil {
+			n.Children["parameterTypes"] = encodeTypes(node.ParameterTypes)
+		}
+		if node.Patterns != nil {
+			patterns := make([]*jsonNode, len(node.Patterns))
+			for i, pattern := range node.Patterns {
+				patterns[i] = encode(pattern)
+			}
+			n.Children["patterns"] = patterns
+		}
+		child("returnType", node.ReturnType)
+		child("body", node.Body)
+	case *MacroLiteral:
+		n.Token = encodeToken(node.Token)
+		params := make([]*jsonNode, len(node.Parameters))
+		for i, param := range node.Parameters {
+			params[i] = encode(param)
+		}
+		n.Children["parameters"] = params
+		child("body", node.Body)
+	case *CallExpression:
+		n.Token = encodeToken(node.Token)
+		child("function", node.Function)
+		expressions("arguments", node.Arguments)
+	case *ImportStatement:
+		n.Token = encodeToken(node.Token)
+		child("path", node.Path)
+		child("alias", node.Alias)
+	case *ExportStatement:
+		n.Token = encodeToken(node.Token)
+		child("statement", node.Statement)
+	case *MemberExpression:
+		n.Token = encodeToken(node.Token)
+		child("object", node.Object)
+		child("member", node.Member)
+	case *ArrayLiteral:
+		n.Token = encodeToken(node.Token)
+		expressions("elements", node.Elements)
+	case *IndexExpression:
+		n.Token = encodeToken(node.Token)
+		child("left", node.Left)
+		child("index", node.Index)
+	case *HashLiteral:
+		n.Token = encodeToken(node.Token)
+		pairs := make([]jsonPair, len(node.Keys))
+		for i, key := range node.Keys {
+			pairs[i] = jsonPair{Key: encode(key), Value: encode(node.Pairs[key])}
+		}
+		n.Children["pairs"] = pairs
+	case *TypeExpression:
+		n.Token = encodeToken(node.Token)
+		if node.Name != "" {
+			n.Value = node.Name
+		}
+		child("element", node.Element)
+		child("key", node.Key)
+		child("value", node.Value)
+		if node.Token.Type == token.FUNCTION {
+			n.Children["parameters"] = encodeTypes(node.Parameters)
+		}
+		child("return", node.Return)
+	case *SelectExpression:
+		n.Token = encodeToken(node.Token)
+		cases := make([]*jsonNode, len(node.Cases))
+		for i, c := range node.Cases {
+			cases[i] = encode(c)
+		}
+		n.Children["cases"] = cases
+		child("default", node.Default)
+	case *SelectCase:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Send
+		child("channel", node.Channel)
+		child("value", node.Value)
+		child("binding", node.Binding)
+		child("body", node.Body)
+	case *RecordDefinition:
+		n.Token = encodeToken(node.Token)
+		n.Value = node.Name
+		fields := make([]*jsonNode, len(node.Fields))
+		for i, field := range node.Fields {
+			fields[i] = encode(field)
+		}
+		n.Children["fields"] = fields
+		methods := make([]*jsonNode, len(node.Methods))
+		for i, method := range node.Methods {
+			methods[i] = encode(method)
+		}
+		n.Children["methods"] = methods
+	case *RecordLiteral:
+		n.Token = encodeToken(node.Token)
+		child("type", node.Type)
+		n.Children["fields"] = encodeFields(node.Fields, node.Values)
+	case *WithExpression:
+		n.Token = encodeToken(node.Token)
+		child("record", node.Record)
+		n.Children["fields"] = encodeFields(node.Fields, node.Values)
+	case *ArrayPattern:
+		n.Token = encodeToken(node.Token)
+		elements := make([]*jsonNode, len(node.Elements))
+		for i, el := range node.Elements {
+			elements[i] = encode(el)
+		}
+		n.Children["elements"] = elements
+		child("rest", node.Rest)
+	case *HashPattern:
+		n.Token = encodeToken(node.Token)
+		pairs := make([]jsonPair, len(node.Keys))
+		for i, key := range node.Keys {
+			pairs[i] = jsonPair{Key: encode(key), Value: encode(node.Values[i])}
+		}
+		n.Children["pairs"] = pairs
+	case *MatchExpression:
+		n.Token = encodeToken(node.Token)
+		child("subject", node.Subject)
+		arms := make([]*jsonNode, len(node.Arms))
+		for i, arm := range node.Arms {
+			arms[i] = encode(arm)
+		}
+		n.Children["arms"] = arms
+	case *MatchArm:
+		n.Token = encodeToken(node.Token)
+		child("pattern", node.Pattern)
+		child("guard", node.Guard)
+		child("body", node.Body)
+	}
+
+	if len(n.Children) == 0 {
+		n.Children = nil
+	}
+	return n
+}
+
+// missing types stay null, so the list lines up with what it types
+func encodeTypes(list []*TypeExpression) []*jsonNode {
+	out := make([]*jsonNode, len(list))
+	for i, typ := range list {
+		out[i] = encode(typ)
+	}
+	return out
+}
+
+func encodeFields(fields []*Identifier, values []Expression) []jsonPair {
+	out := make([]jsonPair, len(fields))
+	for i, field := range fields {
+		out[i] = jsonPair{Key: encode(field), Value: encode(values[i])}
+	}
+	return out
+}
+
+type rawNode struct {
+	Kind     string                     `json:"kind"`
+	Token    *jsonToken                 `json:"token"`
+	Value    json.RawMessage            `json:"value"`
+	Children map[string]json.RawMessage `json:"children"`
+}
+
+// UnmarshalNode rebuilds a node encoded by MarshalNode. spans are
+// not read back, they follow from the tokens.
+func UnmarshalNode(data []byte) (Node, error) {
+	var raw *rawNode
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("ast json: %w", err)
+	}
+	if raw == nil {
+		return nil, nil
+	}
+	return raw.decode()
+}
+
+func (raw *rawNode) token() token.Token {
+	if raw.Token == nil {
+		return token.Token{}
+	}
+	return token.Token{Type: raw.Token.Type, Literal: raw.Token.Literal, Position: raw.Token.Position}
+}
+
+func (raw *rawNode) value(v interface{}) error {
+	if len(raw.Value) == 0 {
+		return nil // left out, so the zero value
+	}
+	if err := json.Unmarshal(raw.Value, v); err != nil {
+		return fmt.Errorf("ast json: %s value: %w", raw.Kind, err)
+	}
+	return nil
+}
+
+// the child called name, nil when it is missing
+func (raw *rawNode) child(name string) (Node, error) {
+	data, ok := raw.Children[name]
+	if !ok {
+		return nil, nil
+	}
+	node, err := UnmarshalNode(data)
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (raw *rawNode) list(name string) ([]Node, error) {
+	data, ok := raw.Children[name]
+	if !ok {
+		return nil, nil
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("ast json: %s %s: %w", raw.Kind, name, err)
+	}
+	nodes := make([]Node, len(items))
+	for i, item := range items {
+		node, err := UnmarshalNode(item)
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+	return nodes, nil
+}
+
+func (raw *rawNode) wrongKind(name string, node Node, want string) error {
+	return fmt.Errorf("ast json: %s %s: expected %s, got %s", raw.Kind, name, want, kindOf(node))
+}
+
+func (raw *rawNode) expression(name string) (Expression, error) {
+	node, err := raw.child(name)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	exp, ok := node.(Expression)
+	if !ok {
+		return nil, raw.wrongKind(name, node, "an expression")
+	}
+	return exp, nil
+}
+
+func (raw *rawNode) identifier(name string) (*Identifier, error) {
+	node, err := raw.child(name)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	id, ok := node.(*Identifier)
+	if !ok {
+		return nil, raw.wrongKind(name, node, "Identifier")
+	}
+	return id, nil
+}
+
+func (raw *rawNode) block(name string) (*BlockStatement, error) {
+	node, err := raw.child(name)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	block, ok := node.(*BlockStatement)
+	if !ok {
+		return nil, raw.wrongKind(name, node, "BlockStatement")
+	}
+	return block, nil
+}
+
+func (raw *rawNode) statements(name string) ([]Statement, error) {
+	nodes, err := raw.list(name)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Statement, len(nodes))
+	for i, node := range nodes {
+		stmt, ok := node.(Statement)
+		if !ok {
+			return nil, raw.wrongKind(name, node, "a statement")
+		}
+		list[i] = stmt
+	}
+	return list, nil
+}
+
+func (raw *rawNode) expressions(name string) ([]Expression, error) {
+	nodes, err := raw.list(name)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Expression, len(nodes))
+	for i, node := range nodes {
+		exp, ok := node.(Expression)
+		if !ok {
+			return nil, raw.wrongKind(name, node, "an expression")
+		}
+		list[i] = exp
+	}
+	return list, nil
+}
+
+func (raw *rawNode) identifiers(name string) ([]*Identifier, error) {
+	nodes, err := raw.list(name)
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*Identifier, len(nodes))
+	for i, node := range nodes {
+		id, ok := node.(*Identifier)
+		if !ok {
+			return nil, raw.wrongKind(name, node, "Identifier")
+		}
+		list[i] = id
+	}
+	return list, nil
+}
+
+// a list of types, nil where one is missing
+func (raw *rawNode) types(name string) ([]*TypeExpression, error) {
+	nodes, err := raw.list(name)
+	if err != nil || nodes == nil {
+		return nil, err
+	}
+	list := make([]*TypeExpression, len(nodes))
+	for i, node := range nodes {
+		if node == nil {
+			continue
+		}
+		typ, ok := node.(*TypeExpression)
+		if !ok {
+			return nil, raw.wrongKind(name, node, "TypeExpression")
+		}
+		list[i] = typ
+	}
+	return list, nil
+}
+
+func (raw *rawNode) typ(name string) (*TypeExpression, error) {
+	node, err := raw.child(name)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	typ, ok := node.(*TypeExpression)
+	if !ok {
+		return nil, raw.wrongKind(name, node, "TypeExpression")
+	}
+	return typ, nil
+}
+
+func (raw *rawNode) decode() (Node, error) {
+	// first error wins, later calls are skipped
+	var err error
+	check := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	expression := func(name string) Expression {
+		exp, e := raw.expression(name)
+		check(e)
+		return exp
+	}
+	identifier := func(name string) *Identifier {
+		id, e := raw.identifier(name)
+		check(e)
+		return id
+	}
+	block := func(name string) *BlockStatement {
+		b, e := raw.block(name)
+		check(e)
+		return b
+	}
+	typ := func(name string) *TypeExpression {
+		t, e := raw.typ(name)
+		check(e)
+		return t
+	}
+	types := func(name string) []*TypeExpression {
+		list, e := raw.types(name)
+		check(e)
+		return list
+	}
+	tok := raw.token()
+
+	var node Node
+	switch raw.Kind {
+	case "Program":
+		stmts, e := raw.statements("statements")
+		check(e)
+		node = &Program{Statements: stmts}
+	case "Identifier":
+		id := &Identifier{Token: tok}
+		check(raw.value(&id.Value))
+		node = id
+	case "LetStatement":
+		ls := &LetStatement{Token: tok, Name: identifier("name"), Type: typ("type"), Value: expression("value")}
+		check(raw.value(&ls.Precedence))
+		node = ls
+	case "DestructureStatement":
+		ds := &DestructureStatement{Token: tok, Type: typ("type"), Value: expression("value")}
+		pattern, e := raw.pattern("pattern")
+		check(e)
+		ds.Pattern = pattern
+		node = ds
+	case "ReturnStatement":
+		node = &ReturnStatement{Token: tok, ReturnValue: expression("returnValue")}
+	case "ExpressionStatement":
+		node = &ExpressionStatement{Token: tok, Expression: expression("expression")}
+	case "IntegerLiteral":
+		il := &IntegerLiteral{Token: tok}
+		check(raw.value(&il.Value))
+		node = il
+	case "Boolean":
+		b := &Boolean{Token: tok}
+		check(raw.value(&b.Value))
+		node = b
+	case "StringLiteral":
+		sl := &StringLiteral{Token: tok}
+		check(raw.value(&sl.Value))
+		node = sl
+	case "InterpolatedString":
+		is := &InterpolatedString{Token: tok}
+		check(raw.value(&is.Parts))
+		values, e := raw.expressions("values")
+		check(e)
+		is.Values = values
+		node = is
+	case "PrefixExpression":
+		pe := &PrefixExpression{Token: tok, Right: expression("right")}
+		check(raw.value(&pe.Operator))
+		node = pe
+	case "InfixExpression":
+		ie := &InfixExpression{Token: tok, Left: expression("left"), Right: expression("right")}
+		check(raw.value(&ie.Operator))
+		node = ie
+	case "IfExpression":
+		node = &IfExpression{
+			Token:       tok,
+			Condition:   expression("condition"),
+			Consequence: block("consequence"),
+			Alternative: block("alternative"),
+		}
+	case "BlockStatement":
+		stmts, e := raw.statements("statements")
+		check(e)
+		node = &BlockStatement{Token: tok, Statements: stmts}
+	case "FunctionLiteral":
+		params, e := raw.identifiers("parameters")
+		check(e)
+		patterns, e := raw.patterns("patterns")
+		check(e)
+		node = &FunctionLiteral{
+			Token:          tok,
+			Parameters:     params,
+			ParameterTypes: types("parameterTypes"),
+			ReturnType:     typ("returnType"),
+			Body:           block("body"),
+			Patterns:       patterns,
+		}
+	case "MacroLiteral":
+		params, e := raw.identifiers("parameters")
+		check(e)
+		node = &MacroLiteral{Token: tok, Parameters: params, Body: block("body")}
+	case "CallExpression":
+		args, e := raw.expressions("arguments")
+		check(e)
+		node = &CallExpression{Token: tok, Function: expression("function"), Arguments: args}
+	case "ImportStatement":
+		is := &ImportStatement{Token: tok, Alias: identifier("alias")}
+		if path := expression("path"); path != nil {
+			sl, ok := path.(*StringLiteral)
+			if !ok {
+				check(raw.wrongKind("path", path, "StringLiteral"))
+			}
+			is.Path = sl
+		}
+		node = is
+	case "ExportStatement":
+		es := &ExportStatement{Token: tok}
+		stmt, e := raw.child("statement")
+		check(e)
+		if stmt != nil {
+			let, ok := stmt.(*LetStatement)
+			if !ok {
+				check(raw.wrongKind("statement", stmt, "LetStatement"))
+			}
+			es.Statement = let
+		}
+		node = es
+	case "MemberExpression":
+		node = &MemberExpression{Token: tok, Object: expression("object"), Member: identifier("member")}
+	case "ArrayLiteral":
+		elements, e := raw.expressions("elements")
+		check(e)
+		node = &ArrayLiteral{Token: tok, Elements: elements}
+	case "IndexExpression":
+		node = &IndexExpression{Token: tok, Left: expression("left"), Index: expression("index")}
+	case "HashLiteral":
+		hl := &HashLiteral{Token: tok, Pairs: make(map[Expression]Expression)}
+		check(raw.pairs(hl))
+		node = hl
+	case "TypeExpression":
+		te := &TypeExpression{
+			Token:      tok,
+			Element:    typ("element"),
+			Key:        typ("key"),
+			Value:      typ("value"),
+			Parameters: types("parameters"),
+			Return:     typ("return"),
+		}
+		check(raw.value(&te.Name))
+		node = te
+	case "SelectExpression":
+		se := &SelectExpression{Token: tok, Default: block("default")}
+		nodes, e := raw.list("cases")
+		check(e)
+		for _, n := range nodes {
+			c, ok := n.(*SelectCase)
+			if !ok {
+				check(raw.wrongKind("cases", n, "SelectCase"))
+				break
+			}
+			se.Cases = append(se.Cases, c)
+		}
+		node = se
+	case "SelectCase":
+		sc := &SelectCase{
+			Token:   tok,
+			Channel: expression("channel"),
+			Value:   expression("value"),
+			Binding: identifier("binding"),
+			Body:    block("body"),
+		}
+		check(raw.value(&sc.Send))
+		node = sc
+	case "RecordDefinition":
+		fields, e := raw.identifiers("fields")
+		check(e)
+		rd := &RecordDefinition{Token: tok, Fields: fields}
+		check(raw.value(&rd.Name))
+		nodes, e := raw.list("methods")
+		check(e)
+		for _, n := range nodes {
+			method, ok := n.(*LetStatement)
+			if !ok {
+				check(raw.wrongKind("methods", n, "LetStatement"))
+				break
+			}
+			rd.Methods = append(rd.Methods, method)
+		}
+		node = rd
+	case "RecordLiteral":
+		fields, values, e := raw.fields()
+		check(e)
+		node = &RecordLiteral{Token: tok, Type: expression("type"), Fields: fields, Values: values}
+	case "WithExpression":
+		fields, values, e := raw.fields()
+		check(e)
+		node = &WithExpression{Token: tok, Record: expression("record"), Fields: fields, Values: values}
+	case "ArrayPattern":
+		elements, e := raw.patterns("elements")
+		check(e)
+		node = &ArrayPattern{Token: tok, Elements: elements, Rest: identifier("rest")}
+	case "HashPattern":
+		hp := &HashPattern{Token: tok}
+		check(raw.patternPairs(hp))
+		node = hp
+	case "MatchExpression":
+		me := &MatchExpression{Token: tok, Subject: expression("subject")}
+		nodes, e := raw.list("arms")
+		check(e)
+		for _, n := range nodes {
+			arm, ok := n.(*MatchArm)
+			if !ok {
+				check(raw.wrongKind("arms", n, "MatchArm"))
+				break
+			}
+			me.Arms = append(me.Arms, arm)
+		}
+		node = me
+	case "MatchArm":
+		arm := &MatchArm{Token: tok, Guard: expression("guard"), Body: expression("body")}
+		pattern, e := raw.pattern("pattern")
+		check(e)
+		arm.Pattern = pattern
+		node = arm
+	default:
+		return nil, fmt.Errorf("ast json: unknown node kind %q", raw.Kind)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (raw *rawNode) pairs(hl *HashLiteral) error {
+	data, ok := raw.Children["pairs"]
+	if !ok {
+		return nil
+	}
+	var pairs []struct {
+		Key   json.RawMessage `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return fmt.Errorf("ast json: HashLiteral pairs: %w", err)
+	}
+	for _, pair := range pairs {
+		key, err := UnmarshalNode(pair.Key)
+		if err != nil {
+			return err
+		}
+		value, err := UnmarshalNode(pair.Value)
+		if err != nil {
+			return err
+		}
+		k, ok := key.(Expression)
+		if !ok {
+			return raw.wrongKind("pairs", key, "an expression")
+		}
+		v, ok := value.(Expression)
+		if !ok {
+			return raw.wrongKind("pairs", value, "an expression")
+		}
+		hl.Keys = append(hl.Keys, k)
+		hl.Pairs[k] = v
+	}
+	return nil
+}
+
+func (raw *rawNode) fields() ([]*Identifier, []Expression, error) {
+	data, ok := raw.Children["fields"]
+	if !ok {
+		return nil, nil, nil
+	}
+	var pairs []struct {
+		Key   json.RawMessage `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, nil, fmt.Errorf("ast json: %s fields: %w", raw.Kind, err)
+	}
+	var fields []*Identifier
+	var values []Expression
+	for _, pair := range pairs {
+		key, err := UnmarshalNode(pair.Key)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, err := UnmarshalNode(pair.Value)
+		if err != nil {
+			return nil, nil, err
+		}
+		f, ok := key.(*Identifier)
+		if !ok {
+			return nil, nil, raw.wrongKind("fields", key, "Identifier")
+		}
+		v, ok := value.(Expression)
+		if !ok {
+			return nil, nil, raw.wrongKind("fields", value, "an expression")
+		}
+		fields = append(fields, f)
+		values = append(values, v)
+	}
+	return fields, values, nil
+}
+
+func (raw *rawNode) pattern(name string) (Pattern, error) {
+	node, err := raw.child(name)
+	if err != nil || node == nil {
+		return nil, err
+	}
+	pattern, ok := node.(Pattern)
+	if !ok {
+		return nil, raw.wrongKind(name, node, "a pattern")
+	}
+	return pattern, nil
+}
+
+func (raw *rawNode) patterns(name string) ([]Pattern, error) {
+	nodes, err := raw.list(name)
+	if err != nil || nodes == nil {
+		return nil, err
+	}
+	list := make([]Pattern, len(nodes))
+	for i, node := range nodes {
+		if node == nil {
+			continue // a plain parameter
+		}
+		pattern, ok := node.(Pattern)
+		if !ok {
+			return nil, raw.wrongKind(name, node, "a pattern")
+		}
+		list[i] = pattern
+	}
+	return list, nil
+}
+
+func (raw *rawNode) patternPairs(hp *HashPattern) error {
+	data, ok := raw.Children["pairs"]
+	if !ok {
+		return nil
+	}
+	var pairs []struct {
+		Key   json.RawMessage `json:"key"`
+		Value json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return fmt.Errorf("ast json: HashPattern pairs: %w", err)
+	}
+	for _, pair := range pairs {
+		key, err := UnmarshalNode(pair.Key)
+		if err != nil {
+			return err
+		}
+		value, err := UnmarshalNode(pair.Value)
+		if err != nil {
+			return err
+		}
+		k, ok := key.(Expression)
+		if !ok {
+			return raw.wrongKind("pairs", key, "an expression")
+		}
+		v, ok := value.(Pattern)
+		if !ok {
+			return raw.wrongKind("pairs", value, "a pattern")
+		}
+		hp.Keys = append(hp.Keys, k)
+		hp.Values = append(hp.Values, v)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package ast
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pro0o/sup-bud/token"
+)
+
+func TestJSON(t *testing.T) {
+	// sup x = -5;
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "sup", Position: 0},
+				Name: &Identifier{
+					Token: token.Token{Type: token.IDENT, Literal: "x", Position: 4},
+					Value: "x",
+				},
+				Value: &PrefixExpression{
+					Token:    token.Token{Type: token.MINUS, Literal: "-", Position: 8},
+					Operator: "-",
+					Right: &IntegerLiteral{
+						Token: token.Token{Type: token.INT, Literal: "5", Position: 9},
+						Value: 5,
+					},
+				},
+			},
+		},
+	}
+
+	data, err := MarshalNode(program)
+	if err != nil {
+		t.Fatalf("MarshalNode: %v", err)
+	}
+	expected := `{"kind":"Program","children":{"statements":[` +
+		`{"kind":"LetStatement","token":{"type":"SUP","literal":"sup","position":0},"span":{"start":0,"end":10},"children":{` +
+		`"name":{"kind":"Identifier","token":{"type":"IDENT","literal":"x","position":4},"span":{"start":4,"end":5},"value":"x"},` +
+		`"value":{"kind":"PrefixExpression","token":{"type":"-","literal":"-","position":8},"span":{"start":8,"end":10},"value":"-","children":{` +
+		`"right":{"kind":"IntegerLiteral","token":{"type":"INT","literal":"5","position":9},"span":{"start":9,"end":10},"value":5}}}}}]}}`
+	if string(data) != expected {
+		t.Fatalf("wrong JSON.\nexpected=%s\ngot=     %s", expected, data)
+	}
+
+	var decoded Program
+	if err := decoded.UnmarshalJSON(data); err != nil {
+		t.Fatalf("UnmarshalJSON: %v", err)
+	}
+	if decoded.String() != program.String() {
+		t.Errorf("decoded program wrong. expected=%q, got=%q", program.String(), decoded.String())
+	}
+	again, err := MarshalNode(&decoded)
+	if err != nil {
+		t.Fatalf("MarshalNode: %v", err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("encoding is not stable.\nfirst= %s\nsecond=%s", data, again)
+	}
+}
+
+func TestJSONErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{"kind":"Loop"}`, `unknown node kind "Loop"`},
+		{`{"kind":"LetStatement","children":{"name":{"kind":"IntegerLiteral","value":1}}}`,
+			"LetStatement name: expected Identifier, got IntegerLiteral"},
+		{`{"kind":"Program","children":{"statements":[{"kind":"Identifier","value":"x"}]}}`,
+			"Program statements: expected a statement, got Identifier"},
+		{`{"kind":"IntegerLiteral","value":"five"}`, "IntegerLiteral value"},
+		{`[1, 2]`, "ast json:"},
+	}
+
+	for _, tt := range tests {
+		_, err := UnmarshalNode([]byte(tt.input))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("wrong error for %s. expected %q in %v", tt.input, tt.expected, err)
+		}
+	}
+
+	var program Program
+	if err := program.UnmarshalJSON([]byte(`{"kind":"Identifier","value":"x"}`)); err == nil ||
+		err.Error() != "ast json: expected Program, got Identifier" {
+		t.Errorf("wrong error decoding a non program. got=%v", err)
+	}
+}
@@ -0,0 +1,15 @@
+package ast
+
+// ModifierFunc gets every node after its children have been modified
+// and returns the node to put in its place.
+type ModifierFunc func(Node) Node
+
+// Modify returns a copy of node with modifier applied to every node
+// in it, bottom up. node itself is left alone, so the same tree can
+// be modified more than once, the way a macro body is expanded for
+// every call. it is Rewrite for modifiers that need no cursor.
+func Modify(node Node, modifier ModifierFunc) Node {
+	return Rewrite(node, func(c *Cursor) Node {
+		return modifier(c.Node())
+	})
+}
@@ -0,0 +1,101 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/pro0o/sup-bud/token"
+)
+
+func TestModify(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	two := func() Expression { return &IntegerLiteral{Value: 2} }
+
+	turnOneIntoTwo := func(node Node) Node {
+		integer, ok := node.(*IntegerLiteral)
+		if !ok || integer.Value != 1 {
+			return node
+		}
+		integer.Value = 2
+		return integer
+	}
+
+	tests := []struct {
+		input    Node
+		expected Node
+	}{
+		{one(), two()},
+		{
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			&Program{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+		},
+		{&InfixExpression{Left: one(), Operator: "+", Right: two()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&InfixExpression{Left: two(), Operator: "+", Right: one()}, &InfixExpression{Left: two(), Operator: "+", Right: two()}},
+		{&PrefixExpression{Operator: "-", Right: one()}, &PrefixExpression{Operator: "-", Right: two()}},
+		{&IndexExpression{Left: one(), Index: one()}, &IndexExpression{Left: two(), Index: two()}},
+		{
+			&IfExpression{
+				Condition:   one(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}},
+			},
+			&IfExpression{
+				Condition:   two(),
+				Consequence: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+				Alternative: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}},
+			},
+		},
+		{&ReturnStatement{ReturnValue: one()}, &ReturnStatement{ReturnValue: two()}},
+		{&LetStatement{Name: &Identifier{Value: "x"}, Value: one()}, &LetStatement{Name: &Identifier{Value: "x"}, Value: two()}},
+		{
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: one()}}}},
+			&FunctionLiteral{Parameters: []*Identifier{}, Body: &BlockStatement{Statements: []Statement{&ExpressionStatement{Expression: two()}}}},
+		},
+		{&ArrayLiteral{Elements: []Expression{one(), one()}}, &ArrayLiteral{Elements: []Expression{two(), two()}}},
+		{&CallExpression{Function: one(), Arguments: []Expression{one()}}, &CallExpression{Function: two(), Arguments: []Expression{two()}}},
+		{
+			&SelectExpression{Cases: []*SelectCase{{Channel: one(), Value: one(), Body: &BlockStatement{}}}},
+			&SelectExpression{Cases: []*SelectCase{{Channel: two(), Value: two(), Body: &BlockStatement{}}}},
+		},
+	}
+
+	for _, tt := range tests {
+		before := tt.input.String()
+		modified := Modify(tt.input, turnOneIntoTwo)
+		if modified.String() != tt.expected.String() {
+			t.Errorf("not equal. got=%s, want=%s", modified, tt.expected)
+		}
+		if tt.input.String() != before {
+			t.Errorf("Modify changed its input. before=%s, after=%s", before, tt.input)
+		}
+	}
+
+	hash := &HashLiteral{Keys: []Expression{one(), one()}, Pairs: map[Expression]Expression{}}
+	for _, key := range hash.Keys {
+		hash.Pairs[key] = one()
+	}
+	modified := Modify(hash, turnOneIntoTwo).(*HashLiteral)
+	for _, key := range modified.Keys {
+		if key.(*IntegerLiteral).Value != 2 || modified.Pairs[key].(*IntegerLiteral).Value != 2 {
+			t.Errorf("hash pair not modified: %s", modified)
+		}
+	}
+}
+
+func TestModifyMisfit(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("expected a panic replacing a name by a literal")
+		}
+	}()
+	let := &LetStatement{
+		Token: token.Token{Type: token.LET, Literal: "sup"},
+		Name:  &Identifier{Value: "x"},
+		Value: &IntegerLiteral{Value: 1},
+	}
+	Modify(let, func(node Node) Node {
+		if _, ok := node.(*Identifier); ok {
+			return &IntegerLiteral{Value: 1}
+		}
+		return node
+	})
+}
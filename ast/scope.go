@@ -0,0 +1,22 @@
+package ast
+
+// Scope lists the names a function call or a select case binds,
+// each gets a slot in the order it was first declared.
+type Scope struct {
+	Names []string
+	Slots map[string]int
+}
+
+func NewScope() *Scope {
+	return &Scope{Slots: make(map[string]int)}
+}
+
+// Declare returns the slot for name, adding one if it is new.
+func (s *Scope) Declare(name string) int {
+	if slot, ok := s.Slots[name]; ok {
+		return slot
+	}
+	s.Slots[name] = len(s.Names)
+	s.Names = append(s.Names, name)
+	return len(s.Names) - 1
+}
@@ -0,0 +1,328 @@
+package ast
+
+import (
+	"fmt"
+
+	"github.com/pro0o/sup-bud/token"
+)
+
+// Span is the range of source bytes a node came from, End exclusive.
+// the tree keeps no closing brackets or semicolons, so a span ends
+// with the last token the node still holds.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// covers widens s to include o, empty spans are ignored
+func (s Span) covers(o Span) Span {
+	if o.End <= o.Start {
+		return s
+	}
+	if s.End <= s.Start {
+		return o
+	}
+	if o.Start < s.Start {
+		s.Start = o.Start
+	}
+	if o.End > s.End {
+		s.End = o.End
+	}
+	return s
+}
+
+func tokenSpan(tok token.Token, literal string) Span {
+	if tok.Type == "" {
+		return Span{} // made up by a rewrite, not from source
+	}
+	return Span{Start: tok.Position, End: tok.Position + len(literal)}
+}
+
+// SpanOf works out the span of node from the tokens in it.
+func SpanOf(node Node) Span {
+	var s Span
+	switch node := node.(type) {
+	case *Program:
+		for _, stmt := range node.Statements {
+			s = s.covers(SpanOf(stmt))
+		}
+	case *BlockStatement:
+		if node == nil {
+			return s
+		}
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for _, stmt := range node.Statements {
+			s = s.covers(SpanOf(stmt))
+		}
+	case *LetStatement:
+		if node == nil {
+			return s
+		}
+		s = tokenSpan(node.Token, node.Token.Literal)
+		if node.Name != nil {
+			s = s.covers(SpanOf(node.Name))
+		}
+		s = s.covers(SpanOf(node.Type))
+		if node.Value != nil {
+			s = s.covers(SpanOf(node.Value))
+		}
+	case *DestructureStatement:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Pattern))
+		s = s.covers(SpanOf(node.Type))
+		if node.Value != nil {
+			s = s.covers(SpanOf(node.Value))
+		}
+	case *ReturnStatement:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		if node.ReturnValue != nil {
+			s = s.covers(SpanOf(node.ReturnValue))
+		}
+	case *ExpressionStatement:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		if node.Expression != nil {
+			s = s.covers(SpanOf(node.Expression))
+		}
+	case *ImportStatement:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Path))
+		if node.Alias != nil {
+			s = s.covers(SpanOf(node.Alias))
+		}
+	case *ExportStatement:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Statement))
+	case *Identifier:
+		s = tokenSpan(node.Token, node.Value)
+	case *IntegerLiteral:
+		s = tokenSpan(node.Token, node.Token.Literal)
+	case *Boolean:
+		s = tokenSpan(node.Token, node.Token.Literal)
+	case *StringLiteral:
+		s = tokenSpan(node.Token, node.String())
+	case *InterpolatedString:
+		// as long as it would be written out, what the source says
+		// inside ${} may be spaced differently
+		s = tokenSpan(node.Token, node.String())
+		for _, value := range node.Values {
+			s = s.covers(SpanOf(value))
+		}
+	case *PrefixExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Right))
+	case *InfixExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Left))
+		s = s.covers(SpanOf(node.Right))
+	case *IfExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Condition))
+		s = s.covers(SpanOf(node.Consequence))
+		s = s.covers(SpanOf(node.Alternative))
+	case *FunctionLiteral:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for _, param := range node.Parameters {
+			s = s.covers(SpanOf(param))
+		}
+		for _, typ := range node.ParameterTypes {
+			s = s.covers(SpanOf(typ))
+		}
+		for _, pattern := range node.Patterns {
+			s = s.covers(SpanOf(pattern))
+		}
+		s = s.covers(SpanOf(node.ReturnType))
+		s = s.covers(SpanOf(node.Body))
+	case *MacroLiteral:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for _, param := range node.Parameters {
+			s = s.covers(SpanOf(param))
+		}
+		s = s.covers(SpanOf(node.Body))
+	case *CallExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Function))
+		for _, arg := range node.Arguments {
+			s = s.covers(SpanOf(arg))
+		}
+	case *MemberExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Object))
+		s = s.covers(SpanOf(node.Member))
+	case *ArrayLiteral:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for _, el := range node.Elements {
+			s = s.covers(SpanOf(el))
+		}
+	case *IndexExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Left))
+		s = s.covers(SpanOf(node.Index))
+	case *HashLiteral:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for _, key := range node.Keys {
+			s = s.covers(SpanOf(key))
+			s = s.covers(SpanOf(node.Pairs[key]))
+		}
+	case *TypeExpression:
+		if node == nil {
+			return s
+		}
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Element))
+		s = s.covers(SpanOf(node.Key))
+		s = s.covers(SpanOf(node.Value))
+		for _, param := range node.Parameters {
+			s = s.covers(SpanOf(param))
+		}
+		s = s.covers(SpanOf(node.Return))
+	case *SelectExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for _, c := range node.Cases {
+			s = s.covers(SpanOf(c))
+		}
+		s = s.covers(SpanOf(node.Default))
+	case *SelectCase:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Channel))
+		if node.Value != nil {
+			s = s.covers(SpanOf(node.Value))
+		}
+		if node.Binding != nil {
+			s = s.covers(SpanOf(node.Binding))
+		}
+		s = s.covers(SpanOf(node.Body))
+	case *RecordDefinition:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for _, field := range node.Fields {
+			s = s.covers(SpanOf(field))
+		}
+		for _, method := range node.Methods {
+			s = s.covers(SpanOf(method))
+		}
+	case *RecordLiteral:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Type))
+		for i, field := range node.Fields {
+			s = s.covers(SpanOf(field))
+			s = s.covers(SpanOf(node.Values[i]))
+		}
+	case *WithExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Record))
+		for i, field := range node.Fields {
+			s = s.covers(SpanOf(field))
+			s = s.covers(SpanOf(node.Values[i]))
+		}
+	case *ArrayPattern:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for _, el := range node.Elements {
+			s = s.covers(SpanOf(el))
+		}
+		if node.Rest != nil {
+			s = s.covers(SpanOf(node.Rest))
+		}
+	case *HashPattern:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		for i, key := range node.Keys {
+			s = s.covers(SpanOf(key))
+			s = s.covers(SpanOf(node.Values[i]))
+		}
+	case *MatchExpression:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Subject))
+		for _, arm := range node.Arms {
+			s = s.covers(SpanOf(arm))
+		}
+	case *MatchArm:
+		s = tokenSpan(node.Token, node.Token.Literal)
+		s = s.covers(SpanOf(node.Pattern))
+		s = s.covers(SpanOf(node.Guard))
+		s = s.covers(SpanOf(node.Body))
+	}
+	return s
+}
+
+// Move returns a copy of node with every position in it delta bytes
+// along, for a tree whose source moved. node itself is left alone.
+func Move(node Node, delta int) Node {
+	return Rewrite(node, func(c *Cursor) Node {
+		if tok := tokenOf(c.Node()); tok != nil {
+			tok.Position += delta
+		}
+		return c.Node()
+	})
+}
+
+// the token a node holds, a program holds none
+func tokenOf(node Node) *token.Token {
+	switch node := node.(type) {
+	case *Program:
+		return nil
+	case *Identifier:
+		return &node.Token
+	case *LetStatement:
+		return &node.Token
+	case *DestructureStatement:
+		return &node.Token
+	case *ReturnStatement:
+		return &node.Token
+	case *ExpressionStatement:
+		return &node.Token
+	case *IntegerLiteral:
+		return &node.Token
+	case *PrefixExpression:
+		return &node.Token
+	case *InfixExpression:
+		return &node.Token
+	case *Boolean:
+		return &node.Token
+	case *IfExpression:
+		return &node.Token
+	case *BlockStatement:
+		return &node.Token
+	case *FunctionLiteral:
+		return &node.Token
+	case *TypeExpression:
+		return &node.Token
+	case *MacroLiteral:
+		return &node.Token
+	case *CallExpression:
+		return &node.Token
+	case *StringLiteral:
+		return &node.Token
+	case *InterpolatedString:
+		return &node.Token
+	case *ImportStatement:
+		return &node.Token
+	case *ExportStatement:
+		return &node.Token
+	case *MemberExpression:
+		return &node.Token
+	case *ArrayLiteral:
+		return &node.Token
+	case *IndexExpression:
+		return &node.Token
+	case *HashLiteral:
+		return &node.Token
+	case *SelectExpression:
+		return &node.Token
+	case *SelectCase:
+		return &node.Token
+	case *RecordDefinition:
+		return &node.Token
+	case *RecordLiteral:
+		return &node.Token
+	case *WithExpression:
+		return &node.Token
+	case *ArrayPattern:
+		return &node.Token
+	case *HashPattern:
+		return &node.Token
+	case *MatchExpression:
+		return &node.Token
+	case *MatchArm:
+		return &node.Token
+	default:
+		panic(fmt.Sprintf("ast: unknown node %T", node))
+	}
+}
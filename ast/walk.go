@@ -0,0 +1,759 @@
+package ast
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/pro0o/sup-bud/token"
+)
+
+// A Visitor's Visit is called for every node Walk comes across. when
+// it returns a visitor w, Walk visits the children of node with w and
+// then calls w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree below node depth first, in source order.
+func Walk(v Visitor, node Node) {
+	if isNil(node) {
+		return
+	}
+	if v = v.Visit(node); v == nil {
+		return
+	}
+	for _, c := range children(node) {
+		Walk(v, c.node)
+	}
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect calls f for every node below node, depth first. the
+// children of a node are skipped when f returns false for it,
+// otherwise f(nil) follows them.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Cursor is where a node is in the tree, for InspectPath and Rewrite.
+type Cursor struct {
+	node  Node
+	path  []Node
+	field string
+	index int
+}
+
+// Node is the node the cursor is at.
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent is the node holding it, nil at the root.
+func (c *Cursor) Parent() Node {
+	if len(c.path) == 0 {
+		return nil
+	}
+	return c.path[len(c.path)-1]
+}
+
+// Path holds the nodes from the root down to the parent. it is only
+// valid during the call it was passed to.
+func (c *Cursor) Path() []Node { return c.path }
+
+// Field names the field of the parent holding the node, like "Left"
+// or "Arguments". empty at the root.
+func (c *Cursor) Field() string { return c.field }
+
+// Index is the node's place in a list field, -1 for other fields.
+func (c *Cursor) Index() int { return c.index }
+
+// InspectPath is Inspect with the whole cursor, without the trailing
+// nil calls.
+func InspectPath(node Node, f func(c *Cursor) bool) {
+	inspectPath(node, nil, "", -1, f)
+}
+
+func inspectPath(node Node, path []Node, field string, index int, f func(c *Cursor) bool) {
+	if isNil(node) {
+		return
+	}
+	if !f(&Cursor{node: node, path: path, field: field, index: index}) {
+		return
+	}
+	path = append(path, node)
+	for _, c := range children(node) {
+		inspectPath(c.node, path, c.field, c.index, f)
+	}
+}
+
+// Rewrite returns a copy of node with every node in it replaced by
+// what f returns for it, bottom up: f sees a node with its children
+// already rewritten, while Path still holds the ancestors as they
+// were. node itself is left alone.
+//
+// a replacement has to fit where the node was, an expression for an
+// expression, an identifier for a name. one that does not panics.
+func Rewrite(node Node, f func(c *Cursor) Node) Node {
+	return rewrite(node, nil, "", -1, f)
+}
+
+func rewrite(node Node, path []Node, field string, index int, f func(c *Cursor) Node) Node {
+	if isNil(node) {
+		return nil
+	}
+	n := shallowCopy(node)
+	path = append(path, node)
+	for _, c := range children(node) {
+		setChild(n, c, rewrite(c.node, path, c.field, c.index, f))
+	}
+	return f(&Cursor{node: n, path: path[:len(path)-1], field: field, index: index})
+}
+
+// Equal reports whether a and b have the same structure: the same
+// node types, token types and literals and values all the way down.
+// positions, and whatever the evaluator fills in, are ignored.
+func Equal(a, b Node) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+	if !sameNode(a, b) {
+		return false
+	}
+	ca, cb := children(a), children(b)
+	if len(ca) != len(cb) {
+		return false
+	}
+	for i := range ca {
+		if ca[i].field != cb[i].field || ca[i].index != cb[i].index || !Equal(ca[i].node, cb[i].node) {
+			return false
+		}
+	}
+	return true
+}
+
+type child struct {
+	field string
+	index int // in a list field, -1 otherwise
+	node  Node
+}
+
+// the children of node in source order, missing ones left out. hash
+// pairs come as Keys[i] followed by Pairs[i], the value of that key,
+// record fields the same way as Fields[i] and Values[i].
+func children(node Node) []child {
+	var out []child
+	one := func(field string, node Node) {
+		if !isNil(node) {
+			out = append(out, child{field, -1, node})
+		}
+	}
+
+	switch node := node.(type) {
+	case *Program:
+		for i, stmt := range node.Statements {
+			out = append(out, child{"Statements", i, stmt})
+		}
+	case *BlockStatement:
+		for i, stmt := range node.Statements {
+			out = append(out, child{"Statements", i, stmt})
+		}
+	case *LetStatement:
+		one("Name", node.Name)
+		one("Type", node.Type)
+		one("Value", node.Value)
+	case *DestructureStatement:
+		one("Pattern", node.Pattern)
+		one("Type", node.Type)
+		one("Value", node.Value)
+	case *ReturnStatement:
+		one("ReturnValue", node.ReturnValue)
+	case *ExpressionStatement:
+		one("Expression", node.Expression)
+	case *ImportStatement:
+		one("Path", node.Path)
+		one("Alias", node.Alias)
+	case *ExportStatement:
+		one("Statement", node.Statement)
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral:
+		// leaves
+	case *InterpolatedString:
+		for i, value := range node.Values {
+			out = append(out, child{"Values", i, value})
+		}
+	case *PrefixExpression:
+		one("Right", node.Right)
+	case *InfixExpression:
+		one("Left", node.Left)
+		one("Right", node.Right)
+	case *IfExpression:
+		one("Condition", node.Condition)
+		one("Consequence", node.Consequence)
+		one("Alternative", node.Alternative)
+	case *FunctionLiteral:
+		for i, param := range node.Parameters {
+			out = append(out, child{"Parameters", i, param})
+			if i < len(node.Patterns) && node.Patterns[i] != nil {
+				out = append(out, child{"Patterns", i, node.Patterns[i]})
+			}
+			if i < len(node.ParameterTypes) && node.ParameterTypes[i] != nil {
+				out = append(out, child{"ParameterTypes", i, node.ParameterTypes[i]})
+			}
+		}
+		one("ReturnType", node.ReturnType)
+		one("Body", node.Body)
+	case *MacroLiteral:
+		for i, param := range node.Parameters {
+			out = append(out, child{"Parameters", i, param})
+		}
+		one("Body", node.Body)
+	case *CallExpression:
+		one("Function", node.Function)
+		for i, arg := range node.Arguments {
+			out = append(out, child{"Arguments", i, arg})
+		}
+	case *MemberExpression:
+		one("Object", node.Object)
+		one("Member", node.Member)
+	case *ArrayLiteral:
+		for i, el := range node.Elements {
+			out = append(out, child{"Elements", i, el})
+		}
+	case *IndexExpression:
+		one("Left", node.Left)
+		one("Index", node.Index)
+	case *HashLiteral:
+		for i, key := range node.Keys {
+			out = append(out, child{"Keys", i, key}, child{"Pairs", i, node.Pairs[key]})
+		}
+	case *TypeExpression:
+		one("Element", node.Element)
+		one("Key", node.Key)
+		one("Value", node.Value)
+		for i, param := range node.Parameters {
+			out = append(out, child{"Parameters", i, param})
+		}
+		one("Return", node.Return)
+	case *SelectExpression:
+		for i, c := range node.Cases {
+			out = append(out, child{"Cases", i, c})
+		}
+		one("Default", node.Default)
+	case *SelectCase:
+		one("Channel", node.Channel)
+		one("Value", node.Value)
+		one("Binding", node.Binding)
+		one("Body", node.Body)
+	case *RecordDefinition:
+		for i, field := range node.Fields {
+			out = append(out, child{"Fields", i, field})
+		}
+		for i, method := range node.Methods {
+			out = append(out, child{"Methods", i, method})
+		}
+	case *RecordLiteral:
+		one("Type", node.Type)
+		for i, field := range node.Fields {
+			out = append(out, child{"Fields", i, field}, child{"Values", i, node.Values[i]})
+		}
+	case *WithExpression:
+		one("Record", node.Record)
+		for i, field := range node.Fields {
+			out = append(out, child{"Fields", i, field}, child{"Values", i, node.Values[i]})
+		}
+	case *ArrayPattern:
+		for i, el := range node.Elements {
+			out = append(out, child{"Elements", i, el})
+		}
+		one("Rest", node.Rest)
+	case *HashPattern:
+		for i, key := range node.Keys {
+			out = append(out, child{"Keys", i, key}, child{"Values", i, node.Values[i]})
+		}
+	case *MatchExpression:
+		one("Subject", node.Subject)
+		for i, arm := range node.Arms {
+			out = append(out, child{"Arms", i, arm})
+		}
+	case *MatchArm:
+		one("Pattern", node.Pattern)
+		one("Guard", node.Guard)
+		one("Body", node.Body)
+	default:
+		panic(fmt.Sprintf("ast: unknown node %T", node))
+	}
+	return out
+}
+
+// a copy of node that setChild can change without touching node
+func shallowCopy(node Node) Node {
+	switch node := node.(type) {
+	case *Program:
+		n := *node
+		n.Statements = append([]Statement(nil), node.Statements...)
+		return &n
+	case *BlockStatement:
+		n := *node
+		n.Statements = append([]Statement(nil), node.Statements...)
+		return &n
+	case *LetStatement:
+		n := *node
+		return &n
+	case *DestructureStatement:
+		n := *node
+		return &n
+	case *ReturnStatement:
+		n := *node
+		return &n
+	case *ExpressionStatement:
+		n := *node
+		return &n
+	case *ImportStatement:
+		n := *node
+		return &n
+	case *ExportStatement:
+		n := *node
+		return &n
+	case *Identifier:
+		n := *node
+		return &n
+	case *IntegerLiteral:
+		n := *node
+		return &n
+	case *Boolean:
+		n := *node
+		return &n
+	case *StringLiteral:
+		n := *node
+		return &n
+	case *InterpolatedString:
+		n := *node
+		n.Parts = append([]string(nil), node.Parts...)
+		n.Values = append([]Expression(nil), node.Values...)
+		return &n
+	case *PrefixExpression:
+		n := *node
+		return &n
+	case *InfixExpression:
+		n := *node
+		return &n
+	case *IfExpression:
+		n := *node
+		return &n
+	case *FunctionLiteral:
+		n := *node
+		n.Parameters = append([]*Identifier(nil), node.Parameters...)
+		if node.ParameterTypes != nil {
+			n.ParameterTypes = append([]*TypeExpression(nil), node.ParameterTypes...)
+		}
+		if node.Patterns != nil {
+			n.Patterns = append([]Pattern(nil), node.Patterns...)
+		}
+		return &n
+	case *MacroLiteral:
+		n := *node
+		n.Parameters = append([]*Identifier(nil), node.Parameters...)
+		return &n
+	case *CallExpression:
+		n := *node
+		n.Arguments = append([]Expression(nil), node.Arguments...)
+		return &n
+	case *MemberExpression:
+		n := *node
+		return &n
+	case *ArrayLiteral:
+		n := *node
+		n.Elements = append([]Expression(nil), node.Elements...)
+		return &n
+	case *IndexExpression:
+		n := *node
+		return &n
+	case *HashLiteral:
+		n := *node
+		n.Keys = append([]Expression(nil), node.Keys...)
+		n.Pairs = make(map[Expression]Expression, len(node.Pairs))
+		for key, value := range node.Pairs {
+			n.Pairs[key] = value
+		}
+		return &n
+	case *TypeExpression:
+		n := *node
+		n.Parameters = append([]*TypeExpression(nil), node.Parameters...)
+		return &n
+	case *SelectExpression:
+		n := *node
+		n.Cases = append([]*SelectCase(nil), node.Cases...)
+		return &n
+	case *SelectCase:
+		n := *node
+		return &n
+	case *RecordDefinition:
+		n := *node
+		n.Fields = append([]*Identifier(nil), node.Fields...)
+		n.Methods = append([]*LetStatement(nil), node.Methods...)
+		return &n
+	case *RecordLiteral:
+		n := *node
+		n.Fields = append([]*Identifier(nil), node.Fields...)
+		n.Values = append([]Expression(nil), node.Values...)
+		return &n
+	case *WithExpression:
+		n := *node
+		n.Fields = append([]*Identifier(nil), node.Fields...)
+		n.Values = append([]Expression(nil), node.Values...)
+		return &n
+	case *ArrayPattern:
+		n := *node
+		n.Elements = append([]Pattern(nil), node.Elements...)
+		return &n
+	case *HashPattern:
+		n := *node
+		n.Keys = append([]Expression(nil), node.Keys...)
+		n.Values = append([]Pattern(nil), node.Values...)
+		return &n
+	case *MatchExpression:
+		n := *node
+		n.Arms = append([]*MatchArm(nil), node.Arms...)
+		return &n
+	case *MatchArm:
+		n := *node
+		return &n
+	}
+	panic(fmt.Sprintf("ast: unknown node %T", node))
+}
+
+// puts node where c was in parent
+func setChild(parent Node, c child, node Node) {
+	switch p := parent.(type) {
+	case *Program:
+		p.Statements[c.index] = fit[Statement](parent, node)
+	case *BlockStatement:
+		p.Statements[c.index] = fit[Statement](parent, node)
+	case *LetStatement:
+		switch c.field {
+		case "Name":
+			p.Name = fit[*Identifier](parent, node)
+		case "Type":
+			p.Type = fit[*TypeExpression](parent, node)
+		case "Value":
+			p.Value = fit[Expression](parent, node)
+		}
+	case *DestructureStatement:
+		switch c.field {
+		case "Pattern":
+			p.Pattern = fit[Pattern](parent, node)
+		case "Type":
+			p.Type = fit[*TypeExpression](parent, node)
+		case "Value":
+			p.Value = fit[Expression](parent, node)
+		}
+	case *ReturnStatement:
+		p.ReturnValue = fit[Expression](parent, node)
+	case *ExpressionStatement:
+		p.Expression = fit[Expression](parent, node)
+	case *ImportStatement:
+		switch c.field {
+		case "Path":
+			p.Path = fit[*StringLiteral](parent, node)
+		case "Alias":
+			p.Alias = fit[*Identifier](parent, node)
+		}
+	case *ExportStatement:
+		p.Statement = fit[*LetStatement](parent, node)
+	case *Identifier, *IntegerLiteral, *Boolean, *StringLiteral:
+		// leaves
+	case *InterpolatedString:
+		p.Values[c.index] = fit[Expression](parent, node)
+	case *PrefixExpression:
+		p.Right = fit[Expression](parent, node)
+	case *InfixExpression:
+		switch c.field {
+		case "Left":
+			p.Left = fit[Expression](parent, node)
+		case "Right":
+			p.Right = fit[Expression](parent, node)
+		}
+	case *IfExpression:
+		switch c.field {
+		case "Condition":
+			p.Condition = fit[Expression](parent, node)
+		case "Consequence":
+			p.Consequence = fit[*BlockStatement](parent, node)
+		case "Alternative":
+			p.Alternative = fit[*BlockStatement](parent, node)
+		}
+	case *FunctionLiteral:
+		switch c.field {
+		case "Parameters":
+			p.Parameters[c.index] = fit[*Identifier](parent, node)
+		case "ParameterTypes":
+			p.ParameterTypes[c.index] = fit[*TypeExpression](parent, node)
+		case "Patterns":
+			p.Patterns[c.index] = fit[Pattern](parent, node)
+		case "ReturnType":
+			p.ReturnType = fit[*TypeExpression](parent, node)
+		case "Body":
+			p.Body = fit[*BlockStatement](parent, node)
+		}
+	case *MacroLiteral:
+		switch c.field {
+		case "Parameters":
+			p.Parameters[c.index] = fit[*Identifier](parent, node)
+		case "Body":
+			p.Body = fit[*BlockStatement](parent, node)
+		}
+	case *CallExpression:
+		switch c.field {
+		case "Function":
+			p.Function = fit[Expression](parent, node)
+		case "Arguments":
+			p.Arguments[c.index] = fit[Expression](parent, node)
+		}
+	case *MemberExpression:
+		switch c.field {
+		case "Object":
+			p.Object = fit[Expression](parent, node)
+		case "Member":
+			p.Member = fit[*Identifier](parent, node)
+		}
+	case *ArrayLiteral:
+		p.Elements[c.index] = fit[Expression](parent, node)
+	case *IndexExpression:
+		switch c.field {
+		case "Left":
+			p.Left = fit[Expression](parent, node)
+		case "Index":
+			p.Index = fit[Expression](parent, node)
+		}
+	case *HashLiteral:
+		key := p.Keys[c.index]
+		switch c.field {
+		case "Keys":
+			value := p.Pairs[key]
+			delete(p.Pairs, key)
+			p.Keys[c.index] = fit[Expression](parent, node)
+			p.Pairs[p.Keys[c.index]] = value
+		case "Pairs":
+			p.Pairs[key] = fit[Expression](parent, node)
+		}
+	case *TypeExpression:
+		switch c.field {
+		case "Element":
+			p.Element = fit[*TypeExpression](parent, node)
+		case "Key":
+			p.Key = fit[*TypeExpression](parent, node)
+		case "Value":
+			p.Value = fit[*TypeExpression](parent, node)
+		case "Parameters":
+			p.Parameters[c.index] = fit[*TypeExpression](parent, node)
+		case "Return":
+			p.Return = fit[*TypeExpression](parent, node)
+		}
+	case *SelectExpression:
+		switch c.field {
+		case "Cases":
+			p.Cases[c.index] = fit[*SelectCase](parent, node)
+		case "Default":
+			p.Default = fit[*BlockStatement](parent, node)
+		}
+	case *SelectCase:
+		switch c.field {
+		case "Channel":
+			p.Channel = fit[Expression](parent, node)
+		case "Value":
+			p.Value = fit[Expression](parent, node)
+		case "Binding":
+			p.Binding = fit[*Identifier](parent, node)
+		case "Body":
+			p.Body = fit[*BlockStatement](parent, node)
+		}
+	case *RecordDefinition:
+		switch c.field {
+		case "Fields":
+			p.Fields[c.index] = fit[*Identifier](parent, node)
+		case "Methods":
+			p.Methods[c.index] = fit[*LetStatement](parent, node)
+		}
+	case *RecordLiteral:
+		switch c.field {
+		case "Type":
+			p.Type = fit[Expression](parent, node)
+		case "Fields":
+			p.Fields[c.index] = fit[*Identifier](parent, node)
+		case "Values":
+			p.Values[c.index] = fit[Expression](parent, node)
+		}
+	case *WithExpression:
+		switch c.field {
+		case "Record":
+			p.Record = fit[Expression](parent, node)
+		case "Fields":
+			p.Fields[c.index] = fit[*Identifier](parent, node)
+		case "Values":
+			p.Values[c.index] = fit[Expression](parent, node)
+		}
+	case *ArrayPattern:
+		switch c.field {
+		case "Elements":
+			p.Elements[c.index] = fit[Pattern](parent, node)
+		case "Rest":
+			p.Rest = fit[*Identifier](parent, node)
+		}
+	case *HashPattern:
+		switch c.field {
+		case "Keys":
+			p.Keys[c.index] = fit[Expression](parent, node)
+		case "Values":
+			p.Values[c.index] = fit[Pattern](parent, node)
+		}
+	case *MatchExpression:
+		switch c.field {
+		case "Subject":
+			p.Subject = fit[Expression](parent, node)
+		case "Arms":
+			p.Arms[c.index] = fit[*MatchArm](parent, node)
+		}
+	case *MatchArm:
+		switch c.field {
+		case "Pattern":
+			p.Pattern = fit[Pattern](parent, node)
+		case "Guard":
+			p.Guard = fit[Expression](parent, node)
+		case "Body":
+			p.Body = fit[Expression](parent, node)
+		}
+	default:
+		panic(fmt.Sprintf("ast: unknown node %T", parent))
+	}
+}
+
+// node as a T, parent only names where it went wrong
+func fit[T Node](parent Node, node Node) T {
+	if isNil(node) {
+		var zero T
+		return zero
+	}
+	n, ok := node.(T)
+	if !ok {
+		var zero T
+		panic(fmt.Sprintf("ast: %T in %T cannot be replaced by %T", zero, parent, node))
+	}
+	return n
+}
+
+// whether a and b are the same type of node with the same token and
+// data, children aside
+func sameNode(a, b Node) bool {
+	switch a := a.(type) {
+	case *Program:
+		_, ok := b.(*Program)
+		return ok
+	case *Identifier:
+		b, ok := b.(*Identifier)
+		return ok && sameToken(a.Token, b.Token) && a.Value == b.Value
+	case *LetStatement:
+		b, ok := b.(*LetStatement)
+		return ok && sameToken(a.Token, b.Token) && a.Precedence == b.Precedence
+	case *DestructureStatement:
+		b, ok := b.(*DestructureStatement)
+		return ok && sameToken(a.Token, b.Token)
+	case *ReturnStatement:
+		b, ok := b.(*ReturnStatement)
+		return ok && sameToken(a.Token, b.Token)
+	case *ExpressionStatement:
+		b, ok := b.(*ExpressionStatement)
+		return ok && sameToken(a.Token, b.Token)
+	case *BlockStatement:
+		b, ok := b.(*BlockStatement)
+		return ok && sameToken(a.Token, b.Token)
+	case *ImportStatement:
+		b, ok := b.(*ImportStatement)
+		return ok && sameToken(a.Token, b.Token)
+	case *ExportStatement:
+		b, ok := b.(*ExportStatement)
+		return ok && sameToken(a.Token, b.Token)
+	case *IntegerLiteral:
+		b, ok := b.(*IntegerLiteral)
+		return ok && sameToken(a.Token, b.Token) && a.Value == b.Value
+	case *Boolean:
+		b, ok := b.(*Boolean)
+		return ok && sameToken(a.Token, b.Token) && a.Value == b.Value
+	case *StringLiteral:
+		b, ok := b.(*StringLiteral)
+		return ok && sameToken(a.Token, b.Token) && a.Value == b.Value
+	case *InterpolatedString:
+		b, ok := b.(*InterpolatedString)
+		return ok && sameToken(a.Token, b.Token) && slices.Equal(a.Parts, b.Parts)
+	case *PrefixExpression:
+		b, ok := b.(*PrefixExpression)
+		return ok && sameToken(a.Token, b.Token) && a.Operator == b.Operator
+	case *InfixExpression:
+		b, ok := b.(*InfixExpression)
+		return ok && sameToken(a.Token, b.Token) && a.Operator == b.Operator
+	case *IfExpression:
+		b, ok := b.(*IfExpression)
+		return ok && sameToken(a.Token, b.Token)
+	case *FunctionLiteral:
+		b, ok := b.(*FunctionLiteral)
+		return ok && sameToken(a.Token, b.Token)
+	case *MacroLiteral:
+		b, ok := b.(*MacroLiteral)
+		return ok && sameToken(a.Token, b.Token)
+	case *CallExpression:
+		b, ok := b.(*CallExpression)
+		return ok && sameToken(a.Token, b.Token)
+	case *MemberExpression:
+		b, ok := b.(*MemberExpression)
+		return ok && sameToken(a.Token, b.Token)
+	case *ArrayLiteral:
+		b, ok := b.(*ArrayLiteral)
+		return ok && sameToken(a.Token, b.Token)
+	case *IndexExpression:
+		b, ok := b.(*IndexExpression)
+		return ok && sameToken(a.Token, b.Token)
+	case *HashLiteral:
+		b, ok := b.(*HashLiteral)
+		return ok && sameToken(a.Token, b.Token)
+	case *TypeExpression:
+		b, ok := b.(*TypeExpression)
+		return ok && sameToken(a.Token, b.Token) && a.Name == b.Name
+	case *SelectExpression:
+		b, ok := b.(*SelectExpression)
+		return ok && sameToken(a.Token, b.Token)
+	case *SelectCase:
+		b, ok := b.(*SelectCase)
+		return ok && sameToken(a.Token, b.Token) && a.Send == b.Send
+	case *RecordDefinition:
+		b, ok := b.(*RecordDefinition)
+		return ok && sameToken(a.Token, b.Token) && a.Name == b.Name
+	case *RecordLiteral:
+		b, ok := b.(*RecordLiteral)
+		return ok && sameToken(a.Token, b.Token)
+	case *WithExpression:
+		b, ok := b.(*WithExpression)
+		return ok && sameToken(a.Token, b.Token)
+	case *ArrayPattern:
+		b, ok := b.(*ArrayPattern)
+		return ok && sameToken(a.Token, b.Token)
+	case *HashPattern:
+		b, ok := b.(*HashPattern)
+		return ok && sameToken(a.Token, b.Token)
+	case *MatchExpression:
+		b, ok := b.(*MatchExpression)
+		return ok && sameToken(a.Token, b.Token)
+	case *MatchArm:
+		b, ok := b.(*MatchArm)
+		return ok && sameToken(a.Token, b.Token)
+	}
+	panic(fmt.Sprintf("ast: unknown node %T", a))
+}
+
+func sameToken(a, b token.Token) bool {
+	return a.Type == b.Type && a.Literal == b.Literal
+}
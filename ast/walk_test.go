@@ -0,0 +1,407 @@
+package ast
+
+import (
+	"fmt"
+	goast "go/ast"
+	goparser "go/parser"
+	gotoken "go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/pro0o/sup-bud/token"
+)
+
+func id(name string) *Identifier { return &Identifier{Value: name} }
+
+func integer(value int64) *IntegerLiteral {
+	return &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10)}, Value: value}
+}
+
+func block(stmts ...Statement) *BlockStatement { return &BlockStatement{Statements: stmts} }
+
+// a tree with a node of every type in it
+func everyNode() *Program {
+	key := &StringLiteral{Value: "k"}
+	return &Program{Statements: []Statement{
+		&LetStatement{Name: id("x"), Value: &FunctionLiteral{
+			Parameters:     []*Identifier{id("a")},
+			ParameterTypes: []*TypeExpression{{Token: token.Token{Type: token.IDENT, Literal: "int"}, Name: "int"}},
+			ReturnType: &TypeExpression{
+				Token:   token.Token{Type: token.LBRACKET, Literal: "["},
+				Element: &TypeExpression{Token: token.Token{Type: token.IDENT, Literal: "int"}, Name: "int"},
+			},
+			Body: block(&ReturnStatement{ReturnValue: &InfixExpression{
+				Left:     &PrefixExpression{Operator: "-", Right: id("a")},
+				Operator: "+",
+				Right:    integer(1),
+			}}),
+		}},
+		&ImportStatement{Path: &StringLiteral{Value: "m"}, Alias: id("m")},
+		&ExportStatement{Statement: &LetStatement{Name: id("y"), Value: &Boolean{Value: true}}},
+		&LetStatement{Name: id("mac"), Value: &MacroLiteral{Parameters: []*Identifier{id("b")}, Body: block()}},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition: &Boolean{Value: false},
+			Consequence: block(&ExpressionStatement{Expression: &CallExpression{
+				Function:  &MemberExpression{Object: id("m"), Member: id("f")},
+				Arguments: []Expression{&IndexExpression{Left: &ArrayLiteral{Elements: []Expression{integer(1)}}, Index: integer(0)}},
+			}}),
+			Alternative: block(&ExpressionStatement{Expression: &HashLiteral{
+				Keys:  []Expression{key},
+				Pairs: map[Expression]Expression{key: integer(2)},
+			}}),
+		}},
+		&ExpressionStatement{Expression: &SelectExpression{
+			Cases:   []*SelectCase{{Channel: id("c"), Binding: id("v"), Body: block()}},
+			Default: block(),
+		}},
+		&LetStatement{Token: token.Token{Type: token.RECORD, Literal: "record"}, Name: id("P"), Value: &RecordDefinition{
+			Name:    "P",
+			Fields:  []*Identifier{id("x")},
+			Methods: []*LetStatement{{Name: id("f"), Value: &FunctionLiteral{Body: block()}}},
+		}},
+		&ExpressionStatement{Expression: &WithExpression{
+			Record: &RecordLiteral{Type: id("P"), Fields: []*Identifier{id("x")}, Values: []Expression{integer(3)}},
+			Fields: []*Identifier{id("x")},
+			Values: []Expression{integer(4)},
+		}},
+		&ExpressionStatement{Expression: &MatchExpression{
+			Subject: id("s"),
+			Arms: []*MatchArm{
+				{Pattern: &ArrayPattern{Elements: []Pattern{integer(5), id("_")}, Rest: id("r")}, Guard: id("g"), Body: id("r")},
+				{Pattern: &HashPattern{Keys: []Expression{&StringLiteral{Value: "k"}}, Values: []Pattern{id("v")}}, Body: id("v")},
+			},
+		}},
+		&DestructureStatement{Pattern: &ArrayPattern{Elements: []Pattern{id("d")}}, Value: &FunctionLiteral{
+			Parameters: []*Identifier{id("[e]"), id("f")},
+			Patterns:   []Pattern{&ArrayPattern{Elements: []Pattern{id("e")}}, nil},
+			Body:       block(),
+		}},
+		&ExpressionStatement{Expression: &InterpolatedString{
+			Token:  token.Token{Type: token.TEMPLATE_START, Literal: "t "},
+			Parts:  []string{"t ", ""},
+			Values: []Expression{id("t")},
+		}},
+	}}
+}
+
+// the node types declared in the package, the types with a
+// TokenLiteral method
+func nodeTypes(t *testing.T, files []*goast.File) []string {
+	var types []string
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Recv == nil || fn.Name.Name != "TokenLiteral" {
+				continue
+			}
+			star, ok := fn.Recv.List[0].Type.(*goast.StarExpr)
+			if !ok {
+				t.Fatalf("TokenLiteral of a non pointer receiver")
+			}
+			types = append(types, star.X.(*goast.Ident).Name)
+		}
+	}
+	sort.Strings(types)
+	return types
+}
+
+func parseSources(t *testing.T) []*goast.File {
+	paths, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []*goast.File
+	fset := gotoken.NewFileSet()
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := goparser.ParseFile(fset, path, src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// the types named by the cases of the type switches in a function, or
+// the strings of the plain switches
+func switchCases(files []*goast.File, name string) map[string]bool {
+	cases := make(map[string]bool)
+	for _, file := range files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*goast.FuncDecl)
+			if !ok || fn.Name.Name != name {
+				continue
+			}
+			goast.Inspect(fn.Body, func(n goast.Node) bool {
+				clause, ok := n.(*goast.CaseClause)
+				if !ok {
+					return true
+				}
+				for _, exp := range clause.List {
+					switch exp := exp.(type) {
+					case *goast.StarExpr:
+						if ident, ok := exp.X.(*goast.Ident); ok {
+							cases[ident.Name] = true
+						}
+					case *goast.BasicLit:
+						if s, err := strconv.Unquote(exp.Value); err == nil {
+							cases[s] = true
+						}
+					}
+				}
+				return true
+			})
+		}
+	}
+	return cases
+}
+
+// adding a node type without teaching these functions about it fails
+// here rather than with a panic deep in some tool
+func TestEveryNodeIsCovered(t *testing.T) {
+	files := parseSources(t)
+	types := nodeTypes(t, files)
+	if len(types) == 0 {
+		t.Fatalf("no node types found")
+	}
+
+	for _, fn := range []string{"children", "shallowCopy", "setChild", "sameNode", "encode", "decode", "SpanOf"} {
+		cases := switchCases(files, fn)
+		for _, typ := range types {
+			if !cases[typ] {
+				t.Errorf("%s does not handle %s", fn, typ)
+			}
+		}
+	}
+
+	seen := make(map[string]bool)
+	Inspect(everyNode(), func(node Node) bool {
+		if node != nil {
+			seen[reflect.TypeOf(node).Elem().Name()] = true
+		}
+		return true
+	})
+	for _, typ := range types {
+		if !seen[typ] {
+			t.Errorf("everyNode has no %s, add one", typ)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	// (-a + 1)
+	exp := &InfixExpression{Left: &PrefixExpression{Operator: "-", Right: id("a")}, Operator: "+", Right: integer(1)}
+
+	var visits []string
+	Inspect(exp, func(node Node) bool {
+		if node == nil {
+			visits = append(visits, "end")
+			return false
+		}
+		visits = append(visits, fmt.Sprintf("%T", node))
+		return true
+	})
+	expected := []string{
+		"*ast.InfixExpression",
+		"*ast.PrefixExpression", "*ast.Identifier", "end", "end",
+		"*ast.IntegerLiteral", "end",
+		"end",
+	}
+	if strings.Join(visits, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong visits.\ngot=%v\nwant=%v", visits, expected)
+	}
+
+	visits = nil
+	Inspect(exp, func(node Node) bool {
+		if node != nil {
+			visits = append(visits, fmt.Sprintf("%T", node))
+		}
+		_, prefix := node.(*PrefixExpression)
+		return !prefix
+	})
+	expected = []string{"*ast.InfixExpression", "*ast.PrefixExpression", "*ast.IntegerLiteral"}
+	if strings.Join(visits, " ") != strings.Join(expected, " ") {
+		t.Errorf("children of a false are visited.\ngot=%v\nwant=%v", visits, expected)
+	}
+}
+
+func TestInspectPath(t *testing.T) {
+	program := everyNode()
+	var found *Cursor
+	InspectPath(program, func(c *Cursor) bool {
+		if lit, ok := c.Node().(*IntegerLiteral); ok && lit.Value == 0 {
+			found = &Cursor{node: c.Node(), path: append([]Node(nil), c.Path()...), field: c.Field(), index: c.Index()}
+		}
+		return true
+	})
+	if found == nil {
+		t.Fatalf("index not found")
+	}
+	if found.Field() != "Index" || found.Index() != -1 {
+		t.Errorf("wrong field. got=%s[%d]", found.Field(), found.Index())
+	}
+	if _, ok := found.Parent().(*IndexExpression); !ok {
+		t.Errorf("parent is not the index expression. got=%T", found.Parent())
+	}
+
+	var path []string
+	for _, node := range found.Path() {
+		path = append(path, strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."))
+	}
+	expected := "Program ExpressionStatement IfExpression BlockStatement ExpressionStatement CallExpression IndexExpression"
+	if strings.Join(path, " ") != expected {
+		t.Errorf("wrong path.\ngot=%s\nwant=%s", strings.Join(path, " "), expected)
+	}
+
+	InspectPath(program, func(c *Cursor) bool {
+		if c.Node() == program && (c.Parent() != nil || c.Field() != "" || c.Index() != -1) {
+			t.Errorf("the root has a parent")
+		}
+		if call, ok := c.Parent().(*CallExpression); ok && c.Field() == "Arguments" && call.Arguments[c.Index()] != c.Node() {
+			t.Errorf("argument %d is not at its index", c.Index())
+		}
+		return true
+	})
+}
+
+func TestRewrite(t *testing.T) {
+	program := everyNode()
+	before := program.String()
+
+	same := Rewrite(program, func(c *Cursor) Node { return c.Node() })
+	if !Equal(same, program) {
+		t.Errorf("rewriting nothing changed the tree. got=%s", same)
+	}
+	if same == Node(program) {
+		t.Errorf("Rewrite did not copy the root")
+	}
+
+	// every integer counts how many calls it is in
+	rewritten := Rewrite(program, func(c *Cursor) Node {
+		if _, ok := c.Node().(*IntegerLiteral); !ok {
+			return c.Node()
+		}
+		calls := 0
+		for _, node := range c.Path() {
+			if _, ok := node.(*CallExpression); ok {
+				calls++
+			}
+		}
+		return integer(int64(100 + calls))
+	})
+	var values []string
+	Inspect(rewritten, func(node Node) bool {
+		if lit, ok := node.(*IntegerLiteral); ok {
+			values = append(values, lit.String())
+		}
+		return true
+	})
+	if strings.Join(values, " ") != "100 101 101 100 100 100 100" {
+		t.Errorf("wrong integers. got=%v", values)
+	}
+	hash := rewritten.(*Program).Statements[4].(*ExpressionStatement).Expression.(*IfExpression).Alternative.Statements[0].(*ExpressionStatement).Expression.(*HashLiteral)
+	if value := hash.Pairs[hash.Keys[0]]; value == nil || value.String() != "100" {
+		t.Errorf("hash value not rewritten. got=%v", value)
+	}
+
+	if program.String() != before {
+		t.Errorf("Rewrite changed its input.\nbefore=%s\nafter=%s", before, program)
+	}
+
+	// a key replaced keeps its value
+	rekeyed := Rewrite(program, func(c *Cursor) Node {
+		if c.Field() == "Keys" {
+			return &StringLiteral{Value: "new"}
+		}
+		return c.Node()
+	})
+	hash = rekeyed.(*Program).Statements[4].(*ExpressionStatement).Expression.(*IfExpression).Alternative.Statements[0].(*ExpressionStatement).Expression.(*HashLiteral)
+	if len(hash.Pairs) != 1 || hash.Pairs[hash.Keys[0]].String() != "2" {
+		t.Errorf("rekeyed hash lost its value. got=%s", hash)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	at := func(position int, typ token.TokenType, literal string) token.Token {
+		return token.Token{Type: typ, Literal: literal, Position: position}
+	}
+	tests := []struct {
+		a, b     Node
+		expected bool
+	}{
+		{everyNode(), everyNode(), true},
+		{nil, nil, true},
+		{integer(1), nil, false},
+		{integer(1), integer(2), false},
+		{integer(1), &Boolean{}, false},
+		// positions and resolver fields do not count
+		{
+			&Identifier{Token: at(0, token.IDENT, "x"), Value: "x"},
+			&Identifier{Token: at(7, token.IDENT, "x"), Value: "x", Resolved: true, Slot: 3},
+			true,
+		},
+		{&Identifier{Token: at(0, token.IDENT, "x"), Value: "x"}, &Identifier{Token: at(0, token.IDENT, "y"), Value: "x"}, false},
+		{
+			&InfixExpression{Left: integer(1), Operator: "+", Right: integer(2)},
+			&InfixExpression{Left: integer(1), Operator: "-", Right: integer(2)},
+			false,
+		},
+		{
+			&IfExpression{Condition: id("x"), Consequence: block()},
+			&IfExpression{Condition: id("x"), Consequence: block(), Alternative: block()},
+			false,
+		},
+		{&ArrayLiteral{Elements: []Expression{integer(1)}}, &ArrayLiteral{Elements: []Expression{integer(1), integer(1)}}, false},
+		{&LetStatement{Name: id("x"), Precedence: 1}, &LetStatement{Name: id("x"), Precedence: 2}, false},
+		{&SelectCase{Channel: id("c"), Send: true, Body: block()}, &SelectCase{Channel: id("c"), Body: block()}, false},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d]: Equal(%v, %v) = %t, want %t", i, tt.a, tt.b, got, tt.expected)
+		}
+	}
+}
+
+func TestMove(t *testing.T) {
+	positions := func(node Node) []int {
+		var out []int
+		Inspect(node, func(n Node) bool {
+			if n == nil {
+				return false
+			}
+			if tok := tokenOf(n); tok != nil {
+				out = append(out, tok.Position)
+			}
+			return true
+		})
+		return out
+	}
+	program := everyNode()
+	before := positions(program)
+
+	moved := positions(Move(program, 7))
+	if len(moved) != len(before) {
+		t.Fatalf("moved tree has %d tokens, want %d", len(moved), len(before))
+	}
+	for i := range before {
+		if moved[i] != before[i]+7 {
+			t.Errorf("token %d at %d, want %d", i, moved[i], before[i]+7)
+		}
+	}
+	if after := positions(program); !reflect.DeepEqual(after, before) {
+		t.Errorf("Move changed the tree it was given. got=%v, want=%v", after, before)
+	}
+}
@@ -0,0 +1,144 @@
+// sup-bud-cli runs a sup-bud script from the terminal.
+//
+//	sup-bud-cli [flags] script.sb
+//
+// the script is read from stdin when no file is given, imports
+// resolve relative to the script's directory. with -debug the script
+// runs under the step-through debugger, which reads its commands
+// from stdin.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pro0o/sup-bud/debugger"
+	"github.com/pro0o/sup-bud/eval"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/optimize"
+	"github.com/pro0o/sup-bud/parser"
+	"github.com/pro0o/sup-bud/typecheck"
+)
+
+func main() {
+	optimizeFlag := flag.Bool("O", false, "optimize the program before evaluating it")
+	printOptimized := flag.Bool("print-optimized", false, "print the optimized AST and exit")
+	timeout := flag.Duration("timeout", 5*time.Second, "evaluation timeout")
+	maxCallDepth := flag.Int("max-call-depth", eval.DefaultMaxCallDepth, "maximum nested bud calls")
+	debug := flag.Bool("debug", false, "step through the script, there is no timeout while debugging")
+	profile := flag.String("profile", "", "write a pprof profile to `file` and a report to stderr")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [script.sb]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *debug && (flag.Arg(0) == "" || flag.Arg(0) == "-") {
+		fmt.Fprintln(os.Stderr, "-debug needs a script file, stdin is for debugger commands")
+		os.Exit(1)
+	}
+
+	src, dir, err := readScript(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprint(os.Stderr, p.FormatErrors())
+		os.Exit(1)
+	}
+	for _, warning := range p.Warnings() {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+	if typecheck.Annotated(program) {
+		if errs := typecheck.Check(program); len(errs) != 0 {
+			fmt.Fprint(os.Stderr, typecheck.FormatErrors(src, errs))
+			os.Exit(1)
+		}
+	}
+
+	if *optimizeFlag || *printOptimized {
+		program = optimize.Program(program)
+	}
+	if *printOptimized {
+		for _, stmt := range program.Statements {
+			fmt.Println(stmt.String())
+		}
+		return
+	}
+
+	opts := eval.EvalOptions{
+		MaxCallDepth: *maxCallDepth,
+		Timeout:      *timeout,
+		Loader:       eval.NewModuleLoader(eval.DirFS(dir)),
+		Output:       os.Stdout,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var dbg *debugger.Debugger
+	if *debug {
+		dbg = debugger.New(src, os.Stdin, os.Stdout)
+		dbg.OnQuit(cancel)
+		opts.Debugger = dbg
+		opts.Timeout = 0
+	}
+	if *profile != "" {
+		opts.Profile = eval.NewProfile(flag.Arg(0), src)
+	}
+	evaluated := eval.EvalWithContext(ctx, program, object.NewEnvironment(), opts)
+	if dbg != nil && dbg.Quit() {
+		return
+	}
+	if opts.Profile != nil {
+		if err := writeProfile(opts.Profile, *profile); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if errObj, ok := evaluated.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, "ERROR:", eval.FormatError(src, errObj))
+		os.Exit(1)
+	}
+	if evaluated != nil {
+		fmt.Println(evaluated.Inspect())
+	}
+}
+
+func writeProfile(profile *eval.Profile, name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := profile.WritePprof(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return profile.WriteText(os.Stderr)
+}
+
+func readScript(name string) (src string, dir string, err error) {
+	if name == "" || name == "-" {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), ".", err
+	}
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", "", err
+	}
+	return strings.TrimPrefix(string(data), "\ufeff"), filepath.Dir(name), nil
+}
@@ -4,25 +4,29 @@
 package main
 
 import (
-	"strings"
+	"bytes"
+	"encoding/json"
 	"syscall/js"
 	"time"
 
+	"github.com/pro0o/sup-bud/ast"
 	"github.com/pro0o/sup-bud/eval"
 	"github.com/pro0o/sup-bud/lexer"
 	"github.com/pro0o/sup-bud/object"
 	"github.com/pro0o/sup-bud/parser"
+	"github.com/pro0o/sup-bud/typecheck"
 )
 
 func main() {
 	js.Global().Set("evaluateSupBud", js.FuncOf(evaluateSupBud))
+	js.Global().Set("parseSupBud", js.FuncOf(parseSupBud))
 	select {}
 }
 
 func evaluateSupBud(this js.Value, args []js.Value) interface{} {
 	evalOptions := eval.EvalOptions{
-		MaxDepth: 200,
-		Timeout:  5 * time.Second,
+		MaxCallDepth: 200,
+		Timeout:      5 * time.Second,
 	}
 
 	if len(args) < 1 {
@@ -31,60 +35,142 @@ func evaluateSupBud(this js.Value, args []js.Value) interface{} {
 		}
 	}
 
-	code := args[0].String()
-	l := lexer.New(code)
-
-	var errors []string
-
-	if l.HasErrors() {
-		errors = append(errors, l.Errors()...)
+	program, warnings, failed := parse(args[0].String(), nil)
+	if failed != nil {
+		return failed
 	}
-
-	p := parser.New(l)
-	program := p.ParseProgram()
-
-	if len(p.Errors()) != 0 {
-		errors = append(errors, p.Errors()...)
-	}
-
-	if len(errors) > 0 {
-		var errorBuilder strings.Builder
-		lexerErrors := l.FormatErrors()
-		parserErrors := p.FormatErrors()
-
-		if lexerErrors != "" {
-			errorBuilder.WriteString(lexerErrors)
-		}
-
-		if parserErrors != "" {
-			if lexerErrors != "" {
-				errorBuilder.WriteString("\n")
+	if typecheck.Annotated(program) {
+		if errs := typecheck.Check(program); len(errs) != 0 {
+			return map[string]interface{}{
+				"error":    typecheck.FormatErrors(args[0].String(), errs),
+				"warnings": warnings,
 			}
-			errorBuilder.WriteString(parserErrors)
 		}
+	}
 
-		return map[string]interface{}{
-			"error": errorBuilder.String(),
+	// optional second arg, a {path: source} object backing imports
+	files := eval.MapFS{}
+	if len(args) > 1 && args[1].Type() == js.TypeObject {
+		keys := js.Global().Get("Object").Call("keys", args[1])
+		for i := 0; i < keys.Length(); i++ {
+			name := keys.Index(i).String()
+			files[name] = args[1].Get(name).String()
+		}
+	}
+	evalOptions.Loader = eval.NewModuleLoader(files)
+
+	// optional third arg, {trace: true, maxTraceEvents: n} adds the
+	// evaluation trace as a JSON string under "trace"
+	if len(args) > 2 && args[2].Type() == js.TypeObject && args[2].Get("trace").Truthy() {
+		max := 0
+		if n := args[2].Get("maxTraceEvents"); n.Type() == js.TypeNumber {
+			max = n.Int()
 		}
+		evalOptions.Trace = eval.NewTrace(max)
 	}
 
 	env := object.NewEnvironment()
 
+	var output bytes.Buffer
+	evalOptions.Output = &output
 	evaluated := eval.EvalWithOptions(program, env, evalOptions)
 
+	var response map[string]interface{}
 	if evaluated == nil {
-		return map[string]interface{}{
+		response = map[string]interface{}{
 			"result": "null",
 		}
+	} else if errorObj, ok := evaluated.(*object.Error); ok {
+		response = map[string]interface{}{
+			"error": eval.FormatError(args[0].String(), errorObj),
+		}
+	} else {
+		response = map[string]interface{}{
+			"result": evaluated.Inspect(),
+		}
+	}
+
+	// what the program printed and what the parser warned about,
+	// errors or not
+	response["output"] = output.String()
+	response["warnings"] = warnings
+	if evalOptions.Trace != nil {
+		if data, err := json.Marshal(evalOptions.Trace); err == nil {
+			response["trace"] = string(data)
+		}
 	}
+	return response
+}
 
-	if errorObj, ok := evaluated.(*object.Error); ok {
+// parseSupBud(code) returns {ast: json} for the tree view, see
+// ast.MarshalNode for the shape, or {error} like evaluateSupBud. an
+// optional second arg {trace: true} adds the parser.TraceEvents as a
+// JSON array under "trace", errors or not.
+func parseSupBud(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
 		return map[string]interface{}{
-			"error": errorObj.Message,
+			"error": "No code provided",
 		}
 	}
 
-	return map[string]interface{}{
-		"result": evaluated.Inspect(),
+	var events []parser.TraceEvent
+	var tracer parser.Tracer
+	if len(args) > 1 && args[1].Type() == js.TypeObject && args[1].Get("trace").Truthy() {
+		events = []parser.TraceEvent{}
+		tracer = func(ev parser.TraceEvent) { events = append(events, ev) }
+	}
+
+	var response map[string]interface{}
+	program, _, failed := parse(args[0].String(), tracer)
+	if failed != nil {
+		response = failed
+	} else if data, err := json.Marshal(program); err != nil {
+		response = map[string]interface{}{
+			"error": err.Error(),
+		}
+	} else {
+		response = map[string]interface{}{
+			"ast": string(data),
+		}
+	}
+
+	if events != nil {
+		if data, err := json.Marshal(events); err == nil {
+			response["trace"] = string(data)
+		}
+	}
+	return response
+}
+
+// parse returns the program and the parser's warnings, like a match
+// that misses a case, or the response for a program that does not
+// parse: {error} with the formatted lexer and parser errors, and
+// {diagnostics} with where the lexer's are, their columns in UTF-16
+// units the way the editor counts them
+func parse(code string, tracer parser.Tracer) (*ast.Program, []interface{}, map[string]interface{}) {
+	l := lexer.New(code)
+	p := parser.New(l)
+	p.SetTracer(tracer)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		// js.ValueOf takes []interface{} but not []string
+		warnings := []interface{}{}
+		for _, w := range p.Warnings() {
+			warnings = append(warnings, w)
+		}
+		return program, warnings, nil
+	}
+	diagnostics := []interface{}{}
+	for _, d := range l.Diagnostics() {
+		diagnostics = append(diagnostics, map[string]interface{}{
+			"line":    d.Line,
+			"column":  d.UTF16Column,
+			"message": d.Message,
+		})
+	}
+	return nil, nil, map[string]interface{}{
+		"error":       p.FormatErrors(),
+		"diagnostics": diagnostics,
 	}
 }
@@ -0,0 +1,155 @@
+// Package conformance checks an engine against the sup-bud programs in
+// testdata. next to each name.sb are the golden files name.out, what
+// the program writes, name.result, what it evaluates to, and name.err,
+// the error it stops with, a missing file standing for nothing. the
+// suite belongs to the language rather than to the tree-walker, so
+// another engine passes it by implementing Engine.
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pro0o/sup-bud/eval"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/optimize"
+	"github.com/pro0o/sup-bud/parser"
+	"github.com/pro0o/sup-bud/typecheck"
+)
+
+// Result is what running a program gave, as the CLI shows it.
+type Result struct {
+	Output string // everything the program wrote
+	Value  string // the value of the program as it inspects, empty if none
+	Error  string // parser, type or runtime errors, empty if none
+}
+
+// Engine runs the program in file, its imports resolving relative to
+// the file's directory.
+type Engine interface {
+	Run(file string) Result
+}
+
+// Interpreter is the tree-walking evaluator behind the full pipeline
+// the CLI runs: parse, typecheck when annotated, optionally optimize,
+// evaluate. Output is what print wrote.
+type Interpreter struct {
+	Optimize bool
+	Timeout  time.Duration // zero is 5s
+}
+
+func (in Interpreter) Run(file string) Result {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return Result{Error: err.Error()}
+	}
+	src := string(data)
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return Result{Error: p.FormatErrors()}
+	}
+	if typecheck.Annotated(program) {
+		if errs := typecheck.Check(program); len(errs) != 0 {
+			return Result{Error: typecheck.FormatErrors(src, errs)}
+		}
+	}
+	if in.Optimize {
+		program = optimize.Program(program)
+	}
+
+	timeout := in.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+	var out bytes.Buffer
+	opts := eval.EvalOptions{
+		Timeout: timeout,
+		Loader:  eval.NewModuleLoader(eval.DirFS(filepath.Dir(file))),
+		Output:  &out,
+	}
+	evaluated := eval.EvalWithContext(context.Background(), program, object.NewEnvironment(), opts)
+
+	result := Result{Output: out.String()}
+	if errObj, ok := evaluated.(*object.Error); ok {
+		result.Error = eval.FormatError(src, errObj) + "\n"
+	} else if evaluated != nil {
+		result.Value = evaluated.Inspect() + "\n"
+	}
+	return result
+}
+
+// Run runs every .sb program directly in dir through engine, each as
+// a subtest, and compares what it gave with the golden files. with
+// update the golden files are written from engine instead.
+func Run(t *testing.T, dir string, engine Engine, update bool) {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.sb"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no programs in %s", dir)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".sb")
+		t.Run(name, func(t *testing.T) {
+			result := engine.Run(file)
+			base := strings.TrimSuffix(file, ".sb")
+			goldens := []struct {
+				ext string
+				got string
+			}{
+				{".out", result.Output},
+				{".result", result.Value},
+				{".err", result.Error},
+			}
+			for _, g := range goldens {
+				if update {
+					if err := writeGolden(base+g.ext, g.got); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				want, err := readGolden(base + g.ext)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if g.got != want {
+					t.Errorf("wrong %s.\ngot:\n%s\nwant:\n%s", name+g.ext, g.got, want)
+				}
+			}
+		})
+	}
+}
+
+// a missing golden file is an empty one
+func readGolden(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+// an empty golden file is not written, and one left over is removed
+func writeGolden(name, content string) error {
+	if content == "" {
+		err := os.Remove(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return os.WriteFile(name, []byte(content), 0o644)
+}
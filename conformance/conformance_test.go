@@ -0,0 +1,18 @@
+package conformance
+
+import (
+	"flag"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "write the golden files from the interpreter")
+
+func TestInterpreter(t *testing.T) {
+	Run(t, "testdata", Interpreter{}, *update)
+}
+
+// the optimizer must not change what a program does, so it passes
+// against the same golden files
+func TestOptimized(t *testing.T) {
+	Run(t, "testdata", Interpreter{Optimize: true}, false)
+}
@@ -0,0 +1,321 @@
+// Package debugger is a line based step-through debugger for the
+// terminal, built on the eval.Debugger hook.
+//
+//	dbg := debugger.New(src, os.Stdin, os.Stdout)
+//	opts.Debugger = dbg
+//
+// it pauses before the first statement and then whenever a step
+// finishes or a breakpoint line is reached, reading commands from in
+// until one of them resumes evaluation.
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/eval"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/parser"
+)
+
+const help = `commands:
+  s, step          step into the next statement
+  n, next          step over calls to the next statement
+  o, out           run until the current bud returns
+  c, continue      run until a breakpoint
+  b, break LINE    set a breakpoint, without LINE list them
+  d, delete LINE   remove a breakpoint
+  l, locals        show the bindings of the current scope
+  p, print EXPR    evaluate EXPR in the current scope
+  bt, stack        show the call stack
+  q, quit          stop the program
+an empty line repeats the last step command.
+`
+
+// how long print gives an expression, the program it pauses runs
+// without a timeout but a session should not hang on print loop()
+const printTimeout = 5 * time.Second
+
+type mode int
+
+const (
+	stepIn mode = iota
+	stepOver
+	stepOut
+	running
+	detached // quit, or no more commands to read
+)
+
+var steps = map[string]mode{
+	"s": stepIn, "step": stepIn,
+	"n": stepOver, "next": stepOver,
+	"o": stepOut, "out": stepOut,
+	"c": running, "continue": running,
+}
+
+type Debugger struct {
+	src    string
+	starts []int // byte offset every line starts at
+	in     *bufio.Scanner
+	out    io.Writer
+	opts   eval.EvalOptions // for print, never has a debugger
+	onQuit func()
+
+	mu          sync.Mutex // held while paused, so tasks wait too
+	mode        mode
+	depth       int // call depth the current step started at
+	lastStep    string
+	breakpoints map[int]bool
+	prevLine    int // line of the statement seen last
+	prevDepth   int
+	frames      []int // line each active call is at, main first
+	quit        bool
+}
+
+func New(src string, in io.Reader, out io.Writer) *Debugger {
+	starts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &Debugger{
+		src:         src,
+		starts:      starts,
+		in:          bufio.NewScanner(in),
+		out:         out,
+		opts:        eval.EvalOptions{MaxCallDepth: 200, Timeout: printTimeout},
+		mode:        stepIn,
+		lastStep:    "step",
+		breakpoints: make(map[int]bool),
+	}
+}
+
+// OnQuit sets what quit does besides detaching, usually cancelling
+// the context the program runs under.
+func (d *Debugger) OnQuit(f func()) { d.onQuit = f }
+
+// Quit reports whether the session ended with the quit command.
+func (d *Debugger) Quit() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.quit
+}
+
+// Break sets a breakpoint before the session starts.
+func (d *Debugger) Break(line int) {
+	d.mu.Lock()
+	d.breakpoints[line] = true
+	d.mu.Unlock()
+}
+
+// 1-based line of a byte offset
+func (d *Debugger) line(offset int) int {
+	return sort.SearchInts(d.starts, offset+1)
+}
+
+func (d *Debugger) source(line int) string {
+	if line < 1 || line > len(d.starts) {
+		return ""
+	}
+	end := len(d.src)
+	if line < len(d.starts) {
+		end = d.starts[line] - 1
+	}
+	return strings.TrimSpace(d.src[d.starts[line-1]:end])
+}
+
+func (d *Debugger) Before(node ast.Node, span ast.Span, env *object.Environment, calls []string) {
+	// statements are what the debugger steps through
+	if _, ok := node.(ast.Statement); !ok {
+		return
+	}
+	if _, ok := node.(*ast.BlockStatement); ok {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.mode == detached {
+		return
+	}
+
+	line := d.line(span.Start)
+	depth := len(calls)
+	for len(d.frames) < depth+1 {
+		d.frames = append(d.frames, line)
+	}
+	d.frames = d.frames[:depth+1]
+	d.frames[depth] = line
+
+	// a breakpoint fires once per visit to its line, not for
+	// every statement on it
+	entered := line != d.prevLine || depth != d.prevDepth
+	d.prevLine, d.prevDepth = line, depth
+
+	stop := false
+	switch d.mode {
+	case stepIn:
+		stop = true
+	case stepOver:
+		stop = depth <= d.depth
+	case stepOut:
+		stop = depth < d.depth
+	}
+	if !stop && !(d.breakpoints[line] && entered) {
+		return
+	}
+
+	if d.breakpoints[line] && entered && d.mode == running {
+		fmt.Fprintf(d.out, "breakpoint at line %d\n", line)
+	}
+	fmt.Fprintf(d.out, "%s:%d  %s\n", frameName(calls, depth), line, d.source(line))
+	d.prompt(env, calls, depth)
+}
+
+func frameName(calls []string, depth int) string {
+	if depth == 0 {
+		return "<main>"
+	}
+	return calls[depth-1]
+}
+
+// reads commands until one resumes evaluation
+func (d *Debugger) prompt(env *object.Environment, calls []string, depth int) {
+	for {
+		fmt.Fprint(d.out, "(sb) ")
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			d.mode = detached
+			return
+		}
+
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(d.in.Text()), " ")
+		arg = strings.TrimSpace(arg)
+		if cmd == "" {
+			cmd = d.lastStep
+		}
+
+		if m, ok := steps[cmd]; ok {
+			d.lastStep = cmd
+			d.depth = depth
+			d.mode = m
+			return
+		}
+
+		switch cmd {
+		case "b", "break":
+			if arg == "" {
+				d.listBreakpoints()
+				continue
+			}
+			if line, ok := d.lineArgument(arg); ok {
+				d.breakpoints[line] = true
+				fmt.Fprintf(d.out, "breakpoint set at line %d\n", line)
+			}
+
+		case "d", "delete":
+			if line, ok := d.lineArgument(arg); ok {
+				if !d.breakpoints[line] {
+					fmt.Fprintf(d.out, "no breakpoint at line %d\n", line)
+					continue
+				}
+				delete(d.breakpoints, line)
+			}
+
+		case "l", "locals":
+			d.locals(env)
+
+		case "p", "print":
+			d.print(arg, env)
+
+		case "bt", "stack":
+			for i := depth; i >= 0; i-- {
+				fmt.Fprintf(d.out, "#%d %s at line %d\n", depth-i, frameName(calls, i), d.frames[i])
+			}
+
+		case "q", "quit":
+			d.quit = true
+			d.mode = detached
+			if d.onQuit != nil {
+				d.onQuit()
+			}
+			return
+
+		case "h", "help":
+			fmt.Fprint(d.out, help)
+
+		default:
+			fmt.Fprintf(d.out, "unknown command %q, try help\n", cmd)
+		}
+	}
+}
+
+func (d *Debugger) lineArgument(arg string) (int, bool) {
+	line, err := strconv.Atoi(arg)
+	if err != nil || line < 1 || line > len(d.starts) {
+		fmt.Fprintf(d.out, "not a line number: %q\n", arg)
+		return 0, false
+	}
+	return line, true
+}
+
+func (d *Debugger) listBreakpoints() {
+	if len(d.breakpoints) == 0 {
+		fmt.Fprintln(d.out, "no breakpoints")
+		return
+	}
+	lines := make([]int, 0, len(d.breakpoints))
+	for line := range d.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	for _, line := range lines {
+		fmt.Fprintf(d.out, "line %d  %s\n", line, d.source(line))
+	}
+}
+
+func (d *Debugger) locals(env *object.Environment) {
+	bindings := env.Bindings()
+	if len(bindings) == 0 {
+		fmt.Fprintln(d.out, "no locals")
+		return
+	}
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(d.out, "%s = %s\n", name, inspect(bindings[name]))
+	}
+}
+
+func (d *Debugger) print(src string, env *object.Environment) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprint(d.out, p.FormatErrors())
+		return
+	}
+	fmt.Fprintln(d.out, inspect(eval.EvalWithOptions(program, env, d.opts)))
+}
+
+// buds print their signature, the whole body is too much here
+func inspect(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "nil"
+	case *object.Function:
+		return obj.Signature()
+	}
+	return obj.Inspect()
+}
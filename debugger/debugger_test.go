@@ -0,0 +1,119 @@
+package debugger
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pro0o/sup-bud/eval"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/parser"
+)
+
+const script = `sup fib = bud(n) {
+  if (n < 2) { return n; }
+  sup a = fib(n - 1);
+  a + fib(n - 2)
+};
+sup r = fib(3);
+r`
+
+// runs script under the debugger with commands as input
+func session(t *testing.T, commands string) (string, object.Object) {
+	t.Helper()
+	p := parser.New(lexer.New(script))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	var out strings.Builder
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dbg := New(script, strings.NewReader(commands), &out)
+	dbg.OnQuit(cancel)
+
+	result := eval.EvalWithContext(ctx, program, object.NewEnvironment(), eval.EvalOptions{Debugger: dbg})
+	return out.String(), result
+}
+
+func TestSession(t *testing.T) {
+	out, result := session(t, strings.Join([]string{
+		"b 3", "c", "l", "p n * 10", "bt", "c", "bt", "n", "", "o", "l", "c",
+	}, "\n"))
+
+	expected := `<main>:1  sup fib = bud(n) {
+(sb) breakpoint set at line 3
+(sb) breakpoint at line 3
+fib:3  sup a = fib(n - 1);
+(sb) n = 3
+(sb) 30
+(sb) #0 fib at line 3
+#1 <main> at line 6
+(sb) breakpoint at line 3
+fib:3  sup a = fib(n - 1);
+(sb) #0 fib at line 3
+#1 fib at line 3
+#2 <main> at line 6
+(sb) fib:4  a + fib(n - 2)
+(sb) fib:4  a + fib(n - 2)
+(sb) <main>:7  r
+(sb) fib = bud(n)
+r = 2
+(sb) `
+	if out != expected {
+		t.Errorf("wrong session.\nexpected:\n%s\ngot:\n%s", expected, out)
+	}
+	if result == nil || result.Inspect() != "2" {
+		t.Errorf("expected the program to finish with 2, got %v", result)
+	}
+}
+
+func TestStepping(t *testing.T) {
+	out, _ := session(t, "s\ns\ns\ns\ns\nq\n")
+	var lines []string
+	for _, line := range strings.Split(out, "\n") {
+		if loc, _, ok := strings.Cut(strings.TrimPrefix(line, "(sb) "), "  "); ok {
+			lines = append(lines, loc)
+		}
+	}
+	expected := []string{"<main>:1", "<main>:6", "fib:2", "fib:3", "fib:2", "fib:3"}
+	if strings.Join(lines, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong steps, expected %v, got %v", expected, lines)
+	}
+}
+
+func TestQuitAndErrors(t *testing.T) {
+	out, result := session(t, "b 99\nd 2\nfrobnicate\np )\nq\n")
+	for _, want := range []string{
+		`not a line number: "99"`,
+		"no breakpoint at line 2",
+		`unknown command "frobnicate"`,
+		"no prefix parse function for )",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+	if errObj, ok := result.(*object.Error); !ok || !strings.Contains(errObj.Message, "cancelled") {
+		t.Errorf("expected quit to cancel evaluation, got %v", result)
+	}
+}
+
+func TestPrintTimesOut(t *testing.T) {
+	src := "sup loop = bud() { loop() };\nloop"
+	var out strings.Builder
+	dbg := New(src, strings.NewReader("n\np loop()\nc\n"), &out)
+	dbg.opts.Timeout = 20 * time.Millisecond
+
+	result := eval.EvalWithOptions(parser.New(lexer.New(src)).ParseProgram(), object.NewEnvironment(),
+		eval.EvalOptions{Debugger: dbg})
+	if !strings.Contains(out.String(), "Evaluation timed out after 20ms") {
+		t.Errorf("expected print to time out, got:\n%s", out.String())
+	}
+	if _, ok := result.(*object.Function); !ok {
+		t.Errorf("expected the program to go on to its end, got %v", result)
+	}
+}
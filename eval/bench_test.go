@@ -0,0 +1,96 @@
+package eval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pro0o/sup-bud/object"
+)
+
+var benchmarkOptions = EvalOptions{Timeout: time.Minute}
+
+// parses once and evaluates input b.N times in a fresh environment
+func benchmarkEval(b *testing.B, input string, expected int64) {
+	b.Helper()
+	program := parseProgram(b, input)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		result := EvalWithOptions(program, object.NewEnvironment(), benchmarkOptions)
+		integer, ok := result.(*object.Integer)
+		if !ok || integer.Value != expected {
+			b.Fatalf("expected %d, got %s", expected, inspect(result))
+		}
+	}
+}
+
+func BenchmarkFib25(b *testing.B) {
+	input := `
+sup fib = bud(n) {
+	if (n < 2) { return n; }
+	fib(n - 1) + fib(n - 2)
+};
+fib(25);
+`
+	benchmarkEval(b, input, 75025)
+}
+
+func BenchmarkLoopSum(b *testing.B) {
+	input := `
+sup sum = bud(n, acc) {
+	if (n == 0) { return acc; }
+	return sum(n - 1, acc + n);
+};
+sum(10000, 0);
+`
+	benchmarkEval(b, input, 50005000)
+}
+
+func BenchmarkLoopSumSmall(b *testing.B) {
+	// stays inside the integer cache
+	input := `
+sup count = bud(n, acc) {
+	if (n == 0) { return acc; }
+	return count(n - 1, acc + 1);
+};
+count(1000, 0);
+`
+	benchmarkEval(b, input, 1000)
+}
+
+func BenchmarkClosures(b *testing.B) {
+	input := `
+sup compose = bud(f, g) { bud(x) { g(f(x)) } };
+sup adder = bud(n) { bud(x) { x + n } };
+sup apply = bud(n, acc) {
+	if (n == 0) { return acc; }
+	sup step = compose(adder(n), adder(1));
+	return apply(n - 1, step(acc));
+};
+apply(2000, 0);
+`
+	benchmarkEval(b, input, 2003000)
+}
+
+func BenchmarkNestedClosures(b *testing.B) {
+	// every reference in the innermost body reaches through the
+	// enclosing frames
+	input := `
+sup outer = bud(a) {
+	bud(b) {
+		bud(c) {
+			bud(d) {
+				bud(e) { a + b + c + d + e + a * b + c * d }
+			}
+		}
+	}
+};
+sup run = bud(n, acc) {
+	if (n == 0) { return acc; }
+	return run(n - 1, acc + outer(1)(2)(3)(4)(n));
+};
+run(2000, 0);
+`
+	benchmarkEval(b, input, 2000*(1+2+3+4+2+12)+2001000)
+}
@@ -0,0 +1,102 @@
+package eval
+
+import (
+	"github.com/pro0o/sup-bud/object"
+)
+
+// looked up after the environment, so scripts can shadow them
+var builtins = map[string]*object.Builtin{
+	"len": {
+		Name: "len",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *object.String:
+				return NewInteger(int64(len(arg.Value)))
+			case *object.Array:
+				return NewInteger(int64(len(arg.Elements)))
+			case *object.Hash:
+				return NewInteger(int64(len(arg.Pairs)))
+			default:
+				return newError("argument to `len` not supported, got %s", args[0].Type())
+			}
+		},
+	},
+	"first": {
+		Name: "first",
+		Fn: func(args ...object.Object) object.Object {
+			arr, errObj := arrayArgument("first", args)
+			if errObj != nil {
+				return errObj
+			}
+			if len(arr.Elements) > 0 {
+				return arr.Elements[0]
+			}
+			return NULL
+		},
+	},
+	"last": {
+		Name: "last",
+		Fn: func(args ...object.Object) object.Object {
+			arr, errObj := arrayArgument("last", args)
+			if errObj != nil {
+				return errObj
+			}
+			if length := len(arr.Elements); length > 0 {
+				return arr.Elements[length-1]
+			}
+			return NULL
+		},
+	},
+	"rest": {
+		Name: "rest",
+		Fn: func(args ...object.Object) object.Object {
+			arr, errObj := arrayArgument("rest", args)
+			if errObj != nil {
+				return errObj
+			}
+			length := len(arr.Elements)
+			if length == 0 {
+				return NULL
+			}
+			newElements := make([]object.Object, length-1)
+			copy(newElements, arr.Elements[1:length])
+			return &object.Array{Elements: newElements}
+		},
+	},
+	"push": {
+		Name: "push",
+		Fn: func(args ...object.Object) object.Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			arr, errObj := arrayArgument("push", args[:1])
+			if errObj != nil {
+				return errObj
+			}
+			// arrays are immutable, push hands back a new one
+			length := len(arr.Elements)
+			newElements := make([]object.Object, length+1)
+			copy(newElements, arr.Elements)
+			newElements[length] = args[1]
+			return &object.Array{Elements: newElements}
+		},
+	},
+	"format": {
+		Name: "format",
+		Fn:   formatString,
+	},
+}
+
+func arrayArgument(name string, args []object.Object) (*object.Array, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments. got=%d, want=1", len(args))
+	}
+	arr, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+	return arr, nil
+}
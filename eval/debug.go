@@ -0,0 +1,28 @@
+package eval
+
+import (
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+// Debugger is told about every node right before it is evaluated.
+// evaluation waits for Before to return, which is how a debugger
+// pauses. calls holds the names of the active bud calls, innermost
+// last (empty with LegacyDepth), and is only valid during the call.
+// spawned tasks run their own calls and may call Before concurrently.
+//
+// with no debugger set the evaluator only pays a bool check.
+type Debugger interface {
+	Before(node ast.Node, span ast.Span, env *object.Environment, calls []string)
+}
+
+// shows node to the debugger and profiler, only called when observed
+// is set so neither costs anything when unused
+func (e *evaluator) observe(node ast.Node, env *object.Environment) {
+	if e.prof != nil {
+		e.opts.Profile.hit(node)
+	}
+	if e.opts.Debugger != nil {
+		e.opts.Debugger.Before(node, ast.SpanOf(node), env, e.calls)
+	}
+}
@@ -0,0 +1,43 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+type recordingDebugger struct {
+	input string
+	seen  []string
+}
+
+func (r *recordingDebugger) Before(node ast.Node, span ast.Span, env *object.Environment, calls []string) {
+	if _, ok := node.(*ast.ExpressionStatement); !ok {
+		return
+	}
+	r.seen = append(r.seen, strings.Join(calls, ">")+" "+r.input[span.Start:span.End])
+}
+
+func TestDebuggerHook(t *testing.T) {
+	input := `sup f = bud(x) { g(x) + 1 };
+sup g = bud(y) { y * 2 };
+f(3);
+f(4)`
+	dbg := &recordingDebugger{input: input}
+	evaluated := EvalWithOptions(parseProgram(t, input), object.NewEnvironment(), EvalOptions{Debugger: dbg})
+	testIntegerObject(t, evaluated, 9)
+
+	expected := []string{
+		" f(3", // closing brackets are not in the tree
+		"f g(x) + 1",
+		"f>g y * 2",
+		" f(4",
+		"f g(x) + 1",
+		"f>g y * 2",
+	}
+	if strings.Join(dbg.seen, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong hook calls.\nexpected: %q\ngot:      %q", expected, dbg.seen)
+	}
+}
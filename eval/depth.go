@@ -0,0 +1,51 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pro0o/sup-bud/object"
+)
+
+// frames shown at each end of a long call chain
+const callChainEdge = 4
+
+func (e *evaluator) nestingError() *object.Error {
+	if e.opts.LegacyDepth {
+		return newError("Max recursion depth reached, Slow down brotherrrr—")
+	}
+	return newError("Max nesting depth of %d reached", e.opts.MaxNesting)
+}
+
+func (e *evaluator) callDepthError(callee string) *object.Error {
+	chain := append(append([]string{}, e.calls...), callee)
+	return newError("Max call depth of %d reached, Slow down brotherrrr— call chain: %s",
+		e.opts.MaxCallDepth, formatCallChain(chain))
+}
+
+// collapses repeats, fib -> fib -> fib reads as fib x3, and elides
+// the middle of chains that are still long after that
+func formatCallChain(calls []string) string {
+	var groups []string
+	for i := 0; i < len(calls); {
+		j := i
+		for j < len(calls) && calls[j] == calls[i] {
+			j++
+		}
+		if n := j - i; n > 1 {
+			groups = append(groups, fmt.Sprintf("%s x%d", calls[i], n))
+		} else {
+			groups = append(groups, calls[i])
+		}
+		i = j
+	}
+
+	if len(groups) > 2*callChainEdge+1 {
+		elided := len(groups) - 2*callChainEdge
+		head := groups[:callChainEdge]
+		tail := groups[len(groups)-callChainEdge:]
+		groups = append(append(append([]string{}, head...),
+			fmt.Sprintf("... %d more ...", elided)), tail...)
+	}
+	return strings.Join(groups, " -> ")
+}
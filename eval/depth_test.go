@@ -0,0 +1,48 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLongExpressionsAreNotRecursion(t *testing.T) {
+	input := "1" + strings.Repeat(" + 1", 5000)
+	testIntegerObject(t, testEval(t, input), 5001)
+}
+
+func TestCallDepthReportsChain(t *testing.T) {
+	input := `
+	sup down = bud(n) { if (n == 0) { 0 } else { 1 + down(n - 1) } };
+	sup start = bud() { down(50) + 0 };
+	start()`
+	opts := EvalOptions{MaxCallDepth: 10, Timeout: time.Second}
+	testErrorObject(t, testEvalWithOptions(t, input, opts),
+		"Max call depth of 10 reached, Slow down brotherrrr— call chain: start -> down x10")
+
+	mutual := `
+	sup ping = bud(n) { 1 + pong(n) };
+	sup pong = bud(n) { 1 + ping(n) };
+	ping(0)`
+	testErrorObject(t, testEvalWithOptions(t, mutual, opts),
+		"Max call depth of 10 reached, Slow down brotherrrr— call chain: "+
+			"ping -> pong -> ping -> pong -> ... 3 more ... -> pong -> ping -> pong -> ping")
+}
+
+func TestNestingLimit(t *testing.T) {
+	input := "1" + strings.Repeat(" + 1", 50)
+	opts := EvalOptions{MaxNesting: 20, Timeout: time.Second}
+	testErrorObject(t, testEvalUnoptimized(t, input, opts), "Max nesting depth of 20 reached")
+
+	// nesting is per call, deep recursion of shallow bodies is fine
+	recursion := `sup down = bud(n) { if (n == 0) { 0 } else { 1 + down(n - 1) } }; down(200)`
+	testIntegerObject(t, testEvalWithOptions(t, recursion, opts), 200)
+}
+
+func TestLegacyDepth(t *testing.T) {
+	opts := EvalOptions{MaxDepth: 200, LegacyDepth: true, Timeout: time.Second}
+	input := "1" + strings.Repeat(" + 1", 300)
+	testErrorObject(t, testEvalUnoptimized(t, input, opts),
+		"Max recursion depth reached, Slow down brotherrrr—")
+	testIntegerObject(t, testEvalWithOptions(t, "1 + 2 * 3", opts), 7)
+}
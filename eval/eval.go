@@ -3,6 +3,7 @@ package eval
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/pro0o/sup-bud/ast"
@@ -22,13 +23,106 @@ func isError(obj object.Object) bool {
 	return false
 }
 
+// used when the matching option is left at zero
+const (
+	DefaultMaxCallDepth = 1000
+	DefaultMaxNesting   = 10000
+)
+
 type EvalOptions struct {
-	MaxDepth int
-	Timeout  time.Duration
+	// MaxDepth is the old combined budget where every nested node and
+	// every call spends one, it only applies when LegacyDepth is set.
+	MaxDepth    int
+	LegacyDepth bool
+
+	MaxCallDepth int // nested bud calls, tail calls reuse their frame
+	MaxNesting   int // ast nesting within a single call
+
+	Timeout time.Duration
+	Loader  *ModuleLoader // resolves import statements, nil disables them
+	Output  io.Writer     // where print writes, nil drops what is printed
+
+	Debugger Debugger // called before every node when set
+	Trace    *Trace   // records the evaluation when set
+	Profile  *Profile // counts calls, time and nodes when set
+}
+
+func (opts EvalOptions) withDefaults() EvalOptions {
+	if opts.MaxCallDepth <= 0 {
+		opts.MaxCallDepth = DefaultMaxCallDepth
+	}
+	if opts.MaxNesting <= 0 {
+		opts.MaxNesting = DefaultMaxNesting
+	}
+	return opts
+}
+
+// budget a fresh call or evaluation starts with
+func (opts EvalOptions) initialDepth() int {
+	if opts.LegacyDepth {
+		return opts.MaxDepth
+	}
+	return opts.MaxNesting
+}
+
+// state for a single evaluation, one per module being evaluated
+type evaluator struct {
+	opts    EvalOptions
+	ctx     context.Context // cancelled on timeout, stops spawned tasks too
+	sched   *scheduler
+	path    string   // module path, "" for the main program
+	exports []string // names marked with export in this module
+	calls   []string // names of the active bud calls, innermost last
+	task    int      // id of the spawned task this runs, 0 for the program
+	level   int      // nodes entered and not yet exited, for traces
+
+	observed bool      // a debugger or profiler wants to see every node
+	prof     *profiler // call stack of the profiler, nil when not profiling
 }
 
 func EvalWithOptions(node ast.Node, env *object.Environment, opts EvalOptions) object.Object {
-	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	return EvalWithContext(context.Background(), node, env, opts)
+}
+
+// EvalWithContext is EvalWithOptions for hosts that want to cancel
+// evaluation themselves, opts.Timeout still applies when set.
+// node is resolved in place first, see resolve.
+func EvalWithContext(ctx context.Context, node ast.Node, env *object.Environment, opts EvalOptions) object.Object {
+	return runWithOptions(ctx, opts, func(e *evaluator) object.Object {
+		if program, ok := node.(*ast.Program); ok {
+			expanded, err := e.expandMacros(program, env)
+			if err != nil {
+				return err
+			}
+			node = expanded
+		}
+		resolve(node)
+		if e.prof != nil {
+			defer e.opts.Profile.run()()
+			e.profileEnter("(main)")
+			defer e.profileExit()
+		}
+		return e.evalWithDepthTracking(node, env, e.opts.initialDepth())
+	})
+}
+
+// ApplyFunction calls a bud or builtin with already evaluated args,
+// under the same limits as EvalWithContext.
+func ApplyFunction(ctx context.Context, fn object.Object, args []object.Object, opts EvalOptions) object.Object {
+	return runWithOptions(ctx, opts, func(e *evaluator) object.Object {
+		return e.applyFunctionWithDepthTracking(fn, args, e.opts.initialDepth())
+	})
+}
+
+func runWithOptions(parent context.Context, opts EvalOptions, run func(e *evaluator) object.Object) object.Object {
+	opts = opts.withDefaults()
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if opts.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(parent, opts.Timeout)
+	} else {
+		ctx, cancel = context.WithCancel(parent)
+	}
 	defer cancel()
 
 	resultChan := make(chan object.Object, 1)
@@ -41,7 +135,14 @@ func EvalWithOptions(node ast.Node, env *object.Environment, opts EvalOptions) o
 			}
 		}()
 
-		result := evalWithDepthTracking(node, env, opts.MaxDepth)
+		e := &evaluator{opts: opts, ctx: ctx, sched: newScheduler(ctx)}
+		e.observed = opts.Debugger != nil || opts.Profile != nil
+		if opts.Profile != nil {
+			e.prof = newProfiler()
+		}
+		e.sched.bindTaskBuiltins()
+		e.sched.bind("print", printBuiltin)
+		result := run(e)
 		resultChan <- result
 	}()
 
@@ -51,97 +152,206 @@ func EvalWithOptions(node ast.Node, env *object.Environment, opts EvalOptions) o
 	case err := <-errChan:
 		return newError("Evaluation error: %v", err)
 	case <-ctx.Done():
+		if parent.Err() != nil {
+			return newError("Evaluation cancelled: %v", parent.Err())
+		}
 		return newError("Evaluation timed out after %v", opts.Timeout)
 	}
 }
 
-func evalWithDepthTracking(node ast.Node, env *object.Environment, maxDepth int) object.Object {
+func (e *evaluator) evalWithDepthTracking(node ast.Node, env *object.Environment, maxDepth int) object.Object {
+	if e.opts.Trace != nil {
+		return e.traceNode(node, func() object.Object {
+			return e.evalNode(node, env, maxDepth)
+		})
+	}
+	return e.evalNode(node, env, maxDepth)
+}
+
+func (e *evaluator) evalNode(node ast.Node, env *object.Environment, maxDepth int) object.Object {
 	if maxDepth <= 0 {
-		return newError("Max recursion depth reached, Slow down brotherrrr—")
+		return e.nestingError()
+	}
+	if e.observed {
+		e.observe(node, env)
 	}
 
 	switch node := node.(type) {
 	case *ast.Program:
-		return evalProgramWithDepthTracking(node, env, maxDepth)
+		return e.evalProgramWithDepthTracking(node, env, maxDepth)
 
 	case *ast.ExpressionStatement:
-		return evalWithDepthTracking(node.Expression, env, maxDepth-1)
+		return e.evalWithDepthTracking(node.Expression, env, maxDepth-1)
 
 	case *ast.ReturnStatement:
-		val := evalWithDepthTracking(node.ReturnValue, env, maxDepth-1)
+		var val object.Object
+		if call, ok := node.ReturnValue.(*ast.CallExpression); ok {
+			// return f(x) is always a tail call
+			val = e.evalTailCall(call, env, maxDepth-1)
+		} else {
+			val = e.evalWithDepthTracking(node.ReturnValue, env, maxDepth-1)
+		}
 		if isError(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := evalWithDepthTracking(node.Value, env, maxDepth-1)
+		val := e.evalWithDepthTracking(node.Value, env, maxDepth-1)
+		if isError(val) {
+			return val
+		}
+		if fn, ok := val.(*object.Function); ok && fn.Name == "" {
+			fn.Name = node.Name.Value
+		}
+		e.bind(env, node.Name, val)
+		return nil
+
+	case *ast.DestructureStatement:
+		val := e.evalWithDepthTracking(node.Value, env, maxDepth-1)
+		if isError(val) {
+			return val
+		}
+		if err := e.destructure(node.Pattern, val, env); err != nil {
+			return err
+		}
+		return nil
+
+	case *ast.ImportStatement:
+		module := e.importModule(node, maxDepth)
+		if isError(module) {
+			return module
+		}
+		e.bind(env, node.Alias, module)
+		return nil
+
+	case *ast.ExportStatement:
+		val := e.evalWithDepthTracking(node.Statement, env, maxDepth-1)
 		if isError(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		e.exports = append(e.exports, node.Statement.Name.Value)
 		return nil
 
 	case *ast.IntegerLiteral:
-		return &object.Integer{Value: node.Value}
+		return NewInteger(node.Value)
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
+	case *ast.InterpolatedString:
+		return e.evalInterpolatedString(node, env, maxDepth)
+
+	case *ast.ArrayLiteral:
+		elements := e.evalExpressionsWithDepthTracking(node.Elements, env, maxDepth-1)
+		if len(elements) == 1 && isError(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return e.evalHashLiteralWithDepthTracking(node, env, maxDepth)
+
+	case *ast.IndexExpression:
+		left := e.evalWithDepthTracking(node.Left, env, maxDepth-1)
+		if isError(left) {
+			return left
+		}
+		index := e.evalWithDepthTracking(node.Index, env, maxDepth-1)
+		if isError(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
 
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
-		right := evalWithDepthTracking(node.Right, env, maxDepth-1)
+		right := e.evalWithDepthTracking(node.Right, env, maxDepth-1)
 		if isError(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		left := evalWithDepthTracking(node.Left, env, maxDepth-1)
+		left := e.evalWithDepthTracking(node.Left, env, maxDepth-1)
 		if isError(left) {
 			return left
 		}
-		right := evalWithDepthTracking(node.Right, env, maxDepth-1)
+		right := e.evalWithDepthTracking(node.Right, env, maxDepth-1)
 		if isError(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
 
 	case *ast.BlockStatement:
-		return evalBlockStatementWithDepthTracking(node, env, maxDepth)
+		return e.evalBlockStatementWithDepthTracking(node, env, maxDepth)
 
 	case *ast.IfExpression:
-		return evalIfExpressionWithDepthTracking(node, env, maxDepth)
+		return e.evalIfExpressionWithDepthTracking(node, env, maxDepth)
 
 	case *ast.Identifier:
-		return evalIdentifier(node, env)
+		return e.evalIdentifier(node, env)
 
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Parameters: params, Patterns: node.Patterns, Env: env, Body: body, Scope: node.Scope, Position: node.Token.Position}
+
+	case *ast.MemberExpression:
+		obj := e.evalWithDepthTracking(node.Object, env, maxDepth-1)
+		if isError(obj) {
+			return obj
+		}
+		return evalMemberExpression(obj, node.Member.Value)
+
+	case *ast.SelectExpression:
+		return e.evalSelectExpressionWithDepthTracking(node, env, maxDepth)
+
+	case *ast.MatchExpression:
+		return e.evalMatchExpression(node, env, maxDepth, false)
+
+	case *ast.MacroLiteral:
+		return newError("a macro can only be bound by a sup at the top level")
+
+	case *ast.RecordDefinition:
+		return evalRecordDefinition(node, env)
+
+	case *ast.RecordLiteral:
+		return e.evalRecordLiteral(node, env, maxDepth)
+
+	case *ast.WithExpression:
+		return e.evalWithExpression(node, env, maxDepth)
 
 	case *ast.CallExpression:
-		function := evalWithDepthTracking(node.Function, env, maxDepth-1)
+		if isSpecialCall(node, "quote") {
+			return e.quote(node, env, maxDepth)
+		}
+		function := e.evalWithDepthTracking(node.Function, env, maxDepth-1)
 		if isError(function) {
 			return function
 		}
-		args := evalExpressionsWithDepthTracking(node.Arguments, env, maxDepth-1)
+		args := e.evalExpressionsWithDepthTracking(node.Arguments, env, maxDepth-1)
 		if len(args) == 1 && isError(args[0]) {
 			return args[0]
 		}
-		return applyFunctionWithDepthTracking(function, args, maxDepth-1)
+		return e.applyFunctionWithDepthTracking(function, args, maxDepth-1)
 
 	default:
 		return nil
 	}
 }
 
-func evalProgramWithDepthTracking(program *ast.Program, env *object.Environment, maxDepth int) object.Object {
+func (e *evaluator) evalProgramWithDepthTracking(program *ast.Program, env *object.Environment, maxDepth int) object.Object {
 	var result object.Object
 	for _, statement := range program.Statements {
-		result = evalWithDepthTracking(statement, env, maxDepth-1)
+		result = e.evalWithDepthTracking(statement, env, maxDepth-1)
 		switch result := result.(type) {
 		case *object.ReturnValue:
+			// a top level return f(x) still has to run f
+			if tc, ok := result.Value.(*tailCall); ok {
+				return e.applyFunctionWithDepthTracking(tc.fn, tc.args, maxDepth-1)
+			}
 			return result.Value
 		case *object.Error:
 			return result
@@ -150,10 +360,10 @@ func evalProgramWithDepthTracking(program *ast.Program, env *object.Environment,
 	return result
 }
 
-func evalBlockStatementWithDepthTracking(block *ast.BlockStatement, env *object.Environment, maxDepth int) object.Object {
+func (e *evaluator) evalBlockStatementWithDepthTracking(block *ast.BlockStatement, env *object.Environment, maxDepth int) object.Object {
 	var result object.Object
 	for _, statement := range block.Statements {
-		result = evalWithDepthTracking(statement, env, maxDepth-1)
+		result = e.evalWithDepthTracking(statement, env, maxDepth-1)
 		if result != nil {
 			rt := result.Type()
 			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
@@ -161,41 +371,173 @@ func evalBlockStatementWithDepthTracking(block *ast.BlockStatement, env *object.
 			}
 		}
 	}
+	return blockResult(result)
+}
+
+// a block is an expression, one that is empty or ends in a statement
+// is null rather than no value at all
+func blockResult(result object.Object) object.Object {
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
-func evalIfExpressionWithDepthTracking(ie *ast.IfExpression, env *object.Environment, maxDepth int) object.Object {
-	condition := evalWithDepthTracking(ie.Condition, env, maxDepth-1)
+func (e *evaluator) evalIfExpressionWithDepthTracking(ie *ast.IfExpression, env *object.Environment, maxDepth int) object.Object {
+	condition := e.evalWithDepthTracking(ie.Condition, env, maxDepth-1)
 	if isError(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
-		return evalWithDepthTracking(ie.Consequence, env, maxDepth-1)
+		return e.evalWithDepthTracking(ie.Consequence, env, maxDepth-1)
 	} else if ie.Alternative != nil {
-		return evalWithDepthTracking(ie.Alternative, env, maxDepth-1)
+		return e.evalWithDepthTracking(ie.Alternative, env, maxDepth-1)
 	} else {
 		return NULL
 	}
 }
 
-func applyFunctionWithDepthTracking(bud object.Object, args []object.Object, maxDepth int) object.Object {
-	function, ok := bud.(*object.Function)
-	if !ok {
-		return newError("not a function: %s", bud.Type())
+func (e *evaluator) applyFunctionWithDepthTracking(bud object.Object, args []object.Object, maxDepth int) object.Object {
+	pushed := false
+	tail := false
+	profiled := 0 // frames this call has on the profile stack
+	defer func() {
+		if pushed {
+			e.calls = e.calls[:len(e.calls)-1]
+		}
+		for ; profiled > 0; profiled-- {
+			e.profileExit()
+		}
+	}()
+
+	for {
+		// recursion is the only way to loop, so this is where a timed out
+		// or cancelled evaluation and its tasks notice and unwind
+		if err := e.ctx.Err(); err != nil {
+			return newError("Evaluation cancelled: %v", err)
+		}
+
+		switch function := bud.(type) {
+		case *object.Function:
+			if len(args) != len(function.Parameters) {
+				return newError("wrong number of arguments: want=%d, got=%d",
+					len(function.Parameters), len(args))
+			}
+
+			bodyDepth := maxDepth
+			if !e.opts.LegacyDepth {
+				if pushed {
+					e.calls[len(e.calls)-1] = function.DisplayName()
+				} else {
+					if len(e.calls) >= e.opts.MaxCallDepth {
+						return e.callDepthError(function.DisplayName())
+					}
+					e.calls = append(e.calls, function.DisplayName())
+					pushed = true
+				}
+				bodyDepth = e.opts.MaxNesting
+			}
+			if e.opts.Trace != nil {
+				e.traceCall(function.DisplayName(), args, tail)
+			}
+			if e.prof != nil {
+				// the function first called stays on the profile stack
+				// through its tail calls, so its cumulative time covers
+				// them, while each tail callee replaces the one before
+				if profiled == 2 {
+					e.profileExit()
+					profiled--
+				}
+				e.profileEnter(e.opts.Profile.functionName(function))
+				profiled++
+			}
+
+			var evaluated object.Object
+			if extendedEnv, err := e.extendFunctionEnv(function, args); err != nil {
+				evaluated = err
+			} else {
+				evaluated = unwrapReturnValue(e.evalTailBlock(function.Body, extendedEnv, bodyDepth))
+			}
+
+			// trampoline, the tail call reuses this frame and its depth
+			if tc, ok := evaluated.(*tailCall); ok {
+				bud, args = tc.fn, tc.args
+				tail = true
+				continue
+			}
+			if e.opts.Trace != nil {
+				e.traceReturn(function.DisplayName(), evaluated)
+			}
+			return evaluated
+
+		case *object.Builtin:
+			if e.opts.Trace != nil {
+				e.traceCall(function.Name, args, tail)
+			}
+			if e.prof != nil {
+				if profiled == 2 {
+					e.profileExit()
+					profiled--
+				}
+				e.profileEnter(function.Name)
+			}
+			var result object.Object
+			if fn, ok := e.sched.bound[function]; ok {
+				result = fn(e, args...)
+			} else if function.FnContext != nil {
+				result = function.FnContext(e.ctx, args...)
+			} else {
+				result = function.Fn(args...)
+			}
+			if e.prof != nil {
+				e.profileExit()
+			}
+			if result == nil {
+				result = NULL
+			}
+			if e.opts.Trace != nil {
+				e.traceReturn(function.Name, result)
+			}
+			return result
+
+		default:
+			return newError("not a function: %s", bud.Type())
+		}
+	}
+}
+
+func (e *evaluator) evalHashLiteralWithDepthTracking(
+	node *ast.HashLiteral,
+	env *object.Environment,
+	maxDepth int,
+) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, keyNode := range node.Keys {
+		key := e.evalWithDepthTracking(keyNode, env, maxDepth-1)
+		if isError(key) {
+			return key
+		}
+		hashKey, ok := key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", key.Type())
+		}
+		value := e.evalWithDepthTracking(node.Pairs[keyNode], env, maxDepth-1)
+		if isError(value) {
+			return value
+		}
+		pairs[hashKey.HashKey()] = object.HashPair{Key: key, Value: value}
 	}
-	extendedEnv := extendFunctionEnv(function, args)
-	evaluated := evalWithDepthTracking(function.Body, extendedEnv, maxDepth)
-	return unwrapReturnValue(evaluated)
+	return &object.Hash{Pairs: pairs}
 }
 
-func evalExpressionsWithDepthTracking(
+func (e *evaluator) evalExpressionsWithDepthTracking(
 	exps []ast.Expression,
 	env *object.Environment,
 	maxDepth int,
 ) []object.Object {
 	var result []object.Object
-	for _, e := range exps {
-		evaluated := evalWithDepthTracking(e, env, maxDepth-1)
+	for _, exp := range exps {
+		evaluated := e.evalWithDepthTracking(exp, env, maxDepth-1)
 		if isError(evaluated) {
 			return []object.Object{evaluated}
 		}
@@ -205,15 +547,42 @@ func evalExpressionsWithDepthTracking(
 }
 
 // extension of func env
-func extendFunctionEnv(
+func (e *evaluator) extendFunctionEnv(
 	bud *object.Function,
 	args []object.Object,
-) *object.Environment {
-	env := object.NewEnclosedEnvironment(bud.Env)
+) (*object.Environment, *object.Error) {
+	var env *object.Environment
+	if bud.Scope == nil {
+		env = object.NewEnclosedEnvironment(bud.Env)
+	} else {
+		env = object.NewFrame(bud.Scope, bud.Env)
+	}
 	for paramIdx, param := range bud.Parameters {
-		env.Set(param.Value, args[paramIdx])
+		e.bind(env, param, args[paramIdx])
 	}
-	return env
+	// then the patterns take their arguments apart
+	for paramIdx, pattern := range bud.Patterns {
+		if pattern == nil {
+			continue
+		}
+		if err := e.destructure(pattern, args[paramIdx], env); err != nil {
+			err.Message = fmt.Sprintf("argument %d to %s: %s", paramIdx+1, bud.DisplayName(), err.Message)
+			return nil, err
+		}
+	}
+	return env, nil
+}
+
+// binds a declared name, straight into its slot once resolved
+func (e *evaluator) bind(env *object.Environment, name *ast.Identifier, val object.Object) {
+	if e.opts.Trace != nil && !e.opts.Trace.skip() {
+		e.opts.Trace.add(TraceEvent{Kind: TraceBind, Name: name.Value, Value: traceValue(val)}, e)
+	}
+	if name.Resolved && name.Slot >= 0 {
+		env.SetSlot(name.Slot, name.Value, val)
+		return
+	}
+	env.Set(name.Value, val)
 }
 
 // func evalStatements(stmts []ast.Statement) object.Object {
@@ -266,10 +635,8 @@ func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
 	if right.Type() != object.INTEGER_OBJ {
 		return newError("unknown operator: -%s", right.Type())
 	}
-	// if obj is int, we allcoate a new obbj to wrap a
-	// negated version to this val
 	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
+	return NewInteger(-value)
 }
 
 // infix
@@ -284,36 +651,67 @@ func evalInfixExpression(
 			left.Type(), operator, right.Type())
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
-		return nativeBoolToBooleanObject(left == right)
+		return nativeBoolToBooleanObject(objectsEqual(left, right))
 	case operator == "!=":
-		return nativeBoolToBooleanObject(left != right)
+		return nativeBoolToBooleanObject(!objectsEqual(left, right))
 	default:
 		return newError("unknown operator: %s %s %s",
 			left.Type(), operator, right.Type())
 	}
 }
 
+// integers are only shared when small, so they compare by value, and
+// so do strings. records are equal when they are of the same record
+// type with equal fields. booleans and null are singletons, everything
+// else is identity.
+func objectsEqual(left, right object.Object) bool {
+	switch l := left.(type) {
+	case *object.Integer:
+		r, ok := right.(*object.Integer)
+		return ok && l.Value == r.Value
+	case *object.String:
+		r, ok := right.(*object.String)
+		return ok && l.Value == r.Value
+	case *object.Record:
+		r, ok := right.(*object.Record)
+		if !ok || l.Def != r.Def {
+			return false
+		}
+		for i := range l.Values {
+			if !objectsEqual(l.Values[i], r.Values[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return left == right
+}
+
 // infix <- int
 func evalIntegerInfixExpression(
 	operator string,
 	left, right object.Object,
 ) object.Object {
-	// lavde lang doesnt allow pointer comparison for int objs.
-	// *obj.int alwats allocates new instacnes of obj.integer
-	// thus slower than bool exp.
+	// results go through NewInteger, small ones are shared and
+	// the rest allocate, so compare values never pointers.
 	leftVal := left.(*object.Integer).Value
 	rightVal := right.(*object.Integer).Value
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftVal + rightVal}
+		return NewInteger(leftVal + rightVal)
 	case "-":
-		return &object.Integer{Value: leftVal - rightVal}
+		return NewInteger(leftVal - rightVal)
 	case "*":
-		return &object.Integer{Value: leftVal * rightVal}
+		return NewInteger(leftVal * rightVal)
 	case "/":
-		return &object.Integer{Value: leftVal / rightVal}
+		if rightVal == 0 {
+			return newError("division by zero: %d / %d", leftVal, rightVal)
+		}
+		return NewInteger(leftVal / rightVal)
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
@@ -328,6 +726,68 @@ func evalIntegerInfixExpression(
 	}
 }
 
+// infix <- str
+func evalStringInfixExpression(
+	operator string,
+	left, right object.Object,
+) object.Object {
+	leftVal := left.(*object.String).Value
+	rightVal := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftVal + rightVal}
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s",
+			left.Type(), operator, right.Type())
+	}
+}
+
+// arr[i], hash[key]
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		elements := left.(*object.Array).Elements
+		idx := index.(*object.Integer).Value
+		if idx < 0 || idx >= int64(len(elements)) {
+			return NULL
+		}
+		return elements[idx]
+	case left.Type() == object.HASH_OBJ:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		pair, ok := left.(*object.Hash).Pairs[key.HashKey()]
+		if !ok {
+			return NULL
+		}
+		return pair.Value
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// m.name
+func evalMemberExpression(obj object.Object, name string) object.Object {
+	switch obj := obj.(type) {
+	case *object.Module:
+		val, ok := obj.Exports[name]
+		if !ok {
+			return newError("module %q has no export named %s", obj.Path, name)
+		}
+		return val
+	case *object.Record:
+		return evalRecordMember(obj, name)
+	default:
+		return newError("cannot access member %s on %s", name, obj.Type())
+	}
+}
+
 func isTruthy(obj object.Object) bool {
 	switch obj {
 	case TRUE:
@@ -345,14 +805,23 @@ func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
-func evalIdentifier(
+func (e *evaluator) evalIdentifier(
 	node *ast.Identifier,
 	env *object.Environment) object.Object {
-	val, ok := env.Get(node.Value)
-	if !ok {
-		return newError("identifier not found: %s", node.Value)
+	if node.Resolved {
+		if val, ok := env.Resolve(node.Depth, node.Slot, node.Value); ok {
+			return val
+		}
+	} else if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+	if builtin, ok := e.sched.builtins[node.Value]; ok {
+		return builtin
 	}
-	return val
+	return newError("identifier not found: %s", node.Value)
 }
 
 func unwrapReturnValue(obj object.Object) object.Object {
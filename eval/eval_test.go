@@ -0,0 +1,472 @@
+package eval
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/optimize"
+	"github.com/pro0o/sup-bud/parser"
+)
+
+func parseProgram(t testing.TB, input string) *ast.Program {
+	t.Helper()
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+// nesting limits depend on the shape of the tree, which the optimizer
+// is free to change, so tests of those limits skip the comparison
+func testEvalUnoptimized(t *testing.T, input string, opts EvalOptions) object.Object {
+	t.Helper()
+	return EvalWithOptions(parseProgram(t, input), object.NewEnvironment(), opts)
+}
+
+// every eval test doubles as an optimizer test and a JSON round trip
+// test, the optimized and the decoded program have to produce the
+// same result as the original.
+func testEvalWithOptions(t *testing.T, input string, opts EvalOptions) object.Object {
+	t.Helper()
+	result := EvalWithOptions(parseProgram(t, input), object.NewEnvironment(), opts)
+
+	optimized := EvalWithOptions(optimize.Program(parseProgram(t, input)), object.NewEnvironment(), opts)
+	if inspect(result) != inspect(optimized) {
+		t.Errorf("optimized program evaluates differently for %q. original=%s, optimized=%s",
+			input, inspect(result), inspect(optimized))
+	}
+
+	if decoded := roundTrip(t, parseProgram(t, input)); decoded == nil {
+		// too deep for JSON, see ast.MarshalNode
+	} else if decoded := EvalWithOptions(decoded, object.NewEnvironment(), opts); inspect(result) != inspect(decoded) {
+		t.Errorf("decoded program evaluates differently for %q. original=%s, decoded=%s",
+			input, inspect(result), inspect(decoded))
+	}
+	return result
+}
+
+func roundTrip(t *testing.T, program *ast.Program) *ast.Program {
+	t.Helper()
+	data, err := json.Marshal(program)
+	if err != nil && strings.Contains(err.Error(), "exceeded max depth") {
+		return nil
+	}
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var decoded ast.Program
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return &decoded
+}
+
+// function bodies print their optimized source, compare the rest
+func inspect(obj object.Object) string {
+	switch obj.(type) {
+	case nil:
+		return "<nil>"
+	case *object.Function:
+		return "FUNCTION"
+	}
+	return obj.Inspect()
+}
+
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+	return testEvalWithOptions(t, input, EvalOptions{MaxCallDepth: 200, Timeout: time.Second})
+}
+
+func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
+	t.Helper()
+	result, ok := obj.(*object.Integer)
+	if !ok {
+		t.Errorf("object is not Integer. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%d, want=%d", result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func testErrorObject(t *testing.T, obj object.Object, expected string) bool {
+	t.Helper()
+	errObj, ok := obj.(*object.Error)
+	if !ok {
+		t.Errorf("no error object returned. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if errObj.Message != expected {
+		t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+		return false
+	}
+	return true
+}
+
+func TestArraysHashesAndBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`[1, 2 * 2, 3][1]`, 4},
+		{`sup a = [1, 2, 3]; a[0] + a[1] + a[2]`, 6},
+		{`len(push([1], 2))`, 2},
+		{`first(rest([1, 2, 3]))`, 2},
+		{`last([1, 2, 3])`, 3},
+		{`{"a": 1, true: 2, 3: 3}["a"]`, 1},
+		{`{"a": 1, true: 2, 3: 3}[true]`, 2},
+		{`len("sup" + "bud")`, 6},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	if result := testEval(t, `[1, 2][5]`); result != NULL {
+		t.Errorf("out of range index should be null. got=%s", result.Inspect())
+	}
+	testErrorObject(t, testEval(t, `{[1]: 2}`), "unusable as hash key: ARRAY")
+	testErrorObject(t, testEval(t, `bud(x) { x }(1, 2)`), "wrong number of arguments: want=1, got=2")
+	testErrorObject(t, testEval(t, `sup zero = 0; 10 / zero`), "division by zero: 10 / 0")
+}
+
+func TestUserOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`infixl 6 <+> = bud(a, b) { a * 10 + b }; 1 <+> 2 <+> 3`, 123},
+		{`infixr 6 <+> = bud(a, b) { a * 10 + b }; 1 <+> 2 <+> 3`, 33},
+		{`infixl 6 -- = bud(a, b) { a - b }; 10 -- 3 + 1 * 2`, 9},
+		{`infixr 8 ^ = bud(a, b) { if (b == 0) { 1 } else { a * (a ^ (b - 1)) } }; 2 ^ 3 ^ 2`, 512},
+		{`sup base = 100; infixl 6 <+> = bud(a, b) { base + a + b }; 1 <+> 2`, 103},
+		{`sup add = bud(a, b) { a + b }; infixl 6 <+> = add; 2 <+> 3`, 5},
+		// a tail call through an operator does not grow the stack
+		{`infixl 6 <+> = bud(n, acc) { if (n == 0) { acc } else { (n - 1) <+> (acc + 1) } }; 5000 <+> 0`, 5000},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	testErrorObject(t, testEval(t, `infixl 6 <+> = 5; 1 <+> 2`), "not a function: INTEGER")
+}
+
+// annotations are for the type checker, the evaluator goes by values
+func TestTypeAnnotationsAreIgnored(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`sup x: int = 5; x`, 5},
+		{`sup add = bud(a: int, b: int) -> int { a + b }; add(2, 3)`, 5},
+		{`sup apply: bud(bud(int) -> int, int) -> int = bud(f, x) { f(x) }; apply(bud(n) { n * 2 }, 21)`, 42},
+		{`sup xs: [int] = [1, 2, 3]; len(xs)`, 3},
+		{`sup f = bud(n: int) -> int { if (n == 0) { 0 } else { f(n - 1) } }; f(3000)`, 0},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	// a wrong annotation is not checked here
+	if str, ok := testEval(t, `sup x: int = "a"; x`).(*object.String); !ok || str.Value != "a" {
+		t.Errorf("annotation changed the value. got=%v", str)
+	}
+}
+
+func TestRecords(t *testing.T) {
+	point := `record Point {
+		x, y;
+		sup norm = bud() { self.x * self.x + self.y * self.y };
+		sup move = bud(dx, dy) { self with {x: self.x + dx, y: self.y + dy} };
+	}
+	`
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{point + `Point{x: 1, y: 2}`, "Point{x: 1, y: 2}"},
+		{point + `Point{y: 2, x: 1}`, "Point{x: 1, y: 2}"},
+		{point + `Point`, "record Point { x, y }"},
+		{point + `Point{x: 1, y: 2}.y`, "2"},
+		{point + `sup p = Point{x: 1, y: 2}; sup q = p with {x: 3}; [p, q]`, "[Point{x: 1, y: 2}, Point{x: 3, y: 2}]"},
+		{point + `Point{x: 3, y: 4}.norm()`, "25"},
+		{point + `Point{x: 1, y: 2}.move(1, 1).move(1, 1)`, "Point{x: 3, y: 4}"},
+		// a method keeps the record it was looked up on
+		{point + `sup n = Point{x: 1, y: 1}.norm; sup self = 10; n() + self`, "12"},
+		{`record Box { value } Box{value: Box{value: "a"}}`, "Box{value: Box{value: a}}"},
+		// records are equal field by field
+		{point + `Point{x: 1, y: 2} == Point{x: 1, y: 2}`, "true"},
+		{point + `Point{x: 1, y: 2} != Point{x: 1, y: 3}`, "true"},
+		{`record S { s } S{s: "a" + "b"} == S{s: "ab"}`, "true"},
+		{`record A { v } record B { v } A{v: 1} == B{v: 1}`, "false"},
+		{point + `Point{x: 1, y: 2} with {y: 5} == Point{x: 1, y: 5}`, "true"},
+		// methods see what the record was declared next to
+		{`sup scale = 3; record V { n; sup big = bud() { self.n * scale } } V{n: 2}.big()`, "6"},
+		{`sup make = bud(k) { record K { n; sup get = bud() { self.n + k } } K{n: 1} }; make(10).get()`, "11"},
+		{`record Node { value, next; sup sum = bud() { if (self.next) { self.value + self.next.sum() } else { self.value } } }
+		Node{value: 1, next: Node{value: 2, next: Node{value: 3, next: false}}}.sum()`, "6"},
+	}
+	for _, tt := range tests {
+		if got := inspect(testEval(t, tt.input)); got != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{point + `Point{x: 1}`, "missing field y in Point"},
+		{point + `Point{x: 1, y: 2, z: 3}`, "Point has no field z"},
+		{point + `Point{x: 1, y: 2}.z`, "Point has no field z"},
+		{point + `Point{x: 1, y: 2} with {z: 1}`, "Point has no field z"},
+		{`sup Thing = 5; Thing{x: 1}`, "not a record type: INTEGER"},
+		{`5 with {x: 1}`, "with needs a record, got INTEGER"},
+		{point + `Point{x: 1, y: 2} == 1`, "type mismatch: RECORD == INTEGER"},
+		{point + `Point{x: 1, y: 2} + Point{x: 1, y: 2}`, "unknown operator: RECORD + RECORD"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`match 2 { 1 => "one", 2 => "two", _ => "many" }`, "two"},
+		{`match 7 { 1 => "one", n => n * 2 }`, "14"},
+		{`match -1 { -1 => "minus one", _ => "other" }`, "minus one"},
+		{`match "b" { "a" => 1, "b" => 2 }`, "2"},
+		{`match 1 < 2 { true => "yes", false => "no" }`, "yes"},
+		// literals only match their own type
+		{`match "1" { 1 => "int", _ => "other" }`, "other"},
+		{`match [1, 2, 3] { [] => 0, [x] => x, [x, y, ...rest] => [x + y, rest] }`, "[3, [3]]"},
+		{`match [1, 2] { [a, b, c] => "three", [a, b] => a + b }`, "3"},
+		{`match [1] { [a, ...rest] => rest }`, "[]"},
+		{`match [[1, 2], 3] { [[a, _], b] => a + b }`, "4"},
+		{`match {"kind": "circle", "r": 2} { {"kind": "square", "side": s} => s * s, {"kind": "circle", r} => 3 * r * r }`, "12"},
+		{`match {1: true} { {2: x} => "two", {1: x} => x }`, "true"},
+		{`match 5 { {"k": v} => v, _ => "not a hash" }`, "not a hash"},
+		{`record P { x, y } match (P{x: 1, y: 2}) { {x, y} => x + y }`, "3"},
+		// guards see what the pattern bound
+		{`match 5 { n if n < 0 => "negative", n if n > 3 => "big", _ => "small" }`, "big"},
+		{`match [4, 2] { [a, b] if a < b => "up", [a, b] => "down" }`, "down"},
+		// arms bind in their own frame
+		{`sup x = 1; sup y = match 10 { x => x + 1 }; [x, y]`, "[1, 11]"},
+		{`sup f = bud(xs) { match xs { [a, ...r] => bud() { a + len(r) } } }; f([5, 6, 7])()`, "7"},
+		// in tail position a match does not grow the stack
+		{`sup count = bud(n, acc) { match n { 0 => acc, _ => count(n - 1, acc + 1) } }; count(10000, 0)`, "10000"},
+		{`sup sum = bud(xs, acc) { match xs { [] => acc, [x, ...rest] => sum(rest, acc + x) } }; sum([1, 2, 3, 4], 0)`, "10"},
+	}
+	for _, tt := range tests {
+		if got := inspect(testEval(t, tt.input)); got != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`match 3 { 1 => 1, 2 => 2 }`, "no match for 3"},
+		{`match [1, 2] { [a] => a }`, "no match for [1, 2]"},
+		{`match 1 { x if y => x }`, "identifier not found: y"},
+		{`match missing { _ => 1 }`, "identifier not found: missing"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	input := "sup f = bud(n) {\n  match n { 1 => 1 }\n};\nf(2)"
+	err, ok := testEval(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error for a value no arm matches")
+	}
+	if got := FormatError(input, err); got != "Line 2: no match for 2" {
+		t.Errorf("wrong formatted error. got=%q", got)
+	}
+	if got := FormatError(input, newError("plain")); got != "plain" {
+		t.Errorf("an error without a span got a line. got=%q", got)
+	}
+}
+
+func TestDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sup [a, b] = [1, 2]; a + b`, "3"},
+		{`sup [first, ...rest] = [1, 2, 3]; [first, rest]`, "[1, [2, 3]]"},
+		{`sup [_, second] = ["a", "b"]; second`, "b"},
+		{`sup [[a, b], c] = [[1, 2], 3]; a + b + c`, "6"},
+		{`sup {name, age} = {"name": "bo", "age": 3}; [name, age]`, "[bo, 3]"},
+		{`sup {"pos": [x, y], "id": id} = {"id": 7, "pos": [1, 2]}; [id, x, y]`, "[7, 1, 2]"},
+		{`record P { x, y } sup {x, y} = P{x: 1, y: 2}; x + y`, "3"},
+		{`sup f = bud([a, b]) { a * b }; f([6, 7])`, "42"},
+		{`sup f = bud(n, {k}) { n + k }; f(1, {"k": 2})`, "3"},
+		{`sup f = bud([x, ...xs], acc) { if (len(xs) == 0) { acc + x } else { f(xs, acc + x) } }; f([1, 2, 3, 4], 0)`, "10"},
+		{`sup swap = bud([a, b]) { [b, a] }; swap([1, 2])`, "[2, 1]"},
+		// inside a bud the names are the call's own
+		{`sup a = 1; sup f = bud() { sup [a, b] = [10, 20]; a + b }; [f(), a]`, "[30, 1]"},
+		{`sup pairs = bud(xs) { sup [h, ...t] = xs; bud() { [h, t] } }; pairs([1, 2])()`, "[1, [2]]"},
+	}
+	for _, tt := range tests {
+		if got := inspect(testEval(t, tt.input)); got != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`sup [a, b] = [1, 2, 3];`, "[a, b] needs 2 elements, got 3"},
+		{`sup [a] = [];`, "[a] needs 1 element, got 0"},
+		{`sup [a, b, ...r] = [1];`, "[a, b, ...r] needs at least 2 elements, got 1"},
+		{`sup [a, b] = 5;`, "[a, b] needs an array, got INTEGER"},
+		{`sup [1, b] = [2, 3];`, "expected 1, got 2"},
+		{`sup ["a", b] = [1, 3];`, `expected "a", got 1`},
+		{`sup {name} = {"age": 1};`, `hash has no key "name"`},
+		{`sup {name} = [1];`, `{"name": name} needs a hash or record, got ARRAY`},
+		{`sup {} = 1;`, `{} needs a hash or record, got INTEGER`},
+		{`record P { x } sup {y} = P{x: 1};`, "P has no field y"},
+		{`sup f = bud(a, [b, c]) { b }; f(1, [2])`, "argument 2 to f: [b, c] needs 2 elements, got 1"},
+		{`bud({k}) { k }(5)`, `argument 1 to <anonymous>: {"k": k} needs a hash or record, got INTEGER`},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(t, tt.input), tt.expected)
+	}
+
+	input := "sup xs = [1];\nsup [a, b] = xs;"
+	err, ok := testEval(t, input).(*object.Error)
+	if !ok {
+		t.Fatalf("no error for a pattern that does not fit")
+	}
+	if got := FormatError(input, err); got != "Line 2: [a, b] needs 2 elements, got 1" {
+		t.Errorf("wrong formatted error. got=%q", got)
+	}
+}
+
+func TestInterpolation(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sup name = "bo"; sup age = 3; "hello ${name}, you are ${age + 1}"`, "hello bo, you are 4"},
+		{`"${[1, "a"]} ${true} ${if (false) { 1 }}"`, "[1, a] true null"},
+		{`"${ {"k": 1}["k"] }"`, "1"},
+		{`sup f = bud(n) { "n=${n}" }; "${f(1)}|${f(2)}"`, "n=1|n=2"},
+		{`record P { x } "${P{x: 1}.x}"`, "1"},
+		{`"\${x}"`, "${x}"},
+		{`sup 名前 = "ünï"; sup café = bud(ß) { "${ß} ☃" }; café(名前)`, "ünï ☃"},
+		{`sup x = "a"; "${x}" == "a"`, "true"},
+	}
+	for _, tt := range tests {
+		if got := inspect(testEval(t, tt.input)); got != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+
+	testErrorObject(t, testEval(t, `"a ${1 + true} b"`), "type mismatch: INTEGER + BOOLEAN")
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`format("plain")`, "plain"},
+		{`format("%d + %d = %d", 1, 2, 3)`, "1 + 2 = 3"},
+		{`format("[%5d|%-5d|%05d]", 42, 42, 42)`, "[   42|42   |00042]"},
+		{`format("[%6s|%-6s|%.2s]", "abc", "abc", "abc")`, "[   abc|abc   |ab]"},
+		{`format("%v %v %v", [1, 2], true, "s")`, "[1, 2] true s"},
+		{`format("%8.3v|", [1, 2])`, "     [1,|"},
+		{`format("100%%")`, "100%"},
+	}
+	for _, tt := range tests {
+		if got := inspect(testEval(t, tt.input)); got != tt.expected {
+			t.Errorf("wrong result for %q. got=%s, want=%s", tt.input, got, tt.expected)
+		}
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`format()`, "wrong number of arguments. got=0, want at least 1"},
+		{`format(1)`, "first argument to `format` must be STRING, got INTEGER"},
+		{`format("%d", "a")`, "`format` %d needs INTEGER, got STRING"},
+		{`format("%-3s", 1)`, "`format` %-3s needs STRING, got INTEGER"},
+		{`format("%d %d", 1)`, "`format` is missing an argument for %d"},
+		{`format("%d", 1, 2)`, "`format` got 2 arguments, the format uses 1"},
+		{`format("%x", 1)`, "`format` has no verb %x"},
+		{`format("50%")`, "`format` directive % has no verb"},
+		{`format("%99999d", 1)`, "`format` directive %99999d is wider than 4096"},
+	}
+	for _, tt := range errors {
+		testErrorObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var out strings.Builder
+	input := `sup xs = [1, "a"]; print("xs", xs, {"k": true}); print(); print(len(xs))`
+	result := testEvalUnoptimized(t, input, EvalOptions{Output: &out})
+	if result != NULL {
+		t.Errorf("print returned %s, want null", inspect(result))
+	}
+	if expected := "xs [1, a] {k: true}\n\n2\n"; out.String() != expected {
+		t.Errorf("wrong output. expected=%q, got=%q", expected, out.String())
+	}
+
+	// without an Output it is dropped
+	if result := testEval(t, `print(1); 2`); inspect(result) != "2" {
+		t.Errorf("wrong result without output. got=%s", inspect(result))
+	}
+}
+
+func TestEmptyBlocks(t *testing.T) {
+	// an empty block, or one ending in a statement, is null wherever
+	// its value ends up
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`if (true) {}`, "null"},
+		{`sup f = bud() {}; f()`, "null"},
+		{`sup f = bud() { sup a = 1; }; f()`, "null"},
+		{`if (true) { sup a = 1; }`, "null"},
+		{`if (false) { 1 } else { sup a = 1; }`, "null"},
+		{`sup f = bud() { if (true) { sup a = 1; } }; f()`, "null"},
+		{`if (0) {}.A`, "ERROR: cannot access member A on NULL"},
+		{`if (true) {} + 1`, "ERROR: type mismatch: NULL + INTEGER"},
+		{`-if (true) {}`, "ERROR: unknown operator: -NULL"},
+		{`sup f = bud() {}; f() + 1`, "ERROR: type mismatch: NULL + INTEGER"},
+		{`sup f = bud() {}; f().x`, "ERROR: cannot access member x on NULL"},
+		{`sup f = bud() {}; f()[0]`, "ERROR: index operator not supported: NULL"},
+		{`sup f = bud() {}; {f(): 1}`, "ERROR: unusable as hash key: NULL"},
+		{`sup f = bud() {}; len(f())`, "ERROR: argument to `len` not supported, got NULL"},
+		{`sup f = bud() {}; format("%v", f())`, "null"},
+		{`sup f = bud() {}; print(f())`, "null"},
+		{`sup f = bud() {}; f() == f()`, "true"},
+		{`sup f = bud() {}; [f(), "${f()}"]`, "[null, null]"},
+		{`sup f = bud() {}; match f() { x => x }`, "null"},
+		{`sup f = bud() {}; await(spawn(f))`, "null"},
+	}
+	for _, tt := range tests {
+		if got := inspect(testEval(t, tt.input)); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
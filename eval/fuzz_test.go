@@ -0,0 +1,42 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pro0o/sup-bud/internal/seeds"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/parser"
+)
+
+// evaluation stays inside its limits on any program that parses, it
+// neither panics, which evaluation turns into an error, nor runs past
+// its timeout by more than it takes to notice
+func FuzzEval(f *testing.F) {
+	seeds.Add(f, "eval_test.go", "../parser/parser_test.go", "../lexer/lexer_test.go")
+
+	const timeout = 50 * time.Millisecond
+	f.Fuzz(func(t *testing.T, input string) {
+		p := parser.New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		start := time.Now()
+		result := EvalWithOptions(program, object.NewEnvironment(), EvalOptions{
+			MaxCallDepth: 50,
+			MaxNesting:   200,
+			Timeout:      timeout,
+		})
+		if elapsed := time.Since(start); elapsed > timeout+time.Second {
+			t.Fatalf("%q ran for %v with a timeout of %v", input, elapsed, timeout)
+		}
+		if err, ok := result.(*object.Error); ok && (strings.HasPrefix(err.Message, "Evaluation error: panic") ||
+			strings.HasPrefix(err.Message, "panic in task")) {
+			t.Fatalf("%q: %s", input, err.Message)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+package eval
+
+import "github.com/pro0o/sup-bud/object"
+
+// small integers are shared the same way TRUE, FALSE and NULL are,
+// loop counters, indexes and lengths mostly land in this range.
+const (
+	minCachedInteger = -128
+	maxCachedInteger = 1024
+)
+
+var integerCache = func() []*object.Integer {
+	cache := make([]*object.Integer, maxCachedInteger-minCachedInteger+1)
+	for i := range cache {
+		cache[i] = &object.Integer{Value: int64(i + minCachedInteger)}
+	}
+	return cache
+}()
+
+// NewInteger returns the shared instance for small values and a fresh
+// one otherwise, so integers must never be compared by pointer.
+func NewInteger(value int64) *object.Integer {
+	if value >= minCachedInteger && value <= maxCachedInteger {
+		return integerCache[value-minCachedInteger]
+	}
+	return &object.Integer{Value: value}
+}
@@ -0,0 +1,44 @@
+package eval
+
+import "testing"
+
+func TestIntegerEquality(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"5 == 5", true},
+		{"100000 == 100000", true},
+		{"100000 == 99999 + 1", true},
+		{"-100000 != 0 - 100000", false},
+		{"sup a = 5000 * 2; sup b = 10000; a == b", true},
+		{"sup f = bud(x) { x }; f(2048) == 2048", true},
+		{"len([1, 2, 3]) == 3", true},
+		{"[1][0] == [1][0]", true},
+		{"sup a = [1]; a == a", true},
+		{"[1] == [1]", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated != nativeBoolToBooleanObject(tt.expected) {
+			t.Errorf("%q: expected %t, got %s", tt.input, tt.expected, inspect(evaluated))
+		}
+	}
+}
+
+func TestNewIntegerSharesSmallValues(t *testing.T) {
+	for _, v := range []int64{minCachedInteger, -1, 0, 1, maxCachedInteger} {
+		if NewInteger(v) != NewInteger(v) {
+			t.Errorf("NewInteger(%d) is not shared", v)
+		}
+		if NewInteger(v).Value != v {
+			t.Errorf("NewInteger(%d) has value %d", v, NewInteger(v).Value)
+		}
+	}
+	for _, v := range []int64{minCachedInteger - 1, maxCachedInteger + 1} {
+		if NewInteger(v) == NewInteger(v) {
+			t.Errorf("NewInteger(%d) is shared", v)
+		}
+	}
+}
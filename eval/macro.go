@@ -0,0 +1,318 @@
+package eval
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/token"
+)
+
+// macros are expanded in a pass of their own before the program runs.
+//
+//	sup unless = macro(cond, then, otherwise) {
+//		quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) })
+//	};
+//
+// a sup of a macro at the top level defines it and is taken out of
+// the program. every call of it is then replaced by the quote its body
+// returns, with the arguments passed in unevaluated, as quotes.
+//
+// expansions are hygienic: names the macro binds itself, in a sup, a
+// bud parameter or a select case, are renamed to ones no script can
+// write. so they neither capture names in the arguments nor clobber
+// those of the code around the call. what counts as the macro's own is
+// everything from inside its literal, renaming goes by name within one
+// expansion, so a macro should not bind a name it also uses to mean
+// something from outside.
+
+// how deep expansions may produce further macro calls
+const maxMacroExpansionDepth = 100
+
+// numbers renamed bindings, shared so names stay unique across runs
+// on the same environment
+var gensym int64
+
+// defines the macros program binds at the top level in env and
+// returns a copy of program without them and all calls expanded.
+// program is returned as is when there is nothing to expand.
+func (e *evaluator) expandMacros(program *ast.Program, env *object.Environment) (*ast.Program, *object.Error) {
+	var statements []ast.Statement
+	defined := false
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || let.Name == nil {
+			statements = append(statements, stmt)
+			continue
+		}
+		lit, ok := let.Value.(*ast.MacroLiteral)
+		if !ok {
+			statements = append(statements, stmt)
+			continue
+		}
+		env.Set(let.Name.Value, &object.Macro{
+			Name:       let.Name.Value,
+			Parameters: lit.Parameters,
+			Body:       lit.Body,
+			Env:        env,
+			Span:       ast.SpanOf(lit),
+		})
+		defined = true
+	}
+	if !defined && !hasMacros(env) {
+		return program, nil
+	}
+
+	expanded, err := e.expandNode(&ast.Program{Statements: statements}, env, 0)
+	if err != nil {
+		return nil, err
+	}
+	return expanded.(*ast.Program), nil
+}
+
+// whether env or one it is enclosed in binds a macro, a REPL keeps
+// the ones of earlier lines
+func hasMacros(env *object.Environment) bool {
+	for ; env != nil; env = env.Outer() {
+		for _, val := range env.Bindings() {
+			if _, ok := val.(*object.Macro); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (e *evaluator) expandNode(node ast.Node, env *object.Environment, level int) (ast.Node, *object.Error) {
+	var err *object.Error
+	expanded := ast.Modify(node, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return node
+		}
+		name, ok := call.Function.(*ast.Identifier)
+		if !ok {
+			return node
+		}
+		val, ok := env.Get(name.Value)
+		if !ok {
+			return node
+		}
+		macro, ok := val.(*object.Macro)
+		if !ok {
+			return node
+		}
+		if level >= maxMacroExpansionDepth {
+			err = newError("macro %s: expansion nested more than %d deep", macro.Name, maxMacroExpansionDepth)
+			return node
+		}
+
+		var result ast.Node
+		result, err = e.expandCall(macro, call)
+		if err != nil {
+			return node
+		}
+		// what the macro returned may call macros in turn
+		result, err = e.expandNode(result, env, level+1)
+		if err != nil {
+			return node
+		}
+		return result
+	})
+	return expanded, err
+}
+
+func (e *evaluator) expandCall(macro *object.Macro, call *ast.CallExpression) (ast.Node, *object.Error) {
+	if len(call.Arguments) != len(macro.Parameters) {
+		return nil, newError("wrong number of arguments to macro %s: want=%d, got=%d",
+			macro.Name, len(macro.Parameters), len(call.Arguments))
+	}
+	args := make([]object.Object, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		args[i] = &object.Quote{Node: arg}
+	}
+
+	// run like a bud, so returns, tail calls and the limits work
+	bud := &object.Function{Name: macro.Name, Parameters: macro.Parameters, Body: macro.Body, Env: macro.Env}
+	result := e.applyFunctionWithDepthTracking(bud, args, e.opts.initialDepth())
+	if errObj, ok := result.(*object.Error); ok {
+		return nil, newError("macro %s: %s", macro.Name, errObj.Message)
+	}
+	quote, ok := result.(*object.Quote)
+	if !ok {
+		return nil, newError("macro %s has to return a quote, got %s", macro.Name, typeName(result))
+	}
+	return hygienic(quote.Node, macro.Span), nil
+}
+
+func typeName(obj object.Object) object.ObjectType {
+	if obj == nil {
+		return NULL.Type()
+	}
+	return obj.Type()
+}
+
+// renames the bindings node makes with names from inside span, and
+// the references to them from inside span
+func hygienic(node ast.Node, span ast.Span) ast.Node {
+	own := func(id *ast.Identifier) bool {
+		return id != nil && span.Start <= id.Token.Position && id.Token.Position < span.End
+	}
+
+	renamed := make(map[string]string)
+	rename := func(id *ast.Identifier) {
+		if own(id) {
+			if _, ok := renamed[id.Value]; !ok {
+				renamed[id.Value] = fmt.Sprintf("%s#%d", id.Value, atomic.AddInt64(&gensym, 1))
+			}
+		}
+	}
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			rename(node.Name)
+		case *ast.DestructureStatement:
+			for _, name := range ast.Bindings(node.Pattern) {
+				rename(name)
+			}
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				rename(param)
+			}
+			for _, pattern := range node.Patterns {
+				if pattern != nil {
+					for _, name := range ast.Bindings(pattern) {
+						rename(name)
+					}
+				}
+			}
+		case *ast.SelectCase:
+			rename(node.Binding)
+		case *ast.MatchArm:
+			for _, name := range ast.Bindings(node.Pattern) {
+				rename(name)
+			}
+		}
+		return true
+	})
+	if len(renamed) == 0 {
+		return node
+	}
+
+	original := make(map[string]string, len(renamed))
+	for name, fresh := range renamed {
+		original[fresh] = name
+	}
+	// m.name and record fields name no binding, undo the rename
+	restore := func(ids ...*ast.Identifier) {
+		for _, id := range ids {
+			if name, ok := original[id.Value]; ok {
+				id.Value = name
+			}
+		}
+	}
+	return ast.Modify(node, func(node ast.Node) ast.Node {
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if fresh, ok := renamed[node.Value]; ok && own(node) {
+				node.Value = fresh
+			}
+		case *ast.MemberExpression:
+			restore(node.Member)
+		case *ast.RecordDefinition:
+			restore(node.Fields...)
+			for _, method := range node.Methods {
+				restore(method.Name)
+			}
+		case *ast.RecordLiteral:
+			restore(node.Fields...)
+		case *ast.WithExpression:
+			restore(node.Fields...)
+		}
+		return node
+	})
+}
+
+// quote(expr) evaluates to expr itself, with every unquote(x) in it
+// replaced by the value of x
+func (e *evaluator) quote(call *ast.CallExpression, env *object.Environment, maxDepth int) object.Object {
+	if len(call.Arguments) != 1 {
+		return newError("wrong number of arguments to quote: want=1, got=%d", len(call.Arguments))
+	}
+
+	var err object.Object
+	node := ast.Modify(call.Arguments[0], func(node ast.Node) ast.Node {
+		unquote, ok := node.(*ast.CallExpression)
+		if err != nil || !ok || !isSpecialCall(unquote, "unquote") {
+			return node
+		}
+		if len(unquote.Arguments) != 1 {
+			err = newError("wrong number of arguments to unquote: want=1, got=%d", len(unquote.Arguments))
+			return node
+		}
+		val := e.evalWithDepthTracking(unquote.Arguments[0], env, maxDepth-1)
+		if isError(val) {
+			err = val
+			return node
+		}
+		converted, convErr := objectToNode(val, unquote.Token.Position)
+		if convErr != nil {
+			err = convErr
+			return node
+		}
+		return converted
+	})
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: node}
+}
+
+// quote(...) and unquote(...), which take their argument unevaluated
+func isSpecialCall(call *ast.CallExpression, name string) bool {
+	id, ok := call.Function.(*ast.Identifier)
+	return ok && id.Value == name
+}
+
+// the code that evaluates to obj, for splicing it into a quote
+func objectToNode(obj object.Object, position int) (ast.Node, *object.Error) {
+	switch obj := obj.(type) {
+	case *object.Quote:
+		return obj.Node, nil
+	case *object.Integer:
+		return &ast.IntegerLiteral{
+			Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(obj.Value, 10), Position: position},
+			Value: obj.Value,
+		}, nil
+	case *object.Boolean:
+		tok := token.Token{Type: token.FALSE, Literal: "false", Position: position}
+		if obj.Value {
+			tok = token.Token{Type: token.TRUE, Literal: "true", Position: position}
+		}
+		return &ast.Boolean{Token: tok, Value: obj.Value}, nil
+	case *object.String:
+		return &ast.StringLiteral{
+			Token: token.Token{Type: token.STRING, Literal: obj.Value, Position: position},
+			Value: obj.Value,
+		}, nil
+	case *object.Array:
+		array := &ast.ArrayLiteral{
+			Token:    token.Token{Type: token.LBRACKET, Literal: "[", Position: position},
+			Elements: make([]ast.Expression, len(obj.Elements)),
+		}
+		for i, el := range obj.Elements {
+			node, err := objectToNode(el, position)
+			if err != nil {
+				return nil, err
+			}
+			array.Elements[i] = node.(ast.Expression)
+		}
+		return array, nil
+	}
+	return nil, newError("cannot unquote %s into code", typeName(obj))
+}
@@ -0,0 +1,158 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/pro0o/sup-bud/object"
+)
+
+func TestQuoteUnquote(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`quote(5)`, `5`},
+		{`quote(5 + 8)`, `(5 + 8)`},
+		{`sup foobar = 8; quote(foobar)`, `foobar`},
+		{`quote(unquote(4 + 4))`, `8`},
+		{`quote(8 + unquote(4 + 4))`, `(8 + 8)`},
+		{`quote(unquote(4 + 4) + 8)`, `(8 + 8)`},
+		{`sup foobar = 8; quote(unquote(foobar))`, `8`},
+		{`quote(unquote(true == false))`, `false`},
+		{`quote(unquote("sup" + "bud"))`, `"supbud"`},
+		{`quote(unquote([1, 2 * 2]))`, `[1, 4]`},
+		{`quote(unquote(quote(4 + 4)))`, `(4 + 4)`},
+		{`sup q = quote(4 + 4); quote(unquote(4 + 4) + unquote(q))`, `(8 + (4 + 4))`},
+	}
+
+	for _, tt := range tests {
+		quote, ok := testEval(t, tt.input).(*object.Quote)
+		if !ok {
+			t.Errorf("%q did not evaluate to a quote", tt.input)
+			continue
+		}
+		if quote.Node.String() != tt.expected {
+			t.Errorf("wrong quote for %q. expected=%q, got=%q", tt.input, tt.expected, quote.Node.String())
+		}
+	}
+
+	testErrorObject(t, testEval(t, `quote(unquote(bud() { 1 }))`), "cannot unquote FUNCTION into code")
+	testErrorObject(t, testEval(t, `quote(1, 2)`), "wrong number of arguments to quote: want=1, got=2")
+}
+
+func TestMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+		sup unless = macro(cond, then, otherwise) {
+			quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) })
+		};
+		unless(10 > 5, 1, 2)`, 2},
+		// the branch not taken is never evaluated
+		{`
+		sup unless = macro(cond, then, otherwise) {
+			quote(if (!(unquote(cond))) { unquote(then) } else { unquote(otherwise) })
+		};
+		unless(false, 1, 1 / 0)`, 1},
+		// macros run code at expansion time
+		{`
+		sup thrice = macro(body) {
+			sup go = bud(i, acc) {
+				if (i == 0) { acc } else { go(i - 1, quote(unquote(acc) + unquote(body))) }
+			};
+			go(2, body)
+		};
+		thrice(7)`, 21},
+		// expansions can call macros again
+		{`
+		sup twice = macro(x) { quote(unquote(x) + unquote(x)) };
+		sup quad = macro(x) { quote(twice(twice(unquote(x)))) };
+		quad(3)`, 12},
+		// and use what the program defines
+		{`
+		sup double = bud(x) { x * 2 };
+		sup apply = macro(x) { quote(double(unquote(x))) };
+		sup f = bud(y) { apply(y + 1) };
+		f(4)`, 10},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestMacroHygiene(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// the macro's tmp does not capture the caller's
+		{`
+		sup swap = macro(a, b) { quote(bud(tmp) { [unquote(b), tmp] }(unquote(a))) };
+		sup tmp = 1;
+		swap(10, tmp)[0]`, 1},
+		// nor does its sup clobber the caller's
+		{`
+		sup max = macro(a, b) {
+			quote(if (true) { sup x = unquote(a); sup y = unquote(b); if (x > y) { x } else { y } })
+		};
+		sup f = bud() { sup x = 100; max(1, 2) + x };
+		f()`, 102},
+		{`
+		sup double = macro(a) { quote(bud() { sup x = 2; x * unquote(a) }()) };
+		sup x = 3;
+		double(x)`, 6},
+		// record fields and methods name no binding, they keep their names
+		{`
+		sup twice = macro(v) {
+			quote(bud() { sup x = 0; record R { x; sup double = bud() { self.x * 2 } } R{x: unquote(v)}.double() + x }())
+		};
+		sup x = 21;
+		twice(x)`, 42},
+		// names a pattern binds are the macro's own too
+		{`
+		sup first = macro(xs, other) { quote(match unquote(xs) { [h, ...t] => h + unquote(other), _ => 0 }) };
+		sup h = 100;
+		first([1, 2], h)`, 101},
+		{`
+		sup pairsum = macro(xs, other) { quote(bud([a, b]) { a + b + unquote(other) }(unquote(xs))) };
+		sup a = 100;
+		pairsum([1, 2], a)`, 103},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`sup m = macro(a) { quote(unquote(a)) }; m(1, 2)`,
+			"wrong number of arguments to macro m: want=1, got=2"},
+		{`sup m = macro(a) { 5 }; m(1)`, "macro m has to return a quote, got INTEGER"},
+		{`sup m = macro(a) { 1 / 0 }; m(1)`, "macro m: division by zero: 1 / 0"},
+		{`sup m = macro(a) { quote(m(unquote(a))) }; m(1)`,
+			"macro m: expansion nested more than 100 deep"},
+		{`sup f = bud() { sup m = macro() { quote(1) }; m() }; f()`,
+			"a macro can only be bound by a sup at the top level"},
+	}
+	for _, tt := range tests {
+		testErrorObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+// the program is left alone, evaluating it again expands it again
+func TestMacroProgramReuse(t *testing.T) {
+	input := `sup twice = macro(x) { quote(unquote(x) * 2) }; twice(21)`
+	program := parseProgram(t, input)
+	before := program.String()
+	for i := 0; i < 2; i++ {
+		testIntegerObject(t, EvalWithOptions(program, object.NewEnvironment(), EvalOptions{}), 42)
+	}
+	if program.String() != before {
+		t.Errorf("expansion changed the program. before=%q, after=%q", before, program.String())
+	}
+}
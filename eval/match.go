@@ -0,0 +1,177 @@
+package eval
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+// match value { pattern if guard => body, ... } takes the first arm
+// whose pattern matches and whose guard holds. in tail position the
+// body is too.
+func (e *evaluator) evalMatchExpression(
+	node *ast.MatchExpression,
+	env *object.Environment,
+	maxDepth int,
+	tail bool,
+) object.Object {
+	subject := e.evalWithDepthTracking(node.Subject, env, maxDepth-1)
+	if isError(subject) {
+		return subject
+	}
+
+	for _, arm := range node.Arms {
+		armEnv := env
+		if arm.Scope != nil {
+			armEnv = object.NewFrame(arm.Scope, env)
+		} else if len(ast.Bindings(arm.Pattern)) > 0 {
+			armEnv = object.NewEnclosedEnvironment(env)
+		}
+		if !e.matchPattern(arm.Pattern, subject, armEnv) {
+			continue
+		}
+		if arm.Guard != nil {
+			guard := e.evalWithDepthTracking(arm.Guard, armEnv, maxDepth-1)
+			if isError(guard) {
+				return guard
+			}
+			if !isTruthy(guard) {
+				continue
+			}
+		}
+		if tail {
+			return e.evalTailExpression(arm.Body, armEnv, maxDepth-1)
+		}
+		return e.evalWithDepthTracking(arm.Body, armEnv, maxDepth-1)
+	}
+
+	err := newError("no match for %s", subject.Inspect())
+	err.Span = ast.SpanOf(node)
+	return err
+}
+
+// whether val has the shape of pattern, binding the names in it to
+// the parts of val in env as it goes
+func (e *evaluator) matchPattern(pattern ast.Pattern, val object.Object, env *object.Environment) bool {
+	return e.destructure(pattern, val, env) == nil
+}
+
+// binds the names in pattern to the parts of val in env, or says
+// where val does not have the shape of pattern. sup [a, b] = xs and
+// bud([a, b]) { ... } take their values apart with it.
+func (e *evaluator) destructure(pattern ast.Pattern, val object.Object, env *object.Environment) *object.Error {
+	fail := func(format string, a ...interface{}) *object.Error {
+		err := newError(format, a...)
+		err.Span = ast.SpanOf(pattern)
+		return err
+	}
+
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			e.bind(env, pattern, val)
+		}
+		return nil
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.Boolean:
+		if !objectsEqual(literalObject(pattern), val) {
+			return fail("expected %s, got %s", pattern, describe(val))
+		}
+		return nil
+	case *ast.ArrayPattern:
+		arr, ok := val.(*object.Array)
+		if !ok {
+			return fail("%s needs an array, got %s", pattern, typeName(val))
+		}
+		want := len(pattern.Elements)
+		if pattern.Rest == nil && len(arr.Elements) != want {
+			return fail("%s needs %s, got %d", pattern, elements(want), len(arr.Elements))
+		}
+		if len(arr.Elements) < want {
+			return fail("%s needs at least %s, got %d", pattern, elements(want), len(arr.Elements))
+		}
+		for i, el := range pattern.Elements {
+			if err := e.destructure(el, arr.Elements[i], env); err != nil {
+				return err
+			}
+		}
+		if pattern.Rest != nil {
+			rest := append([]object.Object{}, arr.Elements[want:]...)
+			e.bind(env, pattern.Rest, &object.Array{Elements: rest})
+		}
+		return nil
+	case *ast.HashPattern:
+		for i, key := range pattern.Keys {
+			var part object.Object
+			switch val := val.(type) {
+			case *object.Hash:
+				pair, ok := val.Pairs[literalObject(key).(object.Hashable).HashKey()]
+				if !ok {
+					return fail("hash has no key %s", key)
+				}
+				part = pair.Value
+			case *object.Record:
+				field := -1
+				if name, ok := key.(*ast.StringLiteral); ok {
+					field = val.Def.Field(name.Value)
+				}
+				if field < 0 {
+					return fail("%s has no field %s", val.Def.Name, literalObject(key).Inspect())
+				}
+				part = val.Values[field]
+			default:
+				return fail("%s needs a hash or record, got %s", pattern, typeName(val))
+			}
+			if err := e.destructure(pattern.Values[i], part, env); err != nil {
+				return err
+			}
+		}
+		if val == nil || (val.Type() != object.HASH_OBJ && val.Type() != object.RECORD_OBJ) {
+			return fail("%s needs a hash or record, got %s", pattern, typeName(val))
+		}
+		return nil
+	}
+	return fail("cannot match %s", pattern)
+}
+
+// the value a literal pattern or hash pattern key stands for
+func literalObject(lit ast.Node) object.Object {
+	switch lit := lit.(type) {
+	case *ast.IntegerLiteral:
+		return NewInteger(lit.Value)
+	case *ast.StringLiteral:
+		return &object.String{Value: lit.Value}
+	case *ast.Boolean:
+		return nativeBoolToBooleanObject(lit.Value)
+	}
+	return NULL
+}
+
+// a value in an error, small ones as they are and the rest by type
+func describe(val object.Object) string {
+	switch val := val.(type) {
+	case *object.Integer, *object.Boolean:
+		return val.Inspect()
+	case *object.String:
+		return fmt.Sprintf("%q", val.Value)
+	}
+	return string(typeName(val))
+}
+
+func elements(n int) string {
+	if n == 1 {
+		return "1 element"
+	}
+	return fmt.Sprintf("%d elements", n)
+}
+
+// FormatError is the message of err, after the line it happened on
+// in src when the error knows where that is.
+func FormatError(src string, err *object.Error) string {
+	if err.Span.End <= err.Span.Start || err.Span.Start > len(src) {
+		return err.Message
+	}
+	line := strings.Count(src[:err.Span.Start], "\n") + 1
+	return fmt.Sprintf("Line %d: %s", line, err.Message)
+}
@@ -0,0 +1,137 @@
+package eval
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/parser"
+	"github.com/pro0o/sup-bud/typecheck"
+)
+
+// FileSystem is where the module loader reads sources from,
+// the wasm build hands in a MapFS while native builds use a DirFS.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+// in-memory FileSystem keyed by slash separated paths
+type MapFS map[string]string
+
+func (m MapFS) ReadFile(name string) ([]byte, error) {
+	src, ok := m[name]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return []byte(src), nil
+}
+
+// FileSystem rooted at a directory on disk
+type DirFS string
+
+func (d DirFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(name)))
+}
+
+// ModuleLoader evaluates each imported module once and hands out
+// the cached exports on later imports.
+type ModuleLoader struct {
+	fs      FileSystem
+	cache   map[string]*object.Module
+	loading []string // import chain currently being evaluated
+}
+
+func NewModuleLoader(fsys FileSystem) *ModuleLoader {
+	return &ModuleLoader{
+		fs:    fsys,
+		cache: make(map[string]*object.Module),
+	}
+}
+
+// import paths are relative to the importing module,
+// a leading slash makes them relative to the loader root.
+func resolveModulePath(from, name string) (string, error) {
+	var resolved string
+	if strings.HasPrefix(name, "/") {
+		resolved = path.Clean(strings.TrimPrefix(name, "/"))
+	} else {
+		resolved = path.Join(path.Dir(from), name)
+	}
+	if resolved == ".." || strings.HasPrefix(resolved, "../") {
+		return "", fmt.Errorf("path escapes the module root")
+	}
+	return resolved, nil
+}
+
+func (e *evaluator) importModule(node *ast.ImportStatement, maxDepth int) object.Object {
+	loader := e.opts.Loader
+	if loader == nil {
+		return newError("cannot import %q: no module loader configured", node.Path.Value)
+	}
+
+	name, err := resolveModulePath(e.path, node.Path.Value)
+	if err != nil {
+		return newError("cannot import %q: %v", node.Path.Value, err)
+	}
+
+	if module, ok := loader.cache[name]; ok {
+		return module
+	}
+
+	for i, loading := range loader.loading {
+		if loading == name {
+			chain := append(append([]string{}, loader.loading[i:]...), name)
+			return newError("import cycle: %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	src, err := loader.fs.ReadFile(name)
+	if err != nil {
+		return newError("cannot import %q: %v", name, err)
+	}
+
+	l := lexer.New(string(src))
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return newError("module %q: %s", name, strings.Join(p.Errors(), "; "))
+	}
+	if typecheck.Annotated(program) {
+		if errs := typecheck.Check(program); len(errs) != 0 {
+			return newError("module %q: %s", name, strings.Join(typecheck.Messages(string(src), errs), "; "))
+		}
+	}
+
+	loader.loading = append(loader.loading, name)
+	defer func() { loader.loading = loader.loading[:len(loader.loading)-1] }()
+
+	child := *e
+	child.path = name
+	child.exports = nil
+	env := object.NewEnvironment()
+	program, errObj := child.expandMacros(program, env)
+	if errObj != nil {
+		return newError("module %q: %s", name, errObj.Message)
+	}
+	resolve(program)
+	result := child.evalWithDepthTracking(program, env, maxDepth-1)
+	if errObj, ok := result.(*object.Error); ok {
+		// keeps the chain readable, outer modules prefix their own name
+		return newError("module %q: %s", name, errObj.Message)
+	}
+
+	module := &object.Module{Path: name, Exports: make(map[string]object.Object)}
+	for _, export := range child.exports {
+		if val, ok := env.Get(export); ok {
+			module.Exports[export] = val
+		}
+	}
+	loader.cache[name] = module
+	return module
+}
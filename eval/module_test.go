@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/parser"
+)
+
+func testEvalModules(t *testing.T, input string, files MapFS) object.Object {
+	t.Helper()
+	l := lexer.New(input)
+	p := parser.New(l)
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	opts := EvalOptions{
+		MaxCallDepth: 200,
+		Timeout:      time.Second,
+		Loader:       NewModuleLoader(files),
+	}
+	return EvalWithOptions(program, object.NewEnvironment(), opts)
+}
+
+func TestImportExport(t *testing.T) {
+	files := MapFS{
+		"lib/math.sb": `
+			import "consts.sb" as c;
+			export sup add = bud(a, b) { a + b };
+			export sup ten = c.five * 2;
+			sup hidden = 1;`,
+		"lib/consts.sb": `export sup five = 5;`,
+		"lib/shapes.sb": `
+			sup unit = 1;
+			export record Square { side; sup area = bud() { self.side * self.side * unit } }`,
+	}
+
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`import "lib/math.sb" as m; m.add(1, 2)`, 3},
+		{`import "lib/math.sb" as m; m.ten`, 10},
+		{`import "lib/consts.sb" as c; c.five`, 5},
+		{`import "lib/shapes.sb" as s; s.Square{side: 4}.area()`, 16},
+		{`import "lib/shapes.sb" as s; sup sq = s.Square{side: 2}; (sq with {side: 3}).side`, 3},
+	}
+	for _, tt := range tests {
+		result := testEvalModules(t, tt.input, files)
+		integer, ok := result.(*object.Integer)
+		if !ok {
+			t.Fatalf("object is not Integer. got=%T (%+v)", result, result)
+		}
+		if integer.Value != tt.expected {
+			t.Errorf("object has wrong value. got=%d, want=%d", integer.Value, tt.expected)
+		}
+	}
+}
+
+func TestModulesAreCached(t *testing.T) {
+	files := MapFS{"a.sb": `export sup f = bud() { 1 };`}
+	result := testEvalModules(t, `import "a.sb" as x; import "a.sb" as y; x.f == y.f`, files)
+	if result != TRUE {
+		t.Fatalf("expected both imports to share one evaluation. got=%s", result.Inspect())
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	files := MapFS{
+		"a.sb":      `import "b.sb" as b; export sup x = 1;`,
+		"b.sb":      `import "a.sb" as a; export sup y = 2;`,
+		"lib.sb":    `sup secret = 1;`,
+		"broken.sb": `export sup z = nope;`,
+		"typed.sb":  "export sup n: int = 1;\nexport sup s: string = n;",
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "a.sb" as a;`, `module "a.sb": module "b.sb": import cycle: a.sb -> b.sb -> a.sb`},
+		{`import "lib.sb" as l; l.secret`, `module "lib.sb" has no export named secret`},
+		{`import "broken.sb" as b;`, `module "broken.sb": identifier not found: nope`},
+		{`import "typed.sb" as t;`, `module "typed.sb": Line 2: sup s is declared string, got int`},
+		{`import "missing.sb" as m;`, `cannot import "missing.sb"`},
+		{`import "../up.sb" as m;`, `path escapes the module root`},
+	}
+	for _, tt := range tests {
+		result := testEvalModules(t, tt.input, files)
+		errObj, ok := result.(*object.Error)
+		if !ok {
+			t.Fatalf("no error object returned for %q. got=%T (%+v)", tt.input, result, result)
+		}
+		if !strings.Contains(errObj.Message, tt.expected) {
+			t.Errorf("wrong error message. expected to contain %q, got=%q",
+				tt.expected, errObj.Message)
+		}
+	}
+}
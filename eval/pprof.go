@@ -0,0 +1,193 @@
+package eval
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+)
+
+// WritePprof writes the profile in the gzipped protobuf format go tool
+// pprof reads. every sup-bud function becomes a pprof function and
+// location, samples carry the call count and self time of one stack.
+//
+//	go tool pprof -top profile.pb.gz
+func (p *Profile) WritePprof(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(p.encodePprof()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// field numbers from github.com/google/pprof/proto/profile.proto
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	locationID   = 1
+	locationLine = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+	functionStartLine  = 5
+)
+
+func (p *Profile) encodePprof() []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	strs := map[string]int{"": 0}
+	table := []string{""}
+	str := func(s string) uint64 {
+		if i, ok := strs[s]; ok {
+			return uint64(i)
+		}
+		strs[s] = len(table)
+		table = append(table, s)
+		return uint64(len(table) - 1)
+	}
+
+	var out protobuf
+	valueType := func(field int, typ, unit string) {
+		var vt protobuf
+		vt.uint(valueTypeType, str(typ))
+		vt.uint(valueTypeUnit, str(unit))
+		out.message(field, vt)
+	}
+	valueType(profileSampleType, "calls", "count")
+	valueType(profileSampleType, "time", "nanoseconds")
+
+	// stable ids, ordered by name
+	names := make([]string, 0, len(p.functions))
+	for name := range p.functions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	ids := make(map[string]uint64, len(names))
+	for i, name := range names {
+		ids[name] = uint64(i + 1)
+	}
+
+	keys := make([]string, 0, len(p.stacks))
+	for key := range p.stacks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := p.stacks[key]
+		var sample protobuf
+		locations := make([]uint64, len(s.stack))
+		for i, name := range s.stack {
+			locations[i] = ids[name]
+		}
+		sample.packedUints(sampleLocationID, locations)
+		sample.packedInts(sampleValue, []int64{int64(s.calls), int64(s.self)})
+		out.message(profileSample, sample)
+	}
+
+	for _, name := range names {
+		line := int64(p.lines[name])
+
+		var l protobuf
+		l.uint(lineFunctionID, ids[name])
+		l.int(lineLine, line)
+		var loc protobuf
+		loc.uint(locationID, ids[name])
+		loc.message(locationLine, l)
+		out.message(profileLocation, loc)
+
+		var fn protobuf
+		fn.uint(functionID, ids[name])
+		fn.uint(functionName, str(name))
+		fn.uint(functionSystemName, str(name))
+		fn.uint(functionFilename, str(p.file))
+		fn.int(functionStartLine, line)
+		out.message(profileFunction, fn)
+	}
+
+	valueType(profilePeriodType, "time", "nanoseconds")
+	out.int(profilePeriod, 1)
+	if !p.start.IsZero() {
+		out.int(profileTimeNanos, p.start.UnixNano())
+	}
+	out.int(profileDurationNanos, int64(p.duration))
+
+	// last, everything above has added its strings by now
+	for _, s := range table {
+		out.bytes(profileStringTable, []byte(s))
+	}
+	return out.buf
+}
+
+// just enough of the protobuf wire format for a pprof profile
+type protobuf struct {
+	buf []byte
+}
+
+func (b *protobuf) varint(v uint64) {
+	for v >= 0x80 {
+		b.buf = append(b.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	b.buf = append(b.buf, byte(v))
+}
+
+func (b *protobuf) key(field, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b *protobuf) uint(field int, v uint64) {
+	if v == 0 {
+		return // zero is the default, proto3 leaves it out
+	}
+	b.key(field, 0)
+	b.varint(v)
+}
+
+func (b *protobuf) int(field int, v int64) {
+	b.uint(field, uint64(v))
+}
+
+func (b *protobuf) bytes(field int, v []byte) {
+	b.key(field, 2)
+	b.varint(uint64(len(v)))
+	b.buf = append(b.buf, v...)
+}
+
+func (b *protobuf) message(field int, m protobuf) {
+	b.bytes(field, m.buf)
+}
+
+func (b *protobuf) packedUints(field int, vs []uint64) {
+	var packed protobuf
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	b.bytes(field, packed.buf)
+}
+
+func (b *protobuf) packedInts(field int, vs []int64) {
+	var packed protobuf
+	for _, v := range vs {
+		packed.varint(uint64(v))
+	}
+	b.bytes(field, packed.buf)
+}
@@ -0,0 +1,242 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+// Profile counts calls and time per function and how often each kind
+// of node is evaluated. set it as EvalOptions.Profile, then write it
+// out with WriteText or WritePprof once evaluation is done.
+//
+// functions are keyed by the sup that named them, anonymous buds by
+// where their literal is, bud@line:column. builtins by their name.
+// every call is timed, so this is exact rather than sampled, but the
+// timing itself slows evaluation down.
+//
+// a chain of tail calls keeps the bud it started from on the stack,
+// with the callee of the latest tail call above it, so the first bud's
+// cumulative time covers the whole chain. the buds in between end
+// their frame when they make their tail call.
+type Profile struct {
+	file   string
+	src    string
+	starts []int // byte offset every source line starts at
+
+	mu        sync.Mutex // spawned tasks report into the same profile
+	start     time.Time
+	duration  time.Duration
+	functions map[string]*FunctionProfile
+	lines     map[string]int // where each bud was defined
+	nodes     map[reflect.Type]int
+	stacks    map[string]*stackSample
+}
+
+type FunctionProfile struct {
+	Name  string
+	Calls int
+	Self  time.Duration // spent in the function itself
+	Cum   time.Duration // including the calls it makes
+}
+
+// time spent with exactly this stack, the leaf being the function
+// the time is self time of. this is what pprof gets.
+type stackSample struct {
+	stack []string // leaf first
+	calls int
+	self  time.Duration
+}
+
+// NewProfile profiles the script in file with source src, both only
+// name anonymous buds and may be empty.
+func NewProfile(file, src string) *Profile {
+	starts := []int{0}
+	for i := 0; i < len(src); i++ {
+		if src[i] == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return &Profile{
+		file:      file,
+		src:       src,
+		starts:    starts,
+		functions: make(map[string]*FunctionProfile),
+		lines:     make(map[string]int),
+		nodes:     make(map[reflect.Type]int),
+		stacks:    make(map[string]*stackSample),
+	}
+}
+
+// per evaluator, each task has its own call stack
+type profiler struct {
+	frames []profileFrame
+	active map[string]int // frames per function, so recursion is not counted twice in Cum
+}
+
+type profileFrame struct {
+	name     string
+	start    time.Time
+	children time.Duration
+}
+
+func newProfiler() *profiler {
+	return &profiler{active: make(map[string]int)}
+}
+
+func (p *Profile) functionName(fn object.Object) string {
+	switch fn := fn.(type) {
+	case *object.Function:
+		line := sort.SearchInts(p.starts, fn.Position+1)
+		name := fn.Name
+		if name == "" {
+			column := fn.Position - p.starts[line-1] + 1
+			if fn.Position <= len(p.src) {
+				// in runes, like the lexer counts columns
+				column = utf8.RuneCountInString(p.src[p.starts[line-1]:fn.Position]) + 1
+			}
+			name = fmt.Sprintf("bud@%d:%d", line, column)
+		}
+		p.mu.Lock()
+		if _, ok := p.lines[name]; !ok {
+			p.lines[name] = line
+		}
+		p.mu.Unlock()
+		return name
+	case *object.Builtin:
+		return fn.Name
+	}
+	return "?"
+}
+
+// times an evaluation, call the returned func when it is done
+func (p *Profile) run() func() {
+	start := time.Now()
+	p.mu.Lock()
+	if p.start.IsZero() {
+		p.start = start
+	}
+	p.mu.Unlock()
+	return func() {
+		p.mu.Lock()
+		p.duration += time.Since(start)
+		p.mu.Unlock()
+	}
+}
+
+func (p *Profile) hit(node ast.Node) {
+	t := reflect.TypeOf(node)
+	p.mu.Lock()
+	p.nodes[t]++
+	p.mu.Unlock()
+}
+
+func (e *evaluator) profileEnter(name string) {
+	e.prof.frames = append(e.prof.frames, profileFrame{name: name, start: time.Now()})
+	e.prof.active[name]++
+}
+
+func (e *evaluator) profileExit() {
+	frames := e.prof.frames
+	top := frames[len(frames)-1]
+	e.prof.frames = frames[:len(frames)-1]
+	elapsed := time.Since(top.start)
+	self := elapsed - top.children
+	if len(e.prof.frames) > 0 {
+		e.prof.frames[len(e.prof.frames)-1].children += elapsed
+	}
+	e.prof.active[top.name]--
+	outermost := e.prof.active[top.name] == 0
+
+	stack := make([]string, 0, len(frames))
+	for i := len(frames) - 1; i >= 0; i-- {
+		stack = append(stack, frames[i].name)
+	}
+	key := strings.Join(stack, "\x00")
+
+	p := e.opts.Profile
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	f, ok := p.functions[top.name]
+	if !ok {
+		f = &FunctionProfile{Name: top.name}
+		p.functions[top.name] = f
+	}
+	f.Calls++
+	f.Self += self
+	if outermost {
+		f.Cum += elapsed
+	}
+	s, ok := p.stacks[key]
+	if !ok {
+		s = &stackSample{stack: stack}
+		p.stacks[key] = s
+	}
+	s.calls++
+	s.self += self
+}
+
+// Functions returns the profiled functions, most self time first.
+func (p *Profile) Functions() []FunctionProfile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make([]FunctionProfile, 0, len(p.functions))
+	for _, f := range p.functions {
+		out = append(out, *f)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Self != out[j].Self {
+			return out[i].Self > out[j].Self
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// Nodes returns how often each node type was evaluated, keyed by
+// its name like "InfixExpression".
+func (p *Profile) Nodes() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]int, len(p.nodes))
+	for t, n := range p.nodes {
+		out[t.Elem().Name()] = n
+	}
+	return out
+}
+
+func (p *Profile) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%8s %12s %12s  %s\n", "calls", "self", "cum", "function")
+	for _, f := range p.Functions() {
+		fmt.Fprintf(&b, "%8d %12s %12s  %s\n", f.Calls, f.Self.Round(time.Microsecond),
+			f.Cum.Round(time.Microsecond), f.Name)
+	}
+
+	nodes := p.Nodes()
+	names := make([]string, 0, len(nodes))
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if nodes[names[i]] != nodes[names[j]] {
+			return nodes[names[i]] > nodes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	fmt.Fprintf(&b, "\n%8s  %s\n", "hits", "node")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%8d  %s\n", nodes[name], name)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,172 @@
+package eval
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pro0o/sup-bud/object"
+)
+
+const profiledScript = `sup fib = bud(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2)
+};
+sup twice = bud(f) { bud(x) { f(f(x)) } };
+twice(bud(x) { x + len([1]) })(fib(10))`
+
+func profileOf(t *testing.T) *Profile {
+	t.Helper()
+	profile := NewProfile("fib.sb", profiledScript)
+	evaluated := EvalWithOptions(parseProgram(t, profiledScript), object.NewEnvironment(),
+		EvalOptions{Profile: profile})
+	testIntegerObject(t, evaluated, 57)
+	return profile
+}
+
+func TestProfileCounts(t *testing.T) {
+	profile := profileOf(t)
+
+	calls := map[string]int{}
+	for _, f := range profile.Functions() {
+		calls[f.Name] = f.Calls
+		if f.Self > f.Cum {
+			t.Errorf("%s: self %v is more than cum %v", f.Name, f.Self, f.Cum)
+		}
+	}
+	expected := map[string]int{
+		"(main)":   1,
+		"fib":      177,
+		"twice":    1,
+		"bud@5:22": 1, // the closure twice returns
+		"bud@6:7":  2,
+		"len":      2,
+	}
+	for name, want := range expected {
+		if calls[name] != want {
+			t.Errorf("%s: expected %d calls, got %d", name, want, calls[name])
+		}
+	}
+	if len(calls) != len(expected) {
+		t.Errorf("expected %d functions, got %v", len(expected), calls)
+	}
+
+	nodes := profile.Nodes()
+	if nodes["Program"] != 1 || nodes["IfExpression"] != 177 || nodes["ArrayLiteral"] != 2 {
+		t.Errorf("wrong node counts %v", nodes)
+	}
+
+	var report strings.Builder
+	if err := profile.WriteText(&report); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"calls", "function", "fib\n", "hits  node", "IfExpression\n"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report is missing %q:\n%s", want, report.String())
+		}
+	}
+}
+
+// a tail call replaces its caller's frame, the caller still owns the
+// time spent in it
+func TestProfileTailCalls(t *testing.T) {
+	src := `sup work = bud(n) { if (n == 0) { 0 } else { 1 + work(n - 1) } };
+sup g = bud() { work(200) };
+sup count = bud(n) { if (n == 0) { 0 } else { count(n - 1) } };
+g() + count(2000)`
+	profile := NewProfile("tail.sb", src)
+	evaluated := EvalWithOptions(parseProgram(t, src), object.NewEnvironment(), EvalOptions{Profile: profile})
+	testIntegerObject(t, evaluated, 200)
+
+	functions := map[string]FunctionProfile{}
+	for _, f := range profile.Functions() {
+		functions[f.Name] = f
+	}
+	if g, work := functions["g"], functions["work"]; g.Cum < work.Cum {
+		t.Errorf("g tail calls work but has less cumulative time, %v against %v", g.Cum, work.Cum)
+	}
+	if calls := functions["count"].Calls; calls != 2001 {
+		t.Errorf("count: expected 2001 calls, got %d", calls)
+	}
+	// the stacks stay as deep as the calls that are not tail calls
+	for _, s := range profile.stacks {
+		if len(s.stack) > 203 {
+			t.Fatalf("a stack %d deep", len(s.stack))
+		}
+	}
+}
+
+func TestProfilePprof(t *testing.T) {
+	profile := profileOf(t)
+
+	var out bytes.Buffer
+	if err := profile.WritePprof(&out); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := map[uint64]int{}
+	var strs []string
+	for len(data) > 0 {
+		key, n := readVarint(t, data)
+		data = data[n:]
+		field, wireType := key>>3, key&7
+		fields[field]++
+		switch wireType {
+		case 0:
+			_, n = readVarint(t, data)
+			data = data[n:]
+		case 2:
+			size, n := readVarint(t, data)
+			data = data[n:]
+			if field == profileStringTable {
+				strs = append(strs, string(data[:size]))
+			}
+			data = data[size:]
+		default:
+			t.Fatalf("unexpected wire type %d", wireType)
+		}
+	}
+
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table has to start with \"\", got %q", strs)
+	}
+	for _, want := range []string{"calls", "count", "time", "nanoseconds", "fib", "(main)", "fib.sb"} {
+		found := false
+		for _, s := range strs {
+			found = found || s == want
+		}
+		if !found {
+			t.Errorf("string table is missing %q", want)
+		}
+	}
+	if fields[profileSampleType] != 2 || fields[profileFunction] != 6 || fields[profileLocation] != 6 {
+		t.Errorf("wrong field counts %v", fields)
+	}
+	// one sample per distinct stack, fib recurses 9 deep below (main)
+	if fields[profileSample] < 10 {
+		t.Errorf("expected a sample per stack, got %d", fields[profileSample])
+	}
+}
+
+func readVarint(t *testing.T, data []byte) (uint64, int) {
+	t.Helper()
+	var v uint64
+	for i, b := range data {
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			return v, i + 1
+		}
+	}
+	t.Fatal("truncated varint")
+	return 0, 0
+}
@@ -0,0 +1,134 @@
+package eval
+
+import (
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+// record Point { x, y; sup norm = bud() { ... }; }
+func evalRecordDefinition(node *ast.RecordDefinition, env *object.Environment) object.Object {
+	rt := &object.RecordType{
+		Name:    node.Name,
+		Methods: make(map[string]*ast.FunctionLiteral, len(node.Methods)),
+		Scope:   node.Scope,
+		Env:     env,
+	}
+	for _, field := range node.Fields {
+		rt.Fields = append(rt.Fields, field.Value)
+	}
+	for _, method := range node.Methods {
+		lit, ok := method.Value.(*ast.FunctionLiteral)
+		if !ok {
+			return newError("method %s of %s must be a bud", method.Name.Value, node.Name)
+		}
+		rt.Methods[method.Name.Value] = lit
+	}
+	return rt
+}
+
+// Point{x: 1, y: 2}, every field has to be given
+func (e *evaluator) evalRecordLiteral(node *ast.RecordLiteral, env *object.Environment, maxDepth int) object.Object {
+	typ := e.evalWithDepthTracking(node.Type, env, maxDepth-1)
+	if isError(typ) {
+		return typ
+	}
+	rt, ok := typ.(*object.RecordType)
+	if !ok {
+		return newError("not a record type: %s", typeName(typ))
+	}
+
+	given := make([]bool, len(rt.Fields))
+	for _, field := range node.Fields {
+		i := rt.Field(field.Value)
+		if i < 0 {
+			return newError("%s has no field %s", rt.Name, field.Value)
+		}
+		given[i] = true
+	}
+	for i, ok := range given {
+		if !ok {
+			return newError("missing field %s in %s", rt.Fields[i], rt.Name)
+		}
+	}
+
+	values := make([]object.Object, len(rt.Fields))
+	if err := e.evalFields(node.Fields, node.Values, rt, values, env, maxDepth); err != nil {
+		return err
+	}
+	return &object.Record{Def: rt, Values: values}
+}
+
+// p with {x: 3}, a copy of p with the fields given replaced
+func (e *evaluator) evalWithExpression(node *ast.WithExpression, env *object.Environment, maxDepth int) object.Object {
+	left := e.evalWithDepthTracking(node.Record, env, maxDepth-1)
+	if isError(left) {
+		return left
+	}
+	record, ok := left.(*object.Record)
+	if !ok {
+		return newError("with needs a record, got %s", typeName(left))
+	}
+	for _, field := range node.Fields {
+		if record.Def.Field(field.Value) < 0 {
+			return newError("%s has no field %s", record.Def.Name, field.Value)
+		}
+	}
+
+	values := append([]object.Object(nil), record.Values...)
+	if err := e.evalFields(node.Fields, node.Values, record.Def, values, env, maxDepth); err != nil {
+		return err
+	}
+	return &object.Record{Def: record.Def, Values: values}
+}
+
+// evaluates the values given to fields into their place in values,
+// the fields are known to be ones of rt
+func (e *evaluator) evalFields(
+	fields []*ast.Identifier,
+	exps []ast.Expression,
+	rt *object.RecordType,
+	values []object.Object,
+	env *object.Environment,
+	maxDepth int,
+) object.Object {
+	for i, field := range fields {
+		val := e.evalWithDepthTracking(exps[i], env, maxDepth-1)
+		if isError(val) {
+			return val
+		}
+		values[rt.Field(field.Value)] = val
+	}
+	return nil
+}
+
+// p.x, or p.norm for a method
+func evalRecordMember(record *object.Record, name string) object.Object {
+	if i := record.Def.Field(name); i >= 0 {
+		return record.Values[i]
+	}
+	if lit, ok := record.Def.Methods[name]; ok {
+		return bindMethod(record, name, lit)
+	}
+	return newError("%s has no field %s", record.Def.Name, name)
+}
+
+// the bud of a method, closing over a frame that binds self to record
+func bindMethod(record *object.Record, name string, lit *ast.FunctionLiteral) *object.Function {
+	rt := record.Def
+	var env *object.Environment
+	if rt.Scope == nil {
+		env = object.NewEnclosedEnvironment(rt.Env)
+	} else {
+		env = object.NewFrame(rt.Scope, rt.Env)
+	}
+	env.SetSlot(0, "self", record) // self is all the frame holds
+	return &object.Function{
+		Name:       rt.Name + "." + name,
+		Parameters: lit.Parameters,
+		Patterns:   lit.Patterns,
+		Body:       lit.Body,
+		Env:        env,
+		Scope:      lit.Scope,
+		Position:   lit.Token.Position,
+	}
+}
@@ -0,0 +1,178 @@
+package eval
+
+import "github.com/pro0o/sup-bud/ast"
+
+// resolver gives every name bound inside a bud or a select case a
+// slot in that call's frame, and every reference the (depth, slot) of
+// the binding it sees. the top level stays a map so a REPL can keep
+// adding to it, names there resolve to slot -1.
+//
+// a sup binds for the whole enclosing bud, but until it runs the name
+// still means whatever an outer scope binds. so scopes are declared
+// up front and Environment.Resolve falls back to outer frames while a
+// slot is empty, the same thing the map lookups used to do.
+type resolver struct {
+	scopes []*ast.Scope // innermost last, the top level is not one
+}
+
+// resolve annotates node in place, evaluating a tree from several
+// goroutines at once is only safe after it has been resolved.
+func resolve(node ast.Node) {
+	r := &resolver{}
+	r.resolve(node)
+}
+
+func (r *resolver) lookup(id *ast.Identifier) {
+	if id == nil {
+		return
+	}
+	id.Resolved = true
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if slot, ok := r.scopes[i].Slots[id.Value]; ok {
+			id.Depth = len(r.scopes) - 1 - i
+			id.Slot = slot
+			return
+		}
+	}
+	id.Depth = len(r.scopes)
+	id.Slot = -1
+}
+
+// runs body in a new scope holding names plus whatever body binds
+func (r *resolver) scope(names []*ast.Identifier, body ...ast.Node) *ast.Scope {
+	scope := ast.NewScope()
+	for _, name := range names {
+		scope.Declare(name.Value)
+	}
+	r.scopes = append(r.scopes, scope)
+	for _, node := range body {
+		r.declare(node)
+	}
+	for _, name := range names {
+		r.lookup(name)
+	}
+	for _, node := range body {
+		r.resolve(node)
+	}
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	return scope
+}
+
+func (r *resolver) resolve(node ast.Node) {
+	ast.Inspect(node, r.visit)
+}
+
+// the nodes that open a scope or hold names that are not references,
+// ast.Inspect goes through everything else
+func (r *resolver) visit(node ast.Node) bool {
+	switch node := node.(type) {
+	case *ast.Identifier:
+		r.lookup(node)
+	case *ast.DestructureStatement:
+		r.resolve(node.Value)
+		for _, name := range ast.Bindings(node.Pattern) {
+			r.lookup(name)
+		}
+		return false
+	case *ast.FunctionLiteral:
+		// a pattern parameter binds its own name and the pattern's
+		names := append([]*ast.Identifier(nil), node.Parameters...)
+		for _, pattern := range node.Patterns {
+			if pattern != nil {
+				names = append(names, ast.Bindings(pattern)...)
+			}
+		}
+		node.Scope = r.scope(names, node.Body)
+		return false
+	case *ast.MacroLiteral:
+		// expanded before anything is resolved
+		return false
+	case *ast.TypeExpression:
+		// type names are not references either
+		return false
+	case *ast.MemberExpression:
+		// the member name is not a reference
+		r.resolve(node.Object)
+		return false
+	case *ast.SelectExpression:
+		for _, c := range node.Cases {
+			r.resolve(c.Channel)
+			r.resolve(c.Value)
+			if c.Binding != nil {
+				c.Scope = r.scope([]*ast.Identifier{c.Binding}, c.Body)
+			} else {
+				r.resolve(c.Body)
+			}
+		}
+		r.resolve(node.Default)
+		return false
+	case *ast.MatchExpression:
+		r.resolve(node.Subject)
+		for _, arm := range node.Arms {
+			if names := ast.Bindings(arm.Pattern); len(names) > 0 {
+				arm.Scope = r.scope(names, arm.Guard, arm.Body)
+			} else {
+				r.resolve(arm.Guard)
+				r.resolve(arm.Body)
+			}
+		}
+		return false
+	case *ast.RecordDefinition:
+		// methods are buds in a frame of their own that binds self,
+		// made when one is looked up on a record
+		scope := ast.NewScope()
+		scope.Declare("self")
+		r.scopes = append(r.scopes, scope)
+		for _, method := range node.Methods {
+			r.resolve(method.Value)
+		}
+		r.scopes = r.scopes[:len(r.scopes)-1]
+		node.Scope = scope
+		return false
+	case *ast.RecordLiteral:
+		// field names are not references
+		r.resolve(node.Type)
+		for _, value := range node.Values {
+			r.resolve(value)
+		}
+		return false
+	case *ast.WithExpression:
+		r.resolve(node.Record)
+		for _, value := range node.Values {
+			r.resolve(value)
+		}
+		return false
+	}
+	return true
+}
+
+// declares the names node binds in the innermost scope, without
+// going into the buds, select cases, match arms and records that get
+// scopes of their own
+func (r *resolver) declare(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			if node.Name != nil {
+				r.scopes[len(r.scopes)-1].Declare(node.Name.Value)
+			}
+		case *ast.DestructureStatement:
+			for _, name := range ast.Bindings(node.Pattern) {
+				r.scopes[len(r.scopes)-1].Declare(name.Value)
+			}
+		case *ast.ImportStatement:
+			r.scopes[len(r.scopes)-1].Declare(node.Alias.Value)
+		case *ast.SelectCase:
+			if node.Binding != nil {
+				r.declare(node.Channel)
+				r.declare(node.Value)
+				return false
+			}
+		case *ast.MatchArm:
+			return len(ast.Bindings(node.Pattern)) == 0
+		case *ast.FunctionLiteral, *ast.MacroLiteral, *ast.RecordDefinition:
+			return false
+		}
+		return true
+	})
+}
@@ -0,0 +1,69 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/pro0o/sup-bud/ast"
+)
+
+func TestResolvedScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		// a local read before its sup still sees the outer binding
+		{"sup x = 1; sup f = bud() { sup y = x; sup x = 2; y + x * 10 }; f()", 21},
+		{"sup x = 1; sup f = bud() { if (false) { sup x = 2; } x }; f()", 1},
+		{"sup x = 1; sup f = bud() { if (true) { sup x = 2; } x }; f() + x * 10", 12},
+		{"sup f = bud(a, a) { a }; f(1, 2)", 2},
+		{"sup f = bud(x) { sup g = bud(n) { if (n == 0) { return x; } g(n - 1) }; g(5) }; f(7)", 7},
+		{"sup f = bud(a) { bud(b) { bud(c) { a * 100 + b * 10 + c } } }; f(1)(2)(3)", 123},
+		{"sup f = bud(a) { sup a = a + 1; bud() { a } }; f(1)()", 2},
+		{"sup counter = bud() { sup n = 0; bud() { sup n = n + 1; n } }; sup c = counter(); c(); c()", 1},
+		{"sup x = 10; sup f = bud() { x }; sup x = 20; f()", 20},
+		{"sup f = bud() { sup g = bud() { h() }; sup h = bud() { 3 }; g() }; f()", 3},
+		{"sup ch = chan(1); send(ch, 4); sup f = bud(v) { select { recv(ch) as v { sup w = v * 2; w + v } } }; f(100)", 12},
+		{"sup ch = chan(1); send(ch, 4); sup v = 1; select { recv(ch) as v { v } }", 4},
+		{"sup f = bud() { sup t = spawn(bud() { sup q = 6; q }); await(t) }; f()", 6},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestResolvedNilBinding(t *testing.T) {
+	input := "sup x = 5; sup f = bud() {}; sup g = bud() { sup x = f(); x }; g()"
+	if evaluated := testEval(t, input); evaluated != NULL {
+		t.Errorf("expected null, got %s", inspect(evaluated))
+	}
+}
+
+func TestResolveSlots(t *testing.T) {
+	program := parseProgram(t, "sup g = 1; sup f = bud(a, b) { sup c = a; bud(d) { a + b + c + d + g } };")
+	resolve(program)
+
+	fn := program.Statements[1].(*ast.LetStatement).Value.(*ast.FunctionLiteral)
+	if got := fn.Scope.Names; len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != "c" {
+		t.Fatalf("outer scope wrong, got %v", got)
+	}
+
+	inner := fn.Body.Statements[1].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	expected := map[string][2]int{"a": {1, 0}, "b": {1, 1}, "c": {1, 2}, "d": {0, 0}, "g": {2, -1}}
+
+	var check func(exp ast.Expression)
+	check = func(exp ast.Expression) {
+		switch exp := exp.(type) {
+		case *ast.InfixExpression:
+			check(exp.Left)
+			check(exp.Right)
+		case *ast.Identifier:
+			want := expected[exp.Value]
+			if !exp.Resolved || exp.Depth != want[0] || exp.Slot != want[1] {
+				t.Errorf("%s resolved to (%d, %d), want (%d, %d)",
+					exp.Value, exp.Depth, exp.Slot, want[0], want[1])
+			}
+		}
+	}
+	check(inner.Body.Statements[0].(*ast.ExpressionStatement).Expression)
+}
@@ -0,0 +1,141 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+// "hello ${name}", every value as it inspects
+func (e *evaluator) evalInterpolatedString(
+	node *ast.InterpolatedString,
+	env *object.Environment,
+	maxDepth int,
+) object.Object {
+	var out strings.Builder
+	for i, part := range node.Parts {
+		out.WriteString(part)
+		if i >= len(node.Values) {
+			continue
+		}
+		val := e.evalWithDepthTracking(node.Values[i], env, maxDepth-1)
+		if isError(val) {
+			return val
+		}
+		out.WriteString(val.Inspect())
+	}
+	return &object.String{Value: out.String()}
+}
+
+// print(a, b, ...) writes its arguments as they inspect, between
+// spaces and ended by a newline, to EvalOptions.Output
+func printBuiltin(e *evaluator, args ...object.Object) object.Object {
+	if e.opts.Output == nil {
+		return NULL
+	}
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = arg.Inspect()
+	}
+	e.sched.printing.Lock()
+	defer e.sched.printing.Unlock()
+	if _, err := io.WriteString(e.opts.Output, strings.Join(parts, " ")+"\n"); err != nil {
+		return newError("print: %s", err)
+	}
+	return NULL
+}
+
+// widths and precisions past this are a mistake, not a layout
+const maxFormatWidth = 4096
+
+// format("%-5s|%3d|%.2v", ...), the verbs are %d for integers, %s for
+// strings and %v for anything, with the flags - and 0, a width and a
+// precision the way go's fmt reads them. %% is a %.
+func formatString(args ...object.Object) object.Object {
+	if len(args) == 0 {
+		return newError("wrong number of arguments. got=0, want at least 1")
+	}
+	format, ok := args[0].(*object.String)
+	if !ok {
+		return newError("first argument to `format` must be STRING, got %s", args[0].Type())
+	}
+	args = args[1:]
+
+	var out strings.Builder
+	s := format.Value
+	used := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			out.WriteByte(s[i])
+			continue
+		}
+
+		j := i + 1
+		for j < len(s) && (s[j] == '-' || s[j] == '0') {
+			j++
+		}
+		width, j := formatNumber(s, j)
+		precision := 0
+		if j < len(s) && s[j] == '.' {
+			precision, j = formatNumber(s, j+1)
+		}
+		if j >= len(s) {
+			return newError("`format` directive %s has no verb", s[i:])
+		}
+		if width > maxFormatWidth || precision > maxFormatWidth {
+			return newError("`format` directive %s is wider than %d", s[i:j+1], maxFormatWidth)
+		}
+		spec, verb := s[i:j], s[j]
+		i = j
+
+		if verb == '%' {
+			out.WriteByte('%')
+			continue
+		}
+		if used == len(args) {
+			return newError("`format` is missing an argument for %s%c", spec, verb)
+		}
+		arg := args[used]
+		used++
+
+		switch verb {
+		case 'd':
+			n, ok := arg.(*object.Integer)
+			if !ok {
+				return newError("`format` %s%c needs INTEGER, got %s", spec, verb, arg.Type())
+			}
+			fmt.Fprintf(&out, spec+"d", n.Value)
+		case 's':
+			str, ok := arg.(*object.String)
+			if !ok {
+				return newError("`format` %s%c needs STRING, got %s", spec, verb, arg.Type())
+			}
+			fmt.Fprintf(&out, spec+"s", str.Value)
+		case 'v':
+			fmt.Fprintf(&out, spec+"s", arg.Inspect())
+		default:
+			return newError("`format` has no verb %%%c", verb)
+		}
+	}
+	if used < len(args) {
+		return newError("`format` got %d arguments, the format uses %d", len(args), used)
+	}
+	return &object.String{Value: out.String()}
+}
+
+// the digits of s from i on, and where they end
+func formatNumber(s string, i int) (int, int) {
+	j := i
+	for j < len(s) && '0' <= s[j] && s[j] <= '9' {
+		j++
+	}
+	n, err := strconv.Atoi(s[i:j])
+	if err != nil && j > i {
+		return maxFormatWidth + 1, j // too many digits for an int
+	}
+	return n, j
+}
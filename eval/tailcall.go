@@ -0,0 +1,130 @@
+package eval
+
+import (
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+const TAIL_CALL_OBJ = "TAIL_CALL"
+
+// a call in tail position, evaluated up to the point of applying it.
+// applyFunctionWithDepthTracking runs it in place of the current call,
+// so tail recursion neither grows the go stack nor spends maxDepth.
+// it never escapes a function call or the program.
+type tailCall struct {
+	fn   object.Object
+	args []object.Object
+}
+
+func (tc *tailCall) Type() object.ObjectType { return TAIL_CALL_OBJ }
+func (tc *tailCall) Inspect() string         { return "tail call" }
+
+// evaluates a function body, the last statement is in tail position
+func (e *evaluator) evalTailBlock(block *ast.BlockStatement, env *object.Environment, maxDepth int) object.Object {
+	if maxDepth <= 0 {
+		return e.nestingError()
+	}
+
+	last := len(block.Statements) - 1
+	var result object.Object
+	for i, statement := range block.Statements {
+		if i == last {
+			if stmt, ok := statement.(*ast.ExpressionStatement); ok {
+				if e.observed {
+					e.observe(stmt, env)
+				}
+				if e.opts.Trace != nil {
+					return e.traceNode(stmt, func() object.Object {
+						return e.evalTailExpression(stmt.Expression, env, maxDepth-1)
+					})
+				}
+				return e.evalTailExpression(stmt.Expression, env, maxDepth-1)
+			}
+		}
+		result = e.evalWithDepthTracking(statement, env, maxDepth-1)
+		if result != nil {
+			rt := result.Type()
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+				return result
+			}
+		}
+	}
+	return blockResult(result)
+}
+
+// if branches and match arms inherit the tail position, calls become tail calls
+func (e *evaluator) evalTailExpression(node ast.Expression, env *object.Environment, maxDepth int) object.Object {
+	if maxDepth <= 0 {
+		return e.nestingError()
+	}
+
+	switch node := node.(type) {
+	case *ast.CallExpression:
+		if isSpecialCall(node, "quote") {
+			return e.evalWithDepthTracking(node, env, maxDepth)
+		}
+		return e.evalTailCall(node, env, maxDepth)
+
+	case *ast.IfExpression:
+		if e.observed {
+			e.observe(node, env)
+		}
+		if e.opts.Trace != nil {
+			return e.traceNode(node, func() object.Object {
+				return e.evalTailIf(node, env, maxDepth)
+			})
+		}
+		return e.evalTailIf(node, env, maxDepth)
+
+	case *ast.MatchExpression:
+		if e.observed {
+			e.observe(node, env)
+		}
+		if e.opts.Trace != nil {
+			return e.traceNode(node, func() object.Object {
+				return e.evalMatchExpression(node, env, maxDepth, true)
+			})
+		}
+		return e.evalMatchExpression(node, env, maxDepth, true)
+
+	default:
+		return e.evalWithDepthTracking(node, env, maxDepth)
+	}
+}
+
+func (e *evaluator) evalTailIf(node *ast.IfExpression, env *object.Environment, maxDepth int) object.Object {
+	condition := e.evalWithDepthTracking(node.Condition, env, maxDepth-1)
+	if isError(condition) {
+		return condition
+	}
+	if isTruthy(condition) {
+		return e.evalTailBlock(node.Consequence, env, maxDepth-1)
+	} else if node.Alternative != nil {
+		return e.evalTailBlock(node.Alternative, env, maxDepth-1)
+	}
+	return NULL
+}
+
+func (e *evaluator) evalTailCall(node *ast.CallExpression, env *object.Environment, maxDepth int) object.Object {
+	if e.observed {
+		e.observe(node, env)
+	}
+	if e.opts.Trace != nil {
+		return e.traceNode(node, func() object.Object {
+			return e.tailCallOf(node, env, maxDepth)
+		})
+	}
+	return e.tailCallOf(node, env, maxDepth)
+}
+
+func (e *evaluator) tailCallOf(node *ast.CallExpression, env *object.Environment, maxDepth int) object.Object {
+	function := e.evalWithDepthTracking(node.Function, env, maxDepth-1)
+	if isError(function) {
+		return function
+	}
+	args := e.evalExpressionsWithDepthTracking(node.Arguments, env, maxDepth-1)
+	if len(args) == 1 && isError(args[0]) {
+		return args[0]
+	}
+	return &tailCall{fn: function, args: args}
+}
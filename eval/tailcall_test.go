@@ -0,0 +1,52 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pro0o/sup-bud/object"
+)
+
+func TestTailCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`
+		sup count = bud(n, acc) { if (n == 0) { acc } else { count(n - 1, acc + 1) } };
+		count(1000000, 0)`, 1000000},
+		{`
+		sup count = bud(n) { if (n == 0) { return 0; } return count(n - 1); };
+		count(100000)`, 0},
+		{`
+		sup even = bud(n) { if (n == 0) { true } else { odd(n - 1) } };
+		sup odd = bud(n) { if (n == 0) { false } else { even(n - 1) } };
+		if (even(100001)) { 1 } else { 0 }`, 0},
+		{`
+		sup loop = bud(n) { sup next = n - 1; if (next < 0) { 7 } else { loop(next) } };
+		return loop(5000);`, 7},
+		{`sup id = bud(x) { x }; sup f = bud(x) { id(x) }; f(len([1, 2]))`, 2},
+	}
+	// playground call limit, the timeout is generous for -race builds
+	opts := EvalOptions{MaxCallDepth: 200, Timeout: 30 * time.Second}
+	for _, tt := range tests {
+		testIntegerObject(t, testEvalWithOptions(t, tt.input, opts), tt.expected)
+	}
+}
+
+func TestNonTailRecursionStillLimited(t *testing.T) {
+	input := `
+	sup sum = bud(n) { if (n == 0) { 0 } else { n + sum(n - 1) } };
+	sum(1000)`
+	result := testEval(t, input)
+	if errObj, ok := result.(*object.Error); !ok || !strings.HasPrefix(errObj.Message, "Max call depth of 200 reached") {
+		t.Fatalf("expected the call depth limit to trip. got=%s", result.Inspect())
+	}
+}
+
+func TestInfiniteTailLoopTimesOut(t *testing.T) {
+	input := `sup spin = bud() { spin() }; spin()`
+	opts := EvalOptions{Timeout: 20 * time.Millisecond}
+	testErrorObject(t, testEvalWithOptions(t, input, opts), "Evaluation timed out after 20ms")
+}
@@ -0,0 +1,450 @@
+package eval
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+// scheduler tracks the tasks of one evaluation. every task and
+// channel state change happens under mu, which lets a blocking
+// task tell a real deadlock apart from a slow peer: if nobody is
+// running and no blocked task could proceed, nobody ever will.
+type scheduler struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	running    int // tasks not blocked in send, recv, await or select
+	waiters    map[*waiter]struct{}
+	deadlocked bool
+	nextID     int
+	builtins   map[string]*object.Builtin
+	bound      map[*object.Builtin]callerBuiltin // what apply runs for them
+
+	printing sync.Mutex // so lines printed by tasks do not interleave
+}
+
+type waiter struct {
+	ready func() bool
+}
+
+func newScheduler(ctx context.Context) *scheduler {
+	s := &scheduler{
+		running:  1, // the evaluation itself
+		waiters:  make(map[*waiter]struct{}),
+		builtins: make(map[string]*object.Builtin),
+		bound:    make(map[*object.Builtin]callerBuiltin),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	// wake blocked tasks so they notice the cancellation
+	context.AfterFunc(ctx, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	return s
+}
+
+// block waits until ready holds, must be called with mu held.
+func (s *scheduler) block(ctx context.Context, ready func() bool) *object.Error {
+	if ready() {
+		return nil
+	}
+
+	w := &waiter{ready: ready}
+	s.waiters[w] = struct{}{}
+	s.running--
+	defer func() {
+		delete(s.waiters, w)
+		s.running++
+	}()
+
+	for {
+		if s.deadlocked {
+			return newError("deadlock: all tasks are blocked")
+		}
+		if ctx.Err() != nil {
+			return newError("task cancelled: %v", ctx.Err())
+		}
+		if s.running == 0 && !s.anyReady() {
+			s.deadlocked = true
+			s.cond.Broadcast()
+			return newError("deadlock: all tasks are blocked")
+		}
+		s.cond.Wait()
+		if ready() {
+			return nil
+		}
+	}
+}
+
+func (s *scheduler) anyReady() bool {
+	for w := range s.waiters {
+		if w.ready() {
+			return true
+		}
+	}
+	return false
+}
+
+// spawn(fn, args...) runs fn on its own goroutine with a fresh
+// depth budget, the task handle is resolved by await.
+func (e *evaluator) spawn(fn object.Object, args []object.Object) object.Object {
+	s := e.sched
+
+	s.mu.Lock()
+	s.nextID++
+	task := &object.Task{ID: s.nextID}
+	s.running++
+	s.mu.Unlock()
+
+	child := *e
+	child.exports = nil
+	child.calls = nil // a task starts with its own call stack
+	child.task = task.ID
+	if e.prof != nil {
+		child.prof = newProfiler()
+	}
+
+	go func() {
+		var result object.Object
+		defer func() {
+			if r := recover(); r != nil {
+				result = newError("panic in task %d: %v", task.ID, r)
+			}
+			s.mu.Lock()
+			task.Result = result
+			task.Done = true
+			s.running--
+			s.cond.Broadcast()
+			s.mu.Unlock()
+		}()
+		result = child.applyFunctionWithDepthTracking(fn, args, e.opts.initialDepth())
+	}()
+
+	return task
+}
+
+func (e *evaluator) await(task *object.Task) object.Object {
+	s := e.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.block(e.ctx, func() bool { return task.Done }); err != nil {
+		return err
+	}
+	return task.Result
+}
+
+// unbuffered channels only accept a value once a receiver waits for
+// it, other than self, a select cannot send to itself
+func canSend(ch *object.Channel, self *object.Receiver) bool {
+	if ch.Closed {
+		return true // fails right away
+	}
+	if ch.Capacity == 0 {
+		return waitingReceiver(ch, self) != nil
+	}
+	return len(ch.Buffer) < ch.Capacity
+}
+
+// the receiver longest in line on ch that has no value yet
+func waitingReceiver(ch *object.Channel, self *object.Receiver) *object.Receiver {
+	for _, r := range ch.Receivers {
+		if r.From == nil && r != self {
+			return r
+		}
+	}
+	return nil
+}
+
+// puts r in line on every channel in chans until the returned func
+// is called, callers hold mu
+func park(r *object.Receiver, chans []*object.Channel) func() {
+	for _, ch := range chans {
+		ch.Receivers = append(ch.Receivers, r)
+	}
+	return func() {
+		for _, ch := range chans {
+			for i, other := range ch.Receivers {
+				if other == r {
+					ch.Receivers = append(ch.Receivers[:i:i], ch.Receivers[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+}
+
+func canRecv(ch *object.Channel) bool {
+	return len(ch.Buffer) > 0 || ch.Closed
+}
+
+// callers hold mu and have checked canSend with the same self. on an
+// unbuffered channel the value goes to a waiting receiver, so the send
+// is over once the receiver has it
+func (s *scheduler) sendLocked(ch *object.Channel, value object.Object, self *object.Receiver) object.Object {
+	if ch.Closed {
+		return newError("send on closed channel")
+	}
+	if ch.Capacity == 0 {
+		r := waitingReceiver(ch, self)
+		r.Value, r.From = value, ch
+	} else {
+		ch.Buffer = append(ch.Buffer, value)
+	}
+	s.cond.Broadcast()
+	return NULL
+}
+
+// callers hold mu and have checked canRecv, closed and drained yields null
+func (s *scheduler) recvLocked(ch *object.Channel) object.Object {
+	if len(ch.Buffer) == 0 {
+		return NULL
+	}
+	value := ch.Buffer[0]
+	ch.Buffer = ch.Buffer[1:]
+	s.cond.Broadcast()
+	return value
+}
+
+func (e *evaluator) send(ch *object.Channel, value object.Object) object.Object {
+	s := e.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.block(e.ctx, func() bool { return canSend(ch, nil) }); err != nil {
+		return err
+	}
+	return s.sendLocked(ch, value, nil)
+}
+
+func (e *evaluator) recv(ch *object.Channel) object.Object {
+	s := e.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := &object.Receiver{}
+	unpark := park(r, []*object.Channel{ch})
+	s.cond.Broadcast() // an unbuffered sender may be waiting on us
+	err := s.block(e.ctx, func() bool { return r.From != nil || canRecv(ch) })
+	unpark()
+	if r.From != nil {
+		return r.Value // the sender is gone, the value must not be
+	}
+	if err != nil {
+		return err
+	}
+	return s.recvLocked(ch)
+}
+
+func (e *evaluator) closeChannel(ch *object.Channel) object.Object {
+	s := e.sched
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ch.Closed {
+		return newError("close of closed channel")
+	}
+	ch.Closed = true
+	s.cond.Broadcast()
+	return NULL
+}
+
+// select runs the body of the first ready case, blocking until one
+// is ready unless there is a default.
+func (e *evaluator) evalSelectExpressionWithDepthTracking(
+	se *ast.SelectExpression,
+	env *object.Environment,
+	maxDepth int,
+) object.Object {
+	channels := make([]*object.Channel, len(se.Cases))
+	values := make([]object.Object, len(se.Cases))
+
+	for i, c := range se.Cases {
+		chObj := e.evalWithDepthTracking(c.Channel, env, maxDepth-1)
+		if isError(chObj) {
+			return chObj
+		}
+		ch, ok := chObj.(*object.Channel)
+		if !ok {
+			return newError("%s in select expects CHANNEL, got %s", c.TokenLiteral(), chObj.Type())
+		}
+		channels[i] = ch
+
+		if c.Send {
+			value := e.evalWithDepthTracking(c.Value, env, maxDepth-1)
+			if isError(value) {
+				return value
+			}
+			values[i] = value
+		}
+	}
+
+	// while the select waits r is in line on its recv channels, and
+	// none of its sends can go to it
+	r := &object.Receiver{}
+	readyCase := func() int {
+		for i, c := range se.Cases {
+			if (c.Send && canSend(channels[i], r)) || (!c.Send && canRecv(channels[i])) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	s := e.sched
+	s.mu.Lock()
+	chosen := readyCase()
+	var received object.Object
+	handed := false
+	if chosen < 0 && se.Default == nil {
+		var recvChannels []*object.Channel
+		for i, c := range se.Cases {
+			if !c.Send {
+				recvChannels = append(recvChannels, channels[i])
+			}
+		}
+		unpark := park(r, recvChannels)
+		s.cond.Broadcast()
+		err := s.block(e.ctx, func() bool { return r.From != nil || readyCase() >= 0 })
+		unpark()
+		if r.From != nil {
+			// a sender handed its value over, that decides the case
+			for i, c := range se.Cases {
+				if !c.Send && channels[i] == r.From {
+					chosen = i
+					break
+				}
+			}
+			received, handed = r.Value, true
+		} else if err != nil {
+			s.mu.Unlock()
+			return err
+		} else {
+			chosen = readyCase()
+		}
+	}
+
+	if chosen >= 0 && !handed {
+		if se.Cases[chosen].Send {
+			received = s.sendLocked(channels[chosen], values[chosen], r)
+		} else {
+			received = s.recvLocked(channels[chosen])
+		}
+	}
+	s.mu.Unlock()
+
+	if isError(received) {
+		return received
+	}
+	if chosen < 0 {
+		return e.evalWithDepthTracking(se.Default, env, maxDepth-1)
+	}
+
+	selected := se.Cases[chosen]
+	caseEnv := env
+	if selected.Binding != nil {
+		if selected.Scope != nil {
+			caseEnv = object.NewFrame(selected.Scope, env)
+		} else {
+			caseEnv = object.NewEnclosedEnvironment(env)
+		}
+		e.bind(caseEnv, selected.Binding, received)
+	}
+	return e.evalWithDepthTracking(selected.Body, caseEnv, maxDepth-1)
+}
+
+// a builtin run with the evaluator that calls it, so a task spawns,
+// awaits and blocks on its own call stack and not on the one of the
+// evaluation that made the builtin
+type callerBuiltin func(e *evaluator, args ...object.Object) object.Object
+
+// bind makes the builtin name, apply finds fn for it in s.bound
+func (s *scheduler) bind(name string, fn callerBuiltin) {
+	builtin := &object.Builtin{
+		Name: name,
+		Fn: func(args ...object.Object) object.Object {
+			return newError("`%s` needs an evaluator to run in", name)
+		},
+	}
+	s.builtins[name] = builtin
+	s.bound[builtin] = fn
+}
+
+// builtins that need the scheduler, bound once per evaluation
+func (s *scheduler) bindTaskBuiltins() {
+	channelArgument := func(name string, args []object.Object, want int) (*object.Channel, *object.Error) {
+		if len(args) != want {
+			return nil, newError("wrong number of arguments. got=%d, want=%d", len(args), want)
+		}
+		ch, ok := args[0].(*object.Channel)
+		if !ok {
+			return nil, newError("argument to `%s` must be CHANNEL, got %s", name, args[0].Type())
+		}
+		return ch, nil
+	}
+
+	s.bind("spawn", func(e *evaluator, args ...object.Object) object.Object {
+		if len(args) < 1 {
+			return newError("wrong number of arguments. got=0, want at least 1")
+		}
+		switch args[0].(type) {
+		case *object.Function, *object.Builtin:
+		default:
+			return newError("argument to `spawn` must be FUNCTION, got %s", args[0].Type())
+		}
+		return e.spawn(args[0], args[1:])
+	})
+	s.bind("await", func(e *evaluator, args ...object.Object) object.Object {
+		if len(args) != 1 {
+			return newError("wrong number of arguments. got=%d, want=1", len(args))
+		}
+		task, ok := args[0].(*object.Task)
+		if !ok {
+			return newError("argument to `await` must be TASK, got %s", args[0].Type())
+		}
+		return e.await(task)
+	})
+	s.bind("chan", func(e *evaluator, args ...object.Object) object.Object {
+		capacity := int64(0)
+		switch len(args) {
+		case 0:
+		case 1:
+			size, ok := args[0].(*object.Integer)
+			if !ok || size.Value < 0 {
+				return newError("argument to `chan` must be a non-negative INTEGER, got %s", args[0].Inspect())
+			}
+			capacity = size.Value
+		default:
+			return newError("wrong number of arguments. got=%d, want=0 or 1", len(args))
+		}
+		s.mu.Lock()
+		s.nextID++
+		id := s.nextID
+		s.mu.Unlock()
+		return &object.Channel{ID: id, Capacity: int(capacity)}
+	})
+	s.bind("send", func(e *evaluator, args ...object.Object) object.Object {
+		ch, err := channelArgument("send", args, 2)
+		if err != nil {
+			return err
+		}
+		return e.send(ch, args[1])
+	})
+	s.bind("recv", func(e *evaluator, args ...object.Object) object.Object {
+		ch, err := channelArgument("recv", args, 1)
+		if err != nil {
+			return err
+		}
+		return e.recv(ch)
+	})
+	s.bind("close", func(e *evaluator, args ...object.Object) object.Object {
+		ch, err := channelArgument("close", args, 1)
+		if err != nil {
+			return err
+		}
+		return e.closeChannel(ch)
+	})
+}
@@ -0,0 +1,131 @@
+package eval
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpawnAndAwait(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`sup t = spawn(bud(a, b) { a + b }, 2, 3); await(t)`, 5},
+		{`
+		sup fib = bud(n) { if (n < 2) { n } else { fib(n - 1) + fib(n - 2) } };
+		sup a = spawn(fib, 10);
+		sup b = spawn(fib, 11);
+		await(a) + await(b)`, 144},
+		{`
+		sup ch = chan(2);
+		send(ch, 1);
+		send(ch, 2);
+		recv(ch) + recv(ch)`, 3},
+		{`
+		sup ch = chan();
+		sup producer = bud(n) { if (n > 0) { send(ch, n); producer(n - 1) } else { close(ch) } };
+		sup sum = bud(acc, n) { if (n > 0) { sum(acc + recv(ch), n - 1) } else { acc } };
+		spawn(producer, 10);
+		sum(0, 10)`, 55},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+// a task spawning a task copies its own evaluator, not the one main
+// is still calling through, run with -race to see
+func TestNestedSpawn(t *testing.T) {
+	input := `
+	sup busy = bud(n) { if (n == 0) { 0 } else { 1 + busy(n - 1) } };
+	sup spin = bud(n) { if (n == 0) { 0 } else { busy(50); spin(n - 1) } };
+	sup leaf = bud() { busy(10) };
+	sup mid = bud(n) { if (n == 0) { 0 } else { await(spawn(leaf)) + mid(n - 1) } };
+	sup t = spawn(mid, 20);
+	spin(500);
+	await(t)`
+	testIntegerObject(t, testEval(t, input), 200)
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{`sup a = chan(1); sup b = chan(1); send(b, 7);
+		select { recv(a) as v { v } recv(b) as v { v * 10 } }`, 70},
+		{`sup a = chan(1);
+		select { recv(a) as v { v } default { -1 } }`, -1},
+		{`sup a = chan(1);
+		select { send(a, 3) { recv(a) } }`, 3},
+		{`sup a = chan();
+		spawn(bud() { send(a, 9) });
+		select { recv(a) as v { v } }`, 9},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+// a send on an unbuffered channel is over once a receiver has the
+// value, a select waiting on two channels takes one of two senders
+// and leaves the other blocked, with nothing on its channel
+func TestUnbufferedSelectTakesOneSender(t *testing.T) {
+	input := `
+	sup a = chan(); sup b = chan();
+	sup ta = spawn(bud() { send(a, 1) });
+	sup tb = spawn(bud() { send(b, 2) });
+	sup got = select { recv(a) as v { v } recv(b) as v { v } };
+	sup other = if (got == 1) { b } else { a };
+	sup left = select { recv(other) as v { "left on the channel" } default { "none" } };
+	sup rest = recv(other);
+	await(ta); await(tb);
+	[got + rest, left]`
+	for i := 0; i < 50; i++ {
+		if got := inspect(testEval(t, input)); got != "[3, none]" {
+			t.Fatalf("wrong result. expected=[3, none], got=%s", got)
+		}
+	}
+}
+
+func TestDeadlockIsAnError(t *testing.T) {
+	tests := []string{
+		`recv(chan())`,
+		`send(chan(), 1)`,
+		`sup ch = chan(); await(spawn(bud() { recv(ch) }))`,
+		`select { recv(chan()) { 1 } }`,
+		// a select does not meet itself on an unbuffered channel
+		`sup a = chan(); select { send(a, 1) { 1 } recv(a) as v { v } }`,
+	}
+	for _, input := range tests {
+		testErrorObject(t, testEval(t, input), "deadlock: all tasks are blocked")
+	}
+}
+
+func TestChannelErrors(t *testing.T) {
+	testErrorObject(t, testEval(t, `sup c = chan(1); close(c); send(c, 1)`), "send on closed channel")
+	testErrorObject(t, testEval(t, `sup c = chan(1); close(c); close(c)`), "close of closed channel")
+	testErrorObject(t, testEval(t, `await(1)`), "argument to `await` must be TASK, got INTEGER")
+
+	if result := testEval(t, `sup c = chan(1); close(c); recv(c)`); result != NULL {
+		t.Errorf("recv on a closed channel should be null. got=%s", result.Inspect())
+	}
+}
+
+func TestTimeoutCancelsTasks(t *testing.T) {
+	input := `
+	sup spin = bud(n) { spin(n) };
+	spawn(bud() { spin(0) });
+	spin(0)`
+	opts := EvalOptions{Timeout: 20 * time.Millisecond}
+
+	start := time.Now()
+	result := testEvalWithOptions(t, input, opts)
+	if !strings.Contains(result.Inspect(), "timed out") {
+		t.Fatalf("expected a timeout. got=%s", result.Inspect())
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("timeout took too long")
+	}
+}
@@ -0,0 +1,168 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/object"
+)
+
+// used when Trace.Max is left at zero
+const DefaultMaxTraceEvents = 10000
+
+// kinds of trace events
+const (
+	TraceEnter  = "enter"  // a node is about to be evaluated
+	TraceExit   = "exit"   // a node produced Value
+	TraceBind   = "bind"   // Name was bound to Value, params included
+	TraceCall   = "call"   // a bud or builtin Name is called with Args
+	TraceReturn = "return" // the call to Name returned Value
+)
+
+// TraceEvent is one step of an evaluation. the JSON form is what the
+// playground animates, so fields only ever get added.
+//
+// a tail call replaces the frame of the call it is in: it shows up
+// as a call with Tail set and no return for the call it replaced.
+// enter and exit always pair up, Level counts the nodes around an
+// event.
+type TraceEvent struct {
+	Seq   int       `json:"seq"`
+	Kind  string    `json:"kind"`
+	Node  string    `json:"node,omitempty"` // ast type name, for enter and exit
+	Span  *ast.Span `json:"span,omitempty"`
+	Level int       `json:"level"`
+	Name  string    `json:"name,omitempty"`
+	Value string    `json:"value,omitempty"` // Inspect of the value, buds as their signature
+	Args  []string  `json:"args,omitempty"`
+	Tail  bool      `json:"tail,omitempty"`
+	Task  int       `json:"task,omitempty"` // spawned task the event is from, 0 for the program
+}
+
+// Trace collects events in evaluation order until Max is reached,
+// the rest are dropped and Truncated is set.
+type Trace struct {
+	Max int
+
+	mu     sync.Mutex // spawned tasks record into the same trace
+	events []TraceEvent
+
+	// read without mu, so a full trace costs a node no more than a load
+	full      atomic.Bool
+	truncated atomic.Bool
+}
+
+func NewTrace(max int) *Trace {
+	return &Trace{Max: max}
+}
+
+func (t *Trace) Events() []TraceEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]TraceEvent(nil), t.events...)
+}
+
+func (t *Trace) Truncated() bool {
+	return t.truncated.Load()
+}
+
+// {"events": [...], "truncated": false}
+func (t *Trace) MarshalJSON() ([]byte, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	events := t.events
+	if events == nil {
+		events = []TraceEvent{}
+	}
+	return json.Marshal(struct {
+		Events    []TraceEvent `json:"events"`
+		Truncated bool         `json:"truncated"`
+	}{events, t.truncated.Load()})
+}
+
+// reports whether the trace is full, before an event that would be
+// dropped is built, and marks it truncated if so
+func (t *Trace) skip() bool {
+	if !t.full.Load() {
+		return false
+	}
+	t.truncated.Store(true)
+	return true
+}
+
+func (t *Trace) add(event TraceEvent, e *evaluator) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	max := t.Max
+	if max <= 0 {
+		max = DefaultMaxTraceEvents
+	}
+	if len(t.events) >= max {
+		// another task filled it since skip
+		t.truncated.Store(true)
+		return
+	}
+	event.Seq = len(t.events)
+	event.Task = e.task
+	event.Level = e.level
+	t.events = append(t.events, event)
+	if len(t.events) == max {
+		t.full.Store(true)
+	}
+}
+
+// wraps the evaluation of node in an enter and exit event
+func (e *evaluator) traceNode(node ast.Node, eval func() object.Object) object.Object {
+	if e.opts.Trace.skip() {
+		return eval()
+	}
+	kind := nodeKind(node)
+	span := ast.SpanOf(node)
+	e.opts.Trace.add(TraceEvent{Kind: TraceEnter, Node: kind, Span: &span}, e)
+	e.level++
+	result := eval()
+	e.level--
+	if !e.opts.Trace.skip() {
+		e.opts.Trace.add(TraceEvent{Kind: TraceExit, Node: kind, Span: &span, Value: traceValue(result)}, e)
+	}
+	return result
+}
+
+func (e *evaluator) traceCall(name string, args []object.Object, tail bool) {
+	if e.opts.Trace.skip() {
+		return
+	}
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = traceValue(arg)
+	}
+	e.opts.Trace.add(TraceEvent{Kind: TraceCall, Name: name, Args: values, Tail: tail}, e)
+}
+
+func (e *evaluator) traceReturn(name string, result object.Object) {
+	if e.opts.Trace.skip() {
+		return
+	}
+	e.opts.Trace.add(TraceEvent{Kind: TraceReturn, Name: name, Value: traceValue(result)}, e)
+}
+
+// "InfixExpression" for *ast.InfixExpression
+func nodeKind(node ast.Node) string {
+	return strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast.")
+}
+
+func traceValue(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return ""
+	case *object.Function:
+		return obj.Signature()
+	case *object.ReturnValue:
+		return traceValue(obj.Value)
+	}
+	return obj.Inspect()
+}
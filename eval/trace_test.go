@@ -0,0 +1,157 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pro0o/sup-bud/object"
+)
+
+func traceOf(t *testing.T, input string, max int) (*Trace, object.Object) {
+	t.Helper()
+	trace := NewTrace(max)
+	evaluated := EvalWithOptions(parseProgram(t, input), object.NewEnvironment(), EvalOptions{Trace: trace})
+	return trace, evaluated
+}
+
+// the format the playground relies on, spelled out event by event
+func TestTraceFormat(t *testing.T) {
+	trace, evaluated := traceOf(t, "sup f = bud(x) { x * 2 };\nf(1 + 2)", 0)
+	testIntegerObject(t, evaluated, 6)
+
+	data, err := json.MarshalIndent(trace, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// compact form of each event keeps the expectation readable
+	var compact []string
+	for _, event := range trace.Events() {
+		b, _ := json.Marshal(event)
+		compact = append(compact, string(b))
+	}
+	expected := []string{
+		`{"seq":0,"kind":"enter","node":"Program","span":{"start":0,"end":33},"level":0}`,
+		`{"seq":1,"kind":"enter","node":"LetStatement","span":{"start":0,"end":22},"level":1}`,
+		`{"seq":2,"kind":"enter","node":"FunctionLiteral","span":{"start":8,"end":22},"level":2}`,
+		`{"seq":3,"kind":"exit","node":"FunctionLiteral","span":{"start":8,"end":22},"level":2,"value":"bud(x)"}`,
+		`{"seq":4,"kind":"bind","level":2,"name":"f","value":"bud(x)"}`,
+		`{"seq":5,"kind":"exit","node":"LetStatement","span":{"start":0,"end":22},"level":1}`,
+		`{"seq":6,"kind":"enter","node":"ExpressionStatement","span":{"start":26,"end":33},"level":1}`,
+		`{"seq":7,"kind":"enter","node":"CallExpression","span":{"start":26,"end":33},"level":2}`,
+		`{"seq":8,"kind":"enter","node":"Identifier","span":{"start":26,"end":27},"level":3}`,
+		`{"seq":9,"kind":"exit","node":"Identifier","span":{"start":26,"end":27},"level":3,"value":"bud(x)"}`,
+		`{"seq":10,"kind":"enter","node":"InfixExpression","span":{"start":28,"end":33},"level":3}`,
+		`{"seq":11,"kind":"enter","node":"IntegerLiteral","span":{"start":28,"end":29},"level":4}`,
+		`{"seq":12,"kind":"exit","node":"IntegerLiteral","span":{"start":28,"end":29},"level":4,"value":"1"}`,
+		`{"seq":13,"kind":"enter","node":"IntegerLiteral","span":{"start":32,"end":33},"level":4}`,
+		`{"seq":14,"kind":"exit","node":"IntegerLiteral","span":{"start":32,"end":33},"level":4,"value":"2"}`,
+		`{"seq":15,"kind":"exit","node":"InfixExpression","span":{"start":28,"end":33},"level":3,"value":"3"}`,
+		`{"seq":16,"kind":"call","level":3,"name":"f","args":["3"]}`,
+		`{"seq":17,"kind":"bind","level":3,"name":"x","value":"3"}`,
+		`{"seq":18,"kind":"enter","node":"ExpressionStatement","span":{"start":17,"end":22},"level":3}`,
+		`{"seq":19,"kind":"enter","node":"InfixExpression","span":{"start":17,"end":22},"level":4}`,
+		`{"seq":20,"kind":"enter","node":"Identifier","span":{"start":17,"end":18},"level":5}`,
+		`{"seq":21,"kind":"exit","node":"Identifier","span":{"start":17,"end":18},"level":5,"value":"3"}`,
+		`{"seq":22,"kind":"enter","node":"IntegerLiteral","span":{"start":21,"end":22},"level":5}`,
+		`{"seq":23,"kind":"exit","node":"IntegerLiteral","span":{"start":21,"end":22},"level":5,"value":"2"}`,
+		`{"seq":24,"kind":"exit","node":"InfixExpression","span":{"start":17,"end":22},"level":4,"value":"6"}`,
+		`{"seq":25,"kind":"exit","node":"ExpressionStatement","span":{"start":17,"end":22},"level":3,"value":"6"}`,
+		`{"seq":26,"kind":"return","level":3,"name":"f","value":"6"}`,
+		`{"seq":27,"kind":"exit","node":"CallExpression","span":{"start":26,"end":33},"level":2,"value":"6"}`,
+		`{"seq":28,"kind":"exit","node":"ExpressionStatement","span":{"start":26,"end":33},"level":1,"value":"6"}`,
+		`{"seq":29,"kind":"exit","node":"Program","span":{"start":0,"end":33},"level":0,"value":"6"}`,
+	}
+	if strings.Join(compact, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong trace.\nexpected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(compact, "\n"))
+	}
+	if !strings.HasPrefix(string(data), "{\n  \"events\": [") || !strings.Contains(string(data), `"truncated": false`) {
+		t.Errorf("wrong trace envelope: %s", data)
+	}
+}
+
+func TestTraceTailCalls(t *testing.T) {
+	input := `sup loop = bud(n) { if (n == 0) { return 0; } loop(n - 1) }; loop(2)`
+	trace, evaluated := traceOf(t, input, 0)
+	testIntegerObject(t, evaluated, 0)
+
+	var calls []string
+	for _, event := range trace.Events() {
+		switch event.Kind {
+		case TraceCall:
+			calls = append(calls, fmt.Sprintf("call %s%v tail=%t", event.Name, event.Args, event.Tail))
+		case TraceReturn:
+			calls = append(calls, fmt.Sprintf("return %s %s", event.Name, event.Value))
+		}
+	}
+	expected := []string{
+		"call loop[2] tail=false",
+		"call loop[1] tail=true",
+		"call loop[0] tail=true",
+		"return loop 0",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong calls.\nexpected: %q\ngot:      %q", expected, calls)
+	}
+
+	// enter and exit pair up even through the trampoline
+	level := 0
+	for _, event := range trace.Events() {
+		switch event.Kind {
+		case TraceEnter:
+			level++
+		case TraceExit:
+			level--
+		}
+		if level < 0 {
+			t.Fatalf("exit without enter at event %d", event.Seq)
+		}
+	}
+	if level != 0 {
+		t.Errorf("%d enters without exit", level)
+	}
+}
+
+func TestTraceCap(t *testing.T) {
+	trace, evaluated := traceOf(t, "1 + 2 + 3 + 4", 5)
+	testIntegerObject(t, evaluated, 10)
+
+	events := trace.Events()
+	if len(events) != 5 || !trace.Truncated() {
+		t.Fatalf("expected 5 events and a truncated trace, got %d events, truncated=%t",
+			len(events), trace.Truncated())
+	}
+	for i, event := range events {
+		if event.Seq != i {
+			t.Errorf("event %d has seq %d", i, event.Seq)
+		}
+	}
+
+	data, err := json.Marshal(NewTrace(0))
+	if err != nil || string(data) != `{"events":[],"truncated":false}` {
+		t.Errorf("wrong empty trace %s, err=%v", data, err)
+	}
+}
+
+// counts the times it is inspected
+type inspectCounter struct{ n *int }
+
+func (c inspectCounter) Type() object.ObjectType { return "COUNTER" }
+func (c inspectCounter) Inspect() string         { *c.n++; return "counter" }
+
+func TestFullTraceBuildsNoEvents(t *testing.T) {
+	inspected := 0
+	env := object.NewEnvironment()
+	env.Set("c", inspectCounter{&inspected})
+	trace := NewTrace(3)
+	EvalWithOptions(parseProgram(t, "1; c; sup d = c; [c, c]"), env, EvalOptions{Trace: trace})
+
+	if !trace.Truncated() || len(trace.Events()) != 3 {
+		t.Fatalf("expected 3 events and a truncated trace, got %d events, truncated=%t",
+			len(trace.Events()), trace.Truncated())
+	}
+	if inspected != 0 {
+		t.Errorf("values were inspected %d times for events that were dropped", inspected)
+	}
+}
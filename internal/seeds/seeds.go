@@ -0,0 +1,35 @@
+// Package seeds gives the fuzz targets their starting corpus: every
+// string in the table driven tests, which between them cover most of
+// the language and its error paths.
+package seeds
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"testing"
+)
+
+// Add adds every string literal in the Go test files to f's corpus,
+// paths are relative to the package being tested.
+func Add(f *testing.F, files ...string) {
+	f.Helper()
+	fset := token.NewFileSet()
+	for _, file := range files {
+		parsed, err := parser.ParseFile(fset, file, nil, 0)
+		if err != nil {
+			f.Fatalf("seeds: %v", err)
+		}
+		ast.Inspect(parsed, func(node ast.Node) bool {
+			lit, ok := node.(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			if s, err := strconv.Unquote(lit.Value); err == nil {
+				f.Add(s)
+			}
+			return true
+		})
+	}
+}
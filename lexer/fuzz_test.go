@@ -0,0 +1,35 @@
+package lexer
+
+import (
+	"testing"
+
+	"github.com/pro0o/sup-bud/internal/seeds"
+	"github.com/pro0o/sup-bud/token"
+)
+
+// the lexer reaches EOF on any input, every token but EOF takes up at
+// least a byte of it and positions only go forward
+func FuzzLexer(f *testing.F) {
+	seeds.Add(f, "lexer_test.go", "../parser/parser_test.go")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		l := New(input)
+		last := 0
+		for i := 0; ; i++ {
+			if i > len(input) {
+				t.Fatalf("no EOF after %d tokens of %q", i, input)
+			}
+			tok := l.NextToken()
+			if tok.Position < last || tok.Position > len(input) {
+				t.Fatalf("token %d of %q is at %d, after %d", i, input, tok.Position, last)
+			}
+			last = tok.Position
+			if tok.Type == token.EOF {
+				break
+			}
+		}
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Fatalf("%s after EOF in %q", tok.Type, input)
+		}
+	})
+}
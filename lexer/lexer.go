@@ -2,20 +2,32 @@ package lexer
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/pro0o/sup-bud/token"
 )
 
 type Lexer struct {
 	input         string
-	position      int      // current char
-	readPosition  int      // next char
-	ch            byte     // current char in consideration
-	line          int      // current line number
-	column        int      // current column number
-	linePositions []int    // tracks starting position of each line
-	errors        []string // collect lexical errors
+	position      int          // byte offset of the current char
+	readPosition  int          // byte offset of the next char
+	ch            rune         // current char in consideration
+	line          int          // current line number
+	column        int          // current column number, in runes
+	linePositions []int        // tracks starting position of each line
+	errors        []string     // collect lexical errors
+	diagnostics   []Diagnostic // the same errors, with where they are
+
+	operators     map[string]bool // declared by the script
+	wholeOperator bool            // the next symbol run is one token
+
+	// one entry per ${ still open, how many { inside it are too. the
+	// } that closes it goes back to reading the string.
+	templates []int
 }
 
 func New(input string) *Lexer {
@@ -30,23 +42,66 @@ func New(input string) *Lexer {
 	return l
 }
 
+// NewAt lexes input from offset on. offset has to be where a token
+// can start outside of any string, like the start of a top level
+// statement. lines and columns still count from the start of input.
+func NewAt(input string, offset int) *Lexer {
+	l := &Lexer{
+		input:         input,
+		line:          1,
+		linePositions: []int{0},
+		errors:        []string{},
+		readPosition:  offset,
+	}
+	for i := 0; i < offset; i++ {
+		if input[i] == '\n' {
+			l.line++
+			l.linePositions = append(l.linePositions, i+1)
+		}
+	}
+	l.column = utf8.RuneCountInString(input[l.linePositions[len(l.linePositions)-1]:offset])
+	l.readChar()
+	return l
+}
+
+// reads the rune after the current one. source is UTF-8, a byte
+// that does not decode is an error at where it is and reads as
+// utf8.RuneError.
 func (l *Lexer) readChar() {
 	// Check for newline to track line numbers
 	if l.ch == '\n' {
 		l.line++
 		l.column = 0
-		l.linePositions = append(l.linePositions, l.readPosition+1)
+		l.linePositions = append(l.linePositions, l.readPosition)
 	}
 
-	// check EOF
+	// check EOF, which stays at the end of input however often it
+	// is read past
 	if l.readPosition >= len(l.input) {
 		l.ch = 0 // ASCII NUL char
-	} else {
-		l.ch = l.input[l.readPosition]
-		l.column++
+		l.position = len(l.input)
+		l.readPosition = len(l.input) + 1
+		return
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	ch, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	l.ch = ch
+	l.column++
+	l.readPosition += width
+	if l.invalid() {
+		l.errorAt(l.position, "invalid UTF-8 byte 0x%02x", l.input[l.position])
+	}
+}
+
+// whether the 0 in l.ch is the end of input rather than a NUL byte
+func (l *Lexer) atEOF() bool {
+	return l.position >= len(l.input)
+}
+
+// whether the current char is a byte that is not UTF-8, rather than
+// a U+FFFD written out in the source
+func (l *Lexer) invalid() bool {
+	return l.ch == utf8.RuneError && l.readPosition-l.position == 1
 }
 
 // Get line number for a given position
@@ -66,7 +121,7 @@ func (l *Lexer) GetLineNumber(position int) int {
 	return lineNum
 }
 
-func newToken(tokenType token.TokenType, ch byte, position int) token.Token {
+func newToken(tokenType token.TokenType, ch rune, position int) token.Token {
 	return token.Token{
 		Type:     tokenType,
 		Literal:  string(ch),
@@ -79,27 +134,6 @@ func (l *Lexer) NextToken() token.Token {
 	l.eatWhitespace()
 
 	switch l.ch {
-	case '=':
-		// check for EQ
-		if l.peekChar() == '=' {
-			ch := l.ch
-			pos := l.position
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.EQ, Literal: literal, Position: pos}
-		} else {
-			tok = newToken(token.ASSIGN, l.ch, l.position)
-		}
-	case '!':
-		if l.peekChar() == '=' {
-			ch := l.ch
-			pos := l.position
-			l.readChar()
-			literal := string(ch) + string(l.ch)
-			tok = token.Token{Type: token.NOT_EQ, Literal: literal, Position: pos}
-		} else {
-			tok = newToken(token.BANG, l.ch, l.position)
-		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch, l.position)
 	case '(':
@@ -108,28 +142,66 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.RPAREN, l.ch, l.position)
 	case ',':
 		tok = newToken(token.COMMA, l.ch, l.position)
-	case '+':
-		tok = newToken(token.PLUS, l.ch, l.position)
-	case '-':
-		tok = newToken(token.MINUS, l.ch, l.position)
-	case '/':
-		tok = newToken(token.SLASH, l.ch, l.position)
-	case '*':
-		tok = newToken(token.ASTERISK, l.ch, l.position)
-	case '<':
-		tok = newToken(token.LT, l.ch, l.position)
-	case '>':
-		tok = newToken(token.GT, l.ch, l.position)
+	case '.':
+		if strings.HasPrefix(l.input[l.position:], "...") {
+			tok = token.Token{Type: token.ELLIPSIS, Literal: "...", Position: l.position}
+			l.readChar()
+			l.readChar()
+		} else {
+			tok = newToken(token.DOT, l.ch, l.position)
+		}
+	case ':':
+		tok = newToken(token.COLON, l.ch, l.position)
+	case '[':
+		tok = newToken(token.LBRACKET, l.ch, l.position)
+	case ']':
+		tok = newToken(token.RBRACKET, l.ch, l.position)
+	case '"':
+		pos := l.position
+		tok.Type = token.STRING
+		tok.Literal = l.readString()
+		if l.ch == '{' {
+			tok.Type = token.TEMPLATE_START
+			l.templates = append(l.templates, 0)
+		}
+		tok.Position = pos
 	case '{':
 		tok = newToken(token.LBRACE, l.ch, l.position)
+		if n := len(l.templates); n > 0 {
+			l.templates[n-1]++
+		}
 	case '}':
+		n := len(l.templates)
+		if n > 0 && l.templates[n-1] == 0 {
+			// the end of a ${...}, the string goes on
+			l.templates = l.templates[:n-1]
+			pos := l.position
+			tok.Type = token.TEMPLATE_END
+			tok.Literal = l.readString()
+			if l.ch == '{' {
+				tok.Type = token.TEMPLATE_MIDDLE
+				l.templates = append(l.templates, 0)
+			}
+			tok.Position = pos
+			break
+		}
+		if n > 0 {
+			l.templates[n-1]--
+		}
 		tok = newToken(token.RBRACE, l.ch, l.position)
 	case 0:
+		if !l.atEOF() {
+			tok = newToken(token.ILLEGAL, l.ch, l.position)
+			l.errorAt(l.position, "illegal NUL byte found")
+			break
+		}
 		tok.Literal = ""
 		tok.Type = token.EOF
 		tok.Position = l.position
 	default:
-		if isLetter(l.ch) {
+		if isSymbol(l.ch) {
+			tok = l.readOperator()
+		} else if isLetter(l.ch) {
 			pos := l.position
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
@@ -141,10 +213,12 @@ func (l *Lexer) NextToken() token.Token {
 			tok.Literal = l.readNumber()
 			tok.Position = pos
 			return tok
+		} else if l.invalid() {
+			// already reported by readChar
+			tok = token.Token{Type: token.ILLEGAL, Literal: l.input[l.position:l.readPosition], Position: l.position}
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch, l.position)
-			l.addError(fmt.Sprintf("Line %d, Column %d: illegal character '%c' found",
-				l.line, l.column, l.ch))
+			l.errorAt(l.position, "illegal character '%c' found", l.ch)
 		}
 	}
 	l.readChar()
@@ -160,12 +234,113 @@ func (l *Lexer) eatWhitespace() {
 // advances lexer from curr position to next any valid letter
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isIdentifierPart(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
+// reads a double quoted string, l.ch is left on the closing quote,
+// or on the { of a ${ that starts an interpolation. supports the
+// usual \n, \t, \" and \\ escapes, and \$ for a $ that is not one.
+func (l *Lexer) readString() string {
+	var out strings.Builder
+	start := l.position
+	for {
+		l.readChar()
+		switch l.ch {
+		case '"':
+			return out.String()
+		case '$':
+			if l.peekChar() == '{' {
+				l.readChar()
+				return out.String()
+			}
+			out.WriteRune(l.ch)
+		case 0:
+			if !l.atEOF() {
+				out.WriteByte(0)
+				continue
+			}
+			l.errorAt(start, "unterminated string literal")
+			return out.String()
+		case '\\':
+			l.readChar()
+			switch l.ch {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case '"', '\\', '$':
+				out.WriteRune(l.ch)
+			case 0:
+				if !l.atEOF() {
+					l.errorAt(l.position, "unknown escape sequence '\\x00'")
+					continue
+				}
+				l.errorAt(start, "unterminated string literal")
+				return out.String()
+			default:
+				l.errorAt(l.position, "unknown escape sequence '\\%c'", l.ch)
+			}
+		default:
+			out.WriteString(l.input[l.position:l.readPosition])
+		}
+	}
+}
+
+// DeclareOperator makes op a token of its own from here on, so that
+// a<+>b is not read as a < +> b.
+func (l *Lexer) DeclareOperator(op string) {
+	if l.operators == nil {
+		l.operators = make(map[string]bool)
+	}
+	l.operators[op] = true
+}
+
+// ExpectOperator reads the next run of symbols as one token, whatever
+// operators it starts with. the run is an operator being declared.
+func (l *Lexer) ExpectOperator() {
+	l.wholeOperator = true
+}
+
+// a run of symbols is split into the longest operators known, built
+// in or declared. a run that starts with none of them is a single
+// OPERATOR, the parser reports it if it was never declared.
+// l.ch is left on the last character of the operator.
+func (l *Lexer) readOperator() token.Token {
+	pos := l.position
+	end := pos
+	for end < len(l.input) && isSymbol(rune(l.input[end])) {
+		end++
+	}
+	run := l.input[pos:end]
+
+	n := len(run)
+	if !l.wholeOperator {
+		for n > 0 {
+			if _, ok := token.LookupOperator(run[:n]); ok || l.operators[run[:n]] {
+				break
+			}
+			n--
+		}
+		if n == 0 {
+			n = len(run)
+		}
+	}
+	l.wholeOperator = false
+
+	literal := run[:n]
+	tokenType, ok := token.LookupOperator(literal)
+	if !ok {
+		tokenType = token.OPERATOR
+	}
+	for i := 1; i < n; i++ {
+		l.readChar()
+	}
+	return token.Token{Type: tokenType, Literal: literal, Position: pos}
+}
+
 func (l *Lexer) readNumber() string {
 	position := l.position
 	for isDigit(l.ch) {
@@ -174,25 +349,76 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
-// TODO: safe place to playaround with any symbols in keyword
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '~'
+// identifiers start with a letter of any script, _ or ~, and go on
+// with those and the combining marks that letters can carry, so that
+// café is one name however its é is written. digits are not part of
+// identifiers, in any script.
+func isLetter(ch rune) bool {
+	if ch < utf8.RuneSelf {
+		return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || ch == '~'
+	}
+	return unicode.IsLetter(ch)
+}
+
+func isIdentifierPart(ch rune) bool {
+	return isLetter(ch) || ch >= utf8.RuneSelf && unicode.In(ch, unicode.Mn, unicode.Mc)
 }
 
-func isDigit(ch byte) bool {
+func isSymbol(ch rune) bool {
+	return ch != 0 && ch < utf8.RuneSelf && strings.IndexByte("!#$%&*+-/<=>?@^|", byte(ch)) >= 0
+}
+
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
 // similar to readChar except it doesnt increment l.position
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
-	} else {
-		return l.input[l.readPosition]
 	}
+	ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+	return ch
 }
 
 // Error handling methods
+
+// Diagnostic is a lexical error and where in the input it is.
+type Diagnostic struct {
+	Location
+	Message string
+}
+
+// Location is where a byte offset of the input is. Column counts
+// runes, UTF16Column counts UTF-16 code units the way LSP clients
+// and javascript strings do. all three are 1-based.
+type Location struct {
+	Offset      int
+	Line        int
+	Column      int
+	UTF16Column int
+}
+
+// Locate finds offset in the part of the input read so far, which
+// after the parser is done is all of it.
+func (l *Lexer) Locate(offset int) Location {
+	offset = max(0, min(offset, len(l.input)))
+	line := sort.SearchInts(l.linePositions, offset+1)
+	loc := Location{Offset: offset, Line: line, Column: 1, UTF16Column: 1}
+	for _, r := range l.input[l.linePositions[line-1]:offset] {
+		loc.Column++
+		loc.UTF16Column += utf16.RuneLen(r)
+	}
+	return loc
+}
+
+func (l *Lexer) errorAt(offset int, format string, a ...interface{}) {
+	loc := l.Locate(offset)
+	msg := fmt.Sprintf(format, a...)
+	l.addError(fmt.Sprintf("Line %d, Column %d: %s", loc.Line, loc.Column, msg))
+	l.diagnostics = append(l.diagnostics, Diagnostic{Location: loc, Message: msg})
+}
+
 func (l *Lexer) addError(msg string) {
 	l.errors = append(l.errors, msg)
 }
@@ -201,6 +427,11 @@ func (l *Lexer) Errors() []string {
 	return l.errors
 }
 
+// Diagnostics are the Errors with their locations.
+func (l *Lexer) Diagnostics() []Diagnostic {
+	return l.diagnostics
+}
+
 func (l *Lexer) HasErrors() bool {
 	return len(l.errors) > 0
 }
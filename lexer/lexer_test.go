@@ -120,3 +120,310 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestStringAndModuleTokens(t *testing.T) {
+	input := `import "lib/math.sb" as m;
+		export sup greeting = "hi \"bud\"\n";
+		m.add(1, 2);`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IMPORT, "import"},
+		{token.STRING, "lib/math.sb"},
+		{token.AS, "as"},
+		{token.IDENT, "m"},
+		{token.SEMICOLON, ";"},
+		{token.EXPORT, "export"},
+		{token.LET, "sup"},
+		{token.IDENT, "greeting"},
+		{token.ASSIGN, "="},
+		{token.STRING, "hi \"bud\"\n"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "m"},
+		{token.DOT, "."},
+		{token.IDENT, "add"},
+		{token.LPAREN, "("},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RPAREN, ")"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+	if l.HasErrors() {
+		t.Fatalf("unexpected lexer errors: %v", l.Errors())
+	}
+}
+
+func TestUnterminatedString(t *testing.T) {
+	l := New(`sup x = "oops;`)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+	if !l.HasErrors() {
+		t.Fatalf("expected an unterminated string error")
+	}
+}
+
+func TestOperatorRuns(t *testing.T) {
+	l := New(`infixl 6 <+> = f; a<+>b; a<+b; a*-b ?? c !== d;`)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.INFIXL, "infixl"},
+		{token.INT, "6"},
+		{token.OPERATOR, "<+>"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "f"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.OPERATOR, "<+>"},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.LT, "<"},
+		{token.PLUS, "+"},
+		{token.IDENT, "b"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.ASTERISK, "*"},
+		{token.MINUS, "-"},
+		{token.IDENT, "b"},
+		{token.OPERATOR, "??"},
+		{token.IDENT, "c"},
+		{token.NOT_EQ, "!="},
+		{token.ASSIGN, "="},
+		{token.IDENT, "d"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		// what the parser does once it sees the declaration
+		if i == 1 {
+			l.ExpectOperator()
+		}
+		tok := l.NextToken()
+		if i == 2 {
+			l.DeclareOperator(tok.Literal)
+		}
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestMatchTokens(t *testing.T) {
+	l := New(`match xs { [a, ...rest] => a, _ => m.x }`)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.MATCH, "match"},
+		{token.IDENT, "xs"},
+		{token.LBRACE, "{"},
+		{token.LBRACKET, "["},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.ELLIPSIS, "..."},
+		{token.IDENT, "rest"},
+		{token.RBRACKET, "]"},
+		{token.FAT_ARROW, "=>"},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "_"},
+		{token.FAT_ARROW, "=>"},
+		{token.IDENT, "m"},
+		{token.DOT, "."},
+		{token.IDENT, "x"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTemplateTokens(t *testing.T) {
+	l := New(`"a ${x} b ${ {"k": 1}["k"] } c" "\${x}" "${y}"`)
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.TEMPLATE_START, "a "},
+		{token.IDENT, "x"},
+		{token.TEMPLATE_MIDDLE, " b "},
+		{token.LBRACE, "{"},
+		{token.STRING, "k"},
+		{token.COLON, ":"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.LBRACKET, "["},
+		{token.STRING, "k"},
+		{token.RBRACKET, "]"},
+		{token.TEMPLATE_END, " c"},
+		{token.STRING, "${x}"},
+		{token.TEMPLATE_START, ""},
+		{token.IDENT, "y"},
+		{token.TEMPLATE_END, ""},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestUnicode(t *testing.T) {
+	l := New("sup café = \"naïve ☃\";\nsup 名前 = cafe\u0301 + Ωmega;")
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "sup"},
+		{token.IDENT, "café"},
+		{token.ASSIGN, "="},
+		{token.STRING, "naïve ☃"},
+		{token.SEMICOLON, ";"},
+		{token.LET, "sup"},
+		{token.IDENT, "名前"},
+		{token.ASSIGN, "="},
+		{token.IDENT, "cafe\u0301"}, // e and a combining acute
+		{token.PLUS, "+"},
+		{token.IDENT, "Ωmega"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+	if l.HasErrors() {
+		t.Fatalf("unexpected lexer errors: %v", l.Errors())
+	}
+}
+
+func TestUnicodeErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		column   int // in UTF-16 units
+	}{
+		{"sup é = 1;\n  é§", "Line 2, Column 4: illegal character '§' found", 4},
+		{"sup s = \"😀\"; §", "Line 1, Column 14: illegal character '§' found", 15},
+		{"x٣", "Line 1, Column 2: illegal character '٣' found", 2},
+		{"sup x = \"a\xffb\";", "Line 1, Column 11: invalid UTF-8 byte 0xff", 11},
+		{"sup \xc3 = 1;", "Line 1, Column 5: invalid UTF-8 byte 0xc3", 5},
+		{"\"ü\\q\"", "Line 1, Column 4: unknown escape sequence '\\q'", 4},
+		{"sup x = 1;\n\"añ", "Line 2, Column 1: unterminated string literal", 1},
+	}
+
+	for _, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		if len(l.Errors()) != 1 || l.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected=%q, got=%q", tt.input, tt.expected, l.Errors())
+			continue
+		}
+		if d := l.Diagnostics()[0]; d.UTF16Column != tt.column {
+			t.Errorf("wrong UTF-16 column for %q. expected=%d, got=%d", tt.input, tt.column, d.UTF16Column)
+		}
+	}
+}
+
+func TestLocate(t *testing.T) {
+	input := "a\nb😀c\n"
+	l := New(input)
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	tests := []struct {
+		offset   int
+		expected Location
+	}{
+		{0, Location{Offset: 0, Line: 1, Column: 1, UTF16Column: 1}},
+		{2, Location{Offset: 2, Line: 2, Column: 1, UTF16Column: 1}},
+		{7, Location{Offset: 7, Line: 2, Column: 3, UTF16Column: 4}},
+		{9, Location{Offset: 9, Line: 3, Column: 1, UTF16Column: 1}},
+	}
+	for _, tt := range tests {
+		if got := l.Locate(tt.offset); got != tt.expected {
+			t.Errorf("Locate(%d) = %+v, want %+v", tt.offset, got, tt.expected)
+		}
+	}
+	if line := l.GetLineNumber(2); line != 2 {
+		t.Errorf("the first char of line 2 is on line %d", line)
+	}
+}
+
+func TestNulIsNotEOF(t *testing.T) {
+	l := New("a\x00b \"c\x00d\"")
+	expected := []token.Token{
+		{Type: token.IDENT, Literal: "a", Position: 0},
+		{Type: token.ILLEGAL, Literal: "\x00", Position: 1},
+		{Type: token.IDENT, Literal: "b", Position: 2},
+		{Type: token.STRING, Literal: "c\x00d", Position: 4},
+		{Type: token.EOF, Literal: "", Position: 9},
+	}
+	for i, want := range expected {
+		if tok := l.NextToken(); tok != want {
+			t.Fatalf("tests[%d] - wrong token. expected=%+v, got=%+v", i, want, tok)
+		}
+	}
+	if len(l.Errors()) != 1 || l.Errors()[0] != "Line 1, Column 2: illegal NUL byte found" {
+		t.Errorf("wrong errors. got=%q", l.Errors())
+	}
+}
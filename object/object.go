@@ -2,8 +2,12 @@ package object
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/pro0o/sup-bud/ast"
 )
@@ -17,6 +21,17 @@ const (
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
 	ERROR_OBJ        = "ERROR"
 	FUNCTION_OBJ     = "FUNCTION"
+	STRING_OBJ       = "STRING"
+	MODULE_OBJ       = "MODULE"
+	BUILTIN_OBJ      = "BUILTIN"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	TASK_OBJ         = "TASK"
+	CHANNEL_OBJ      = "CHANNEL"
+	QUOTE_OBJ        = "QUOTE"
+	MACRO_OBJ        = "MACRO"
+	RECORD_TYPE_OBJ  = "RECORD_TYPE"
+	RECORD_OBJ       = "RECORD"
 )
 
 type Object interface {
@@ -40,6 +55,14 @@ type Boolean struct {
 func (b *Boolean) Type() ObjectType { return BOOLEAN_OBJ }
 func (b *Boolean) Inspect() string  { return fmt.Sprintf("%t", b.Value) }
 
+// str
+type String struct {
+	Value string
+}
+
+func (s *String) Type() ObjectType { return STRING_OBJ }
+func (s *String) Inspect() string  { return s.Value }
+
 // !?
 type Null struct{}
 
@@ -57,15 +80,23 @@ func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 // err handle
 type Error struct {
 	Message string
+	Span    ast.Span // where in the source it happened, empty if unknown
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
 func (e *Error) Inspect() string  { return "ERROR: " + e.Message }
 
 // env & its bindings
+// spawned tasks share closures, so the store is guarded
 type Environment struct {
+	mu    sync.RWMutex
 	store map[string]Object
 	outer *Environment
+
+	// call frames keep the bindings the resolver knows about in
+	// slots, store only holds whatever it did not see
+	scope *ast.Scope
+	slots []Object
 }
 
 func NewEnvironment() *Environment {
@@ -75,7 +106,9 @@ func NewEnvironment() *Environment {
 
 // env Wrappers
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
+	e.mu.RLock()
+	obj, ok := e.lookup(name)
+	e.mu.RUnlock()
 	// check extended env for given func name
 	// like variables scope
 	// If something is not found in the inner scope,
@@ -86,11 +119,92 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+func (e *Environment) lookup(name string) (Object, bool) {
+	if e.scope != nil {
+		if slot, ok := e.scope.Slots[name]; ok {
+			if obj := e.slots[slot]; obj != nil {
+				return fromSlot(obj), true
+			}
+			return nil, false
+		}
+	}
+	obj, ok := e.store[name]
+	return obj, ok
+}
+
 func (e *Environment) Set(name string, val Object) Object {
+	if e.scope != nil {
+		if slot, ok := e.scope.Slots[name]; ok {
+			return e.SetSlot(slot, name, val)
+		}
+	}
+	e.mu.Lock()
+	if e.store == nil {
+		e.store = make(map[string]Object)
+	}
 	e.store[name] = val
+	e.mu.Unlock()
+	return val
+}
+
+// Resolve looks up a name the resolver placed depth frames out.
+// slot -1 means a top level name, those are looked up by name.
+func (e *Environment) Resolve(depth, slot int, name string) (Object, bool) {
+	env := e
+	for ; depth > 0 && env.outer != nil; depth-- {
+		env = env.outer
+	}
+	if slot < 0 || env.scope == nil || slot >= len(env.slots) {
+		return env.Get(name)
+	}
+
+	env.mu.RLock()
+	obj := env.slots[slot]
+	env.mu.RUnlock()
+	if obj != nil {
+		return fromSlot(obj), true
+	}
+	// not bound in this frame yet, until it is the name
+	// still means whatever an outer scope binds
+	if env.outer == nil {
+		return nil, false
+	}
+	return env.outer.Get(name)
+}
+
+// SetSlot binds slot of this frame, name is only used when the
+// environment turns out not to be a frame.
+func (e *Environment) SetSlot(slot int, name string, val Object) Object {
+	if e.scope == nil || slot < 0 || slot >= len(e.slots) {
+		return e.Set(name, val)
+	}
+	e.mu.Lock()
+	e.slots[slot] = toSlot(val)
+	e.mu.Unlock()
 	return val
 }
 
+// Bindings copies what this environment itself binds, leaving out
+// outer ones. a name bound to a go nil maps to nil.
+func (e *Environment) Bindings() map[string]Object {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	out := make(map[string]Object, len(e.store)+len(e.slots))
+	for name, obj := range e.store {
+		out[name] = obj
+	}
+	if e.scope != nil {
+		for slot, obj := range e.slots {
+			if obj != nil {
+				out[e.scope.Names[slot]] = fromSlot(obj)
+			}
+		}
+	}
+	return out
+}
+
+func (e *Environment) Outer() *Environment { return e.outer }
+
 // extennsion of existing env such that
 // arguments can be accessed during call exp
 // thus, avoid the idea of overwriting the existing bindings.
@@ -100,21 +214,82 @@ func NewEnclosedEnvironment(outer *Environment) *Environment {
 	return env
 }
 
+// NewFrame is NewEnclosedEnvironment for a resolved call or select
+// case, with one slot per name in scope.
+func NewFrame(scope *ast.Scope, outer *Environment) *Environment {
+	return &Environment{
+		outer: outer,
+		scope: scope,
+		slots: make([]Object, len(scope.Names)),
+	}
+}
+
+// an empty slot means unbound, so a binding to a go nil, which only
+// a caller of SetSlot can make now that empty blocks are NULL, is
+// kept as nilBinding
+type nilSlot struct{}
+
+func (nilSlot) Type() ObjectType { return NULL_OBJ }
+func (nilSlot) Inspect() string  { return "null" }
+
+var nilBinding Object = nilSlot{}
+
+func toSlot(obj Object) Object {
+	if obj == nil {
+		return nilBinding
+	}
+	return obj
+}
+
+func fromSlot(obj Object) Object {
+	if obj == nilBinding {
+		return nil
+	}
+	return obj
+}
+
 // func
 type Function struct {
+	Name       string // set by the sup that first binds it
 	Parameters []*ast.Identifier
+	Patterns   []ast.Pattern // of parameters that destructure, see ast.FunctionLiteral
 	Body       *ast.BlockStatement
 	Env        *Environment // bud has its own env
+	Scope      *ast.Scope   // slots of a call frame, nil if unresolved
+	Position   int          // of the bud token, locates anonymous buds
 	// closures, env it access later
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
+
+// name used in call chains and reports
+func (f *Function) DisplayName() string {
+	if f.Name == "" {
+		return "<anonymous>"
+	}
+	return f.Name
+}
+
+// bud(a, b), for places where the whole body is too much
+func (f *Function) Signature() string {
+	return "bud(" + strings.Join(f.params(), ", ") + ")"
+}
+
+func (f *Function) params() []string {
+	params := make([]string, len(f.Parameters))
+	for i, p := range f.Parameters {
+		if i < len(f.Patterns) && f.Patterns[i] != nil {
+			params[i] = f.Patterns[i].String()
+			continue
+		}
+		params[i] = p.String()
+	}
+	return params
+}
+
 func (f *Function) Inspect() string {
 	var out bytes.Buffer
-	params := []string{}
-	for _, p := range f.Parameters {
-		params = append(params, p.String())
-	}
+	params := f.params()
 	out.WriteString("bud")
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
@@ -123,3 +298,202 @@ func (f *Function) Inspect() string {
 	out.WriteString("\n}")
 	return out.String()
 }
+
+// imported module, only its exported bindings are reachable
+type Module struct {
+	Path    string
+	Exports map[string]Object
+}
+
+func (m *Module) Type() ObjectType { return MODULE_OBJ }
+func (m *Module) Inspect() string {
+	names := make([]string, 0, len(m.Exports))
+	for name := range m.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return fmt.Sprintf("module(%q) { %s }", m.Path, strings.Join(names, ", "))
+}
+
+// go backed func, used for builtins and host functions
+type BuiltinFunction func(args ...Object) Object
+
+// a BuiltinFunction that also gets the context of the evaluation
+// making the call
+type BuiltinContextFunction func(ctx context.Context, args ...Object) Object
+
+type Builtin struct {
+	Name      string
+	Fn        BuiltinFunction
+	FnContext BuiltinContextFunction // called instead of Fn when set
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin " + b.Name }
+
+// arr
+type Array struct {
+	Elements []Object
+}
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+	elements := []string{}
+	for _, e := range a.Elements {
+		elements = append(elements, e.Inspect())
+	}
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+	return out.String()
+}
+
+// hash keys compare by value, not by pointer
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+}
+
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+	if b.Value {
+		value = 1
+	}
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (s *String) HashKey() HashKey {
+	h := fnv.New64a()
+	h.Write([]byte(s.Value))
+	return HashKey{Type: s.Type(), Value: h.Sum64()}
+}
+
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+type Hash struct {
+	Pairs map[HashKey]HashPair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+	pairs := []string{}
+	for _, pair := range h.Pairs {
+		pairs = append(pairs, pair.Key.Inspect()+": "+pair.Value.Inspect())
+	}
+	// map order is random, keep the output stable
+	sort.Strings(pairs)
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+	return out.String()
+}
+
+// handle returned by spawn, fields are guarded by the
+// scheduler of the evaluation that spawned it
+type Task struct {
+	ID     int
+	Done   bool
+	Result Object
+}
+
+func (t *Task) Type() ObjectType { return TASK_OBJ }
+func (t *Task) Inspect() string  { return fmt.Sprintf("task(%d)", t.ID) }
+
+// chan(n), same locking story as Task
+type Channel struct {
+	ID        int
+	Capacity  int
+	Buffer    []Object
+	Closed    bool
+	Receivers []*Receiver // receivers blocked on this channel, oldest first
+}
+
+// a task blocked in recv or select, a send on an unbuffered channel
+// hands its value straight to one. From is the channel the value came
+// over, nil while it waits.
+type Receiver struct {
+	Value Object
+	From  *Channel
+}
+
+func (c *Channel) Type() ObjectType { return CHANNEL_OBJ }
+func (c *Channel) Inspect() string  { return fmt.Sprintf("chan(%d)", c.Capacity) }
+
+// quote(expr), the unevaluated expression
+type Quote struct {
+	Node ast.Node
+}
+
+func (q *Quote) Type() ObjectType { return QUOTE_OBJ }
+func (q *Quote) Inspect() string  { return "QUOTE(" + q.Node.String() + ")" }
+
+// macro(a, b) { ... }, bound while macros are expanded
+type Macro struct {
+	Name       string
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+	Env        *Environment
+	Span       ast.Span // of the macro literal, what it introduces comes from in here
+}
+
+func (m *Macro) Type() ObjectType { return MACRO_OBJ }
+func (m *Macro) Inspect() string {
+	params := make([]string, len(m.Parameters))
+	for i, p := range m.Parameters {
+		params[i] = p.String()
+	}
+	return "macro(" + strings.Join(params, ", ") + ") {\n" + m.Body.String() + "\n}"
+}
+
+// record Point { x, y }, what the name Point is bound to
+type RecordType struct {
+	Name    string
+	Fields  []string
+	Methods map[string]*ast.FunctionLiteral
+	Scope   *ast.Scope   // the frame binding self, nil if unresolved
+	Env     *Environment // where the record was declared, methods close over it
+}
+
+func (rt *RecordType) Type() ObjectType { return RECORD_TYPE_OBJ }
+func (rt *RecordType) Inspect() string {
+	return "record " + rt.Name + " { " + strings.Join(rt.Fields, ", ") + " }"
+}
+
+// Field is the index of the field called name, -1 if there is none.
+func (rt *RecordType) Field(name string) int {
+	for i, field := range rt.Fields {
+		if field == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Point{x: 1, y: 2}, values line up with the fields of Def. records
+// are never changed, with makes a new one.
+type Record struct {
+	Def    *RecordType
+	Values []Object
+}
+
+func (r *Record) Type() ObjectType { return RECORD_OBJ }
+func (r *Record) Inspect() string {
+	fields := make([]string, len(r.Values))
+	for i, value := range r.Values {
+		fields[i] = r.Def.Fields[i] + ": " + value.Inspect()
+	}
+	return r.Def.Name + "{" + strings.Join(fields, ", ") + "}"
+}
@@ -0,0 +1,90 @@
+package optimize
+
+import (
+	"github.com/pro0o/sup-bud/ast"
+)
+
+// folds an operator applied to a literal, nil when it is not foldable.
+// mirrors evalPrefixExpression in eval.
+func foldPrefix(pe *ast.PrefixExpression) ast.Expression {
+	position := pe.Token.Position
+
+	switch pe.Operator {
+	case "!":
+		switch right := pe.Right.(type) {
+		case *ast.Boolean:
+			return booleanLiteral(!right.Value, position)
+		case *ast.IntegerLiteral, *ast.StringLiteral:
+			return booleanLiteral(false, position)
+		}
+	case "-":
+		if right, ok := pe.Right.(*ast.IntegerLiteral); ok {
+			return integerLiteral(-right.Value, position)
+		}
+	}
+	return nil
+}
+
+// folds an operator applied to two literals of the same type, nil when
+// it is not foldable or would fail at runtime. mirrors
+// evalInfixExpression in eval.
+func foldInfix(ie *ast.InfixExpression) ast.Expression {
+	pos := ie.Token.Position
+
+	switch left := ie.Left.(type) {
+	case *ast.IntegerLiteral:
+		right, ok := ie.Right.(*ast.IntegerLiteral)
+		if !ok {
+			return nil
+		}
+		l, r := left.Value, right.Value
+		switch ie.Operator {
+		case "+":
+			return integerLiteral(l+r, pos)
+		case "-":
+			return integerLiteral(l-r, pos)
+		case "*":
+			return integerLiteral(l*r, pos)
+		case "/":
+			if r == 0 {
+				return nil // still a runtime error
+			}
+			return integerLiteral(l/r, pos)
+		case "<":
+			return booleanLiteral(l < r, pos)
+		case ">":
+			return booleanLiteral(l > r, pos)
+		case "==":
+			return booleanLiteral(l == r, pos)
+		case "!=":
+			return booleanLiteral(l != r, pos)
+		}
+
+	case *ast.Boolean:
+		right, ok := ie.Right.(*ast.Boolean)
+		if !ok {
+			return nil
+		}
+		switch ie.Operator {
+		case "==":
+			return booleanLiteral(left.Value == right.Value, pos)
+		case "!=":
+			return booleanLiteral(left.Value != right.Value, pos)
+		}
+
+	case *ast.StringLiteral:
+		right, ok := ie.Right.(*ast.StringLiteral)
+		if !ok {
+			return nil
+		}
+		switch ie.Operator {
+		case "+":
+			return stringLiteral(left.Value+right.Value, pos)
+		case "==":
+			return booleanLiteral(left.Value == right.Value, pos)
+		case "!=":
+			return booleanLiteral(left.Value != right.Value, pos)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+// Package optimize rewrites a parsed program before evaluation.
+//
+// Three passes run together: constant arithmetic and boolean
+// expressions are folded, if expressions with a constant condition
+// lose their dead branch, and sup bindings of a literal are inlined
+// where they are referenced. Whatever could fail at runtime, like a
+// division by zero or a type mismatch, is left alone so the program
+// still fails the same way.
+//
+// Inlining assumes the program is the whole world: a name is only
+// inlined when the program binds it exactly once. Hosts that keep an
+// environment alive across runs and rebind names between them, like
+// a REPL, should not optimize.
+package optimize
+
+import (
+	"strconv"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/token"
+)
+
+type optimizer struct {
+	binders map[string]int            // how often each name is bound anywhere
+	consts  map[string]ast.Expression // literal bindings visible at this point
+}
+
+// Program optimizes program in place and returns it.
+func Program(program *ast.Program) *ast.Program {
+	o := &optimizer{
+		binders: make(map[string]int),
+		consts:  make(map[string]ast.Expression),
+	}
+	o.countBinders(program)
+	program.Statements = o.statements(program.Statements)
+	return program
+}
+
+// a statement list, the program or a block. constants bound here are
+// only visible to the statements after them, which is also the only
+// place the binding is guaranteed to have run.
+func (o *optimizer) statements(list []ast.Statement) []ast.Statement {
+	var bound []string
+	defer func() {
+		for _, name := range bound {
+			delete(o.consts, name)
+		}
+	}()
+
+	out := make([]ast.Statement, 0, len(list))
+	for i, stmt := range list {
+		stmt = o.statement(stmt)
+		last := i == len(list)-1
+
+		if es, ok := stmt.(*ast.ExpressionStatement); ok {
+			if ie, ok := es.Expression.(*ast.IfExpression); ok {
+				if branch, known := constantBranch(ie); known {
+					// blocks share the enclosing environment, so the
+					// surviving branch can be spliced in as is. as the
+					// list's value it has to end in an expression, a
+					// block ending in a statement is null and the list
+					// is not, so then the block itself stays.
+					if branch != nil && len(branch.Statements) > 0 {
+						if last && !endsInExpression(branch) {
+							out = append(out, branch)
+						} else {
+							out = append(out, branch.Statements...)
+						}
+						continue
+					}
+					if !last {
+						continue
+					}
+				}
+			}
+		}
+
+		if name, value, ok := o.literalBinding(stmt); ok {
+			o.consts[name] = value
+			bound = append(bound, name)
+		}
+		out = append(out, stmt)
+	}
+	return out
+}
+
+func (o *optimizer) literalBinding(stmt ast.Statement) (string, ast.Expression, bool) {
+	var let *ast.LetStatement
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		let = stmt
+	case *ast.ExportStatement:
+		let = stmt.Statement
+	default:
+		return "", nil, false
+	}
+	if let == nil || let.Name == nil || o.binders[let.Name.Value] != 1 || !isLiteral(let.Value) {
+		return "", nil, false
+	}
+	return let.Name.Value, let.Value, true
+}
+
+func (o *optimizer) statement(stmt ast.Statement) ast.Statement {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		if stmt != nil && stmt.Value != nil {
+			stmt.Value = o.expression(stmt.Value)
+		}
+	case *ast.DestructureStatement:
+		if stmt.Value != nil {
+			stmt.Value = o.expression(stmt.Value)
+		}
+	case *ast.ExportStatement:
+		if stmt.Statement != nil && stmt.Statement.Value != nil {
+			stmt.Statement.Value = o.expression(stmt.Statement.Value)
+		}
+	case *ast.ReturnStatement:
+		if stmt.ReturnValue != nil {
+			stmt.ReturnValue = o.expression(stmt.ReturnValue)
+		}
+	case *ast.ExpressionStatement:
+		if stmt.Expression != nil {
+			stmt.Expression = o.expression(stmt.Expression)
+		}
+	case *ast.BlockStatement:
+		o.block(stmt)
+	}
+	return stmt
+}
+
+func (o *optimizer) block(block *ast.BlockStatement) {
+	if block != nil {
+		block.Statements = o.statements(block.Statements)
+	}
+}
+
+func (o *optimizer) expressions(list []ast.Expression) {
+	for i, exp := range list {
+		list[i] = o.expression(exp)
+	}
+}
+
+func (o *optimizer) expression(exp ast.Expression) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		if value, ok := o.consts[exp.Value]; ok {
+			return copyLiteral(value, exp.Token.Position)
+		}
+
+	case *ast.PrefixExpression:
+		exp.Right = o.expression(exp.Right)
+		if folded := foldPrefix(exp); folded != nil {
+			return folded
+		}
+
+	case *ast.InfixExpression:
+		exp.Left = o.expression(exp.Left)
+		exp.Right = o.expression(exp.Right)
+		if folded := foldInfix(exp); folded != nil {
+			return folded
+		}
+
+	case *ast.IfExpression:
+		exp.Condition = o.expression(exp.Condition)
+		o.block(exp.Consequence)
+		o.block(exp.Alternative)
+		// in expression position a branch can only replace the if
+		// when it boils down to a single expression
+		if branch, known := constantBranch(exp); known && branch != nil && len(branch.Statements) == 1 {
+			if es, ok := branch.Statements[0].(*ast.ExpressionStatement); ok && es.Expression != nil {
+				return es.Expression
+			}
+		}
+
+	case *ast.FunctionLiteral:
+		o.block(exp.Body)
+
+	case *ast.CallExpression:
+		// quoted code is data, it has to stay as written
+		if id, ok := exp.Function.(*ast.Identifier); ok && id.Value == "quote" {
+			return exp
+		}
+		exp.Function = o.expression(exp.Function)
+		o.expressions(exp.Arguments)
+
+	case *ast.MemberExpression:
+		// the member name is not a reference
+		exp.Object = o.expression(exp.Object)
+
+	case *ast.ArrayLiteral:
+		o.expressions(exp.Elements)
+
+	case *ast.InterpolatedString:
+		o.expressions(exp.Values)
+
+	case *ast.IndexExpression:
+		exp.Left = o.expression(exp.Left)
+		exp.Index = o.expression(exp.Index)
+
+	case *ast.HashLiteral:
+		pairs := make(map[ast.Expression]ast.Expression, len(exp.Pairs))
+		for i, key := range exp.Keys {
+			value := o.expression(exp.Pairs[key])
+			key = o.expression(key)
+			exp.Keys[i] = key
+			pairs[key] = value
+		}
+		exp.Pairs = pairs
+
+	case *ast.SelectExpression:
+		for _, c := range exp.Cases {
+			c.Channel = o.expression(c.Channel)
+			if c.Value != nil {
+				c.Value = o.expression(c.Value)
+			}
+			o.block(c.Body)
+		}
+		o.block(exp.Default)
+
+	case *ast.MatchExpression:
+		// patterns are not expressions, only what they are tried on
+		exp.Subject = o.expression(exp.Subject)
+		for _, arm := range exp.Arms {
+			if arm.Guard != nil {
+				arm.Guard = o.expression(arm.Guard)
+			}
+			arm.Body = o.expression(arm.Body)
+		}
+
+	case *ast.RecordDefinition:
+		for _, method := range exp.Methods {
+			method.Value = o.expression(method.Value)
+		}
+
+	case *ast.RecordLiteral:
+		// field names are not references
+		exp.Type = o.expression(exp.Type)
+		o.expressions(exp.Values)
+
+	case *ast.WithExpression:
+		exp.Record = o.expression(exp.Record)
+		o.expressions(exp.Values)
+	}
+	return exp
+}
+
+// the branch an if with a literal condition always takes,
+// nil when it takes a missing else
+func constantBranch(ie *ast.IfExpression) (*ast.BlockStatement, bool) {
+	if !isLiteral(ie.Condition) {
+		return nil, false
+	}
+	// mirrors isTruthy in eval, every literal but false is truthy
+	if b, ok := ie.Condition.(*ast.Boolean); ok && !b.Value {
+		return ie.Alternative, true
+	}
+	return ie.Consequence, true
+}
+
+func endsInExpression(block *ast.BlockStatement) bool {
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ExpressionStatement)
+	return ok
+}
+
+func isLiteral(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IntegerLiteral, *ast.Boolean, *ast.StringLiteral:
+		return true
+	}
+	return false
+}
+
+func copyLiteral(exp ast.Expression, position int) ast.Expression {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return integerLiteral(exp.Value, position)
+	case *ast.Boolean:
+		return booleanLiteral(exp.Value, position)
+	case *ast.StringLiteral:
+		return stringLiteral(exp.Value, position)
+	}
+	return exp
+}
+
+func integerLiteral(value int64, position int) *ast.IntegerLiteral {
+	return &ast.IntegerLiteral{
+		Token: token.Token{Type: token.INT, Literal: strconv.FormatInt(value, 10), Position: position},
+		Value: value,
+	}
+}
+
+func booleanLiteral(value bool, position int) *ast.Boolean {
+	tok := token.Token{Type: token.FALSE, Literal: "false", Position: position}
+	if value {
+		tok = token.Token{Type: token.TRUE, Literal: "true", Position: position}
+	}
+	return &ast.Boolean{Token: tok, Value: value}
+}
+
+func stringLiteral(value string, position int) *ast.StringLiteral {
+	return &ast.StringLiteral{
+		Token: token.Token{Type: token.STRING, Literal: value, Position: position},
+		Value: value,
+	}
+}
+
+// counts every place a name gets bound, sup, parameters,
+// select bindings, patterns and import aliases alike
+func (o *optimizer) countBinders(node ast.Node) {
+	bind := func(name *ast.Identifier) {
+		if name != nil {
+			o.binders[name.Value]++
+		}
+	}
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement:
+			bind(node.Name)
+		case *ast.ImportStatement:
+			bind(node.Alias)
+		case *ast.DestructureStatement:
+			for _, name := range ast.Bindings(node.Pattern) {
+				bind(name)
+			}
+		case *ast.FunctionLiteral:
+			for _, param := range node.Parameters {
+				bind(param)
+			}
+			for _, pattern := range node.Patterns {
+				if pattern != nil {
+					for _, name := range ast.Bindings(pattern) {
+						bind(name)
+					}
+				}
+			}
+		case *ast.SelectCase:
+			bind(node.Binding)
+		case *ast.MatchArm:
+			for _, name := range ast.Bindings(node.Pattern) {
+				bind(name)
+			}
+		case *ast.RecordDefinition:
+			// methods bind self
+			o.binders["self"]++
+		}
+		return true
+	})
+}
@@ -0,0 +1,48 @@
+package optimize
+
+import (
+	"testing"
+
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/parser"
+)
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"2 * 3 + 4", "10"},
+		{"-(5 + 5)", "-10"},
+		{"!(1 < 2)", "false"},
+		{"true == !false", "true"},
+		{`"sup" + "-" + "bud"`, `"sup-bud"`},
+		{"1 / 0", "(1 / 0)"},
+		{"1 + true", "(1 + true)"},
+		{"sup x = 2 * 3; x + 4", "sup x = 6;10"},
+		{"sup x = 1; sup x = 2; x", "sup x = 1;sup x = 2;x"},
+		{"x; sup x = 1; x", "x;sup x = 1;1"},
+		{"sup x = 1; sup f = bud(x) { x }; f(x)", "sup x = 1;sup f = bud(x) { x };f(x)"},
+		{"sup n = 3; sup f = bud() { n * 2 }", "sup n = 3;sup f = bud() { 6 };"},
+		{"if (true) { 1 } else { 2 }", "1"},
+		{"if (1 > 2) { 1 } else { sup y = 2; y }", "sup y = 2;2"},
+		{"if (false) { 1 }; 5", "5"},
+		{"if (false) { 1 }", "if (false) { 1 }"},
+		{"if (true) { sup a = 1; }; 5", "sup a = 1;5"},
+		{"if (true) { sup a = 1; }", "sup a = 1;"},
+		{"sup v = if (true) { 1 } else { 2 }; v", "sup v = 1;1"},
+		{"m.x", "(m.x)"},
+		{"sup x = 1; {x: x}[x]", "sup x = 1;({1: 1}[1])"},
+	}
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := parser.New(l)
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("parser errors for %q: %v", tt.input, p.Errors())
+		}
+		if got := Program(program).String(); got != tt.expected {
+			t.Errorf("Program(%q) wrong. expected=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
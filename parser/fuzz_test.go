@@ -0,0 +1,32 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/pro0o/sup-bud/internal/seeds"
+	"github.com/pro0o/sup-bud/lexer"
+)
+
+// the parser does not panic on any input, and a program that parses
+// prints as source that parses to the same program
+func FuzzParser(f *testing.F) {
+	seeds.Add(f, "parser_test.go", "../lexer/lexer_test.go")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			return
+		}
+
+		printed := program.String()
+		p = New(lexer.New(printed))
+		reparsed := p.ParseProgram()
+		if len(p.Errors()) != 0 {
+			t.Fatalf("%q prints as %q, which does not parse: %v", input, printed, p.Errors())
+		}
+		if reparsed.String() != printed {
+			t.Fatalf("%q prints as %q, which prints as %q", input, printed, reparsed.String())
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/token"
+)
+
+// Edit replaces the Deleted bytes at Offset with Inserted, the way an
+// editor reports a change to its buffer.
+type Edit struct {
+	Offset   int
+	Deleted  int
+	Inserted string
+}
+
+// Document is a program kept parsed as its source is edited, for an
+// editor that wants the tree on every keystroke. an edit lexes and
+// parses again only the top level statements around it, the ones
+// after it are reused with their positions moved, and the result is
+// what parsing the whole source again would give.
+type Document struct {
+	src      string
+	program  *ast.Program
+	starts   []int // offset each top level statement starts at
+	errors   []string
+	warnings []warning
+
+	// declared operators change how everything after them lexes,
+	// a document with any is parsed whole every time
+	operators bool
+
+	reused int // statements the last edit did not parse again
+}
+
+// NewDocument parses src.
+func NewDocument(src string) *Document {
+	d := &Document{}
+	d.parse(src)
+	return d
+}
+
+func (d *Document) Source() string        { return d.src }
+func (d *Document) Program() *ast.Program { return d.program }
+func (d *Document) Errors() []string      { return d.errors }
+
+// Warnings are the parser's, see Parser.Warnings.
+func (d *Document) Warnings() []string {
+	var out []string
+	for _, w := range d.warnings {
+		line := strings.Count(d.src[:w.pos], "\n") + 1
+		out = append(out, fmt.Sprintf("Line %d: %s", line, w.msg))
+	}
+	return out
+}
+
+func (d *Document) parse(src string) {
+	p := New(lexer.New(src))
+	program := &ast.Program{}
+	if len(p.errors) == 0 {
+		program.Statements, d.starts = p.parseStatements(nil)
+	} else {
+		program.Statements, d.starts = []ast.Statement{}, nil
+	}
+	d.src = src
+	d.program = program
+	d.errors = p.Errors()
+	d.warnings = p.warnings
+	d.operators = len(p.operators) > 0
+	d.reused = 0
+}
+
+// Edit applies e to the source and brings the program up to date.
+// a Program from before the edit is left as it was.
+func (d *Document) Edit(e Edit) error {
+	if e.Offset < 0 || e.Deleted < 0 || e.Offset+e.Deleted > len(d.src) {
+		return fmt.Errorf("edit of %d bytes at %d is outside the %d byte source",
+			e.Deleted, e.Offset, len(d.src))
+	}
+	src := d.src[:e.Offset] + e.Inserted + d.src[e.Offset+e.Deleted:]
+	if len(d.errors) > 0 || d.operators {
+		d.parse(src)
+		return nil
+	}
+
+	// the statement the edit starts in is parsed again, and so is the
+	// one before it, which looked at the first token of that one to
+	// see where it ended
+	first := max(sort.SearchInts(d.starts, e.Offset+1)-2, 0)
+	begin := 0
+	if first > 0 {
+		begin = d.starts[first]
+	}
+
+	// the source from a statement that starts after the edit on is as
+	// it was, the statement is too when parsing gets to its start
+	delta := len(e.Inserted) - e.Deleted
+	next := sort.SearchInts(d.starts, e.Offset+e.Deleted)
+	p := New(lexer.NewAt(src, begin))
+	statements, starts := p.parseStatements(func(offset int) bool {
+		for next < len(d.starts) && d.starts[next]+delta < offset {
+			next++
+		}
+		return next < len(d.starts) && d.starts[next]+delta == offset
+	})
+	if len(p.errors) > 0 || len(p.operators) > 0 {
+		d.parse(src)
+		return nil
+	}
+	if p.curTokenIs(token.EOF) {
+		next = len(d.starts)
+	}
+
+	// the statements after the edit are copied rather than moved in
+	// place, whoever holds the old program keeps its positions
+	kept := make([]ast.Statement, 0, len(d.program.Statements)-next)
+	for _, stmt := range d.program.Statements[next:] {
+		if delta != 0 {
+			stmt = ast.Move(stmt, delta).(ast.Statement)
+		}
+		kept = append(kept, stmt)
+	}
+	program := &ast.Program{}
+	program.Statements = append(program.Statements, d.program.Statements[:first]...)
+	program.Statements = append(program.Statements, statements...)
+	program.Statements = append(program.Statements, kept...)
+
+	newStarts := append([]int{}, d.starts[:first]...)
+	newStarts = append(newStarts, starts...)
+	for _, start := range d.starts[next:] {
+		newStarts = append(newStarts, start+delta)
+	}
+
+	end := len(d.src) + 1 // where the kept statements start
+	if next < len(d.starts) {
+		end = d.starts[next]
+	}
+	var warnings []warning
+	for _, w := range d.warnings {
+		if w.pos < begin {
+			warnings = append(warnings, w)
+		}
+	}
+	warnings = append(warnings, p.warnings...)
+	for _, w := range d.warnings {
+		if w.pos >= end {
+			warnings = append(warnings, warning{w.pos + delta, w.msg})
+		}
+	}
+
+	d.src = src
+	d.program = program
+	d.starts = newStarts
+	d.warnings = warnings
+	d.reused = first + len(kept)
+	return nil
+}
@@ -0,0 +1,133 @@
+package parser
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pro0o/sup-bud/ast"
+)
+
+// doc has to hold what parsing its source from scratch gives, down
+// to the positions
+func checkDocument(t *testing.T, doc *Document) {
+	t.Helper()
+	full := NewDocument(doc.Source())
+	if strings.Join(doc.Errors(), "\n") != strings.Join(full.Errors(), "\n") {
+		t.Fatalf("wrong errors for %q.\ngot=%q\nwant=%q", doc.Source(), doc.Errors(), full.Errors())
+	}
+	if len(full.Errors()) != 0 {
+		return // a program with errors has holes Equal cannot look at
+	}
+	if strings.Join(doc.Warnings(), "\n") != strings.Join(full.Warnings(), "\n") {
+		t.Fatalf("wrong warnings for %q.\ngot=%q\nwant=%q", doc.Source(), doc.Warnings(), full.Warnings())
+	}
+	if !ast.Equal(doc.Program(), full.Program()) {
+		t.Fatalf("wrong program for %q.\ngot=%q\nwant=%q", doc.Source(), doc.Program(), full.Program())
+	}
+	got, err := ast.MarshalNode(doc.Program())
+	if err != nil {
+		return // too deep to encode, Equal has to do
+	}
+	want, _ := ast.MarshalNode(full.Program())
+	if !bytes.Equal(got, want) {
+		t.Fatalf("wrong positions for %q.\ngot=%s\nwant=%s", doc.Source(), got, want)
+	}
+}
+
+func TestDocumentEdit(t *testing.T) {
+	src := "sup a = 1;\nsup f = bud(x) { x + a };\nsup s = \"${a}\";\nf(s);\n"
+	tests := []struct {
+		edit     Edit
+		expected string
+		reused   int // statements the edit did not parse again
+	}{
+		{Edit{Offset: 8, Deleted: 1, Inserted: "42"}, "sup a = 42;sup f = bud(x) { (x + a) };sup s = \"${a}\";f(s)", 3},
+		{Edit{Offset: 32, Deleted: 1, Inserted: "x * 2"}, "sup a = 1;sup f = bud(x) { (x + (x * 2)) };sup s = \"${a}\";f(s)", 2},
+		{Edit{Offset: 0, Inserted: "sup z = 0;\n"}, "sup z = 0;sup a = 1;sup f = bud(x) { (x + a) };sup s = \"${a}\";f(s)", 4},
+		{Edit{Offset: 9, Deleted: 2}, "sup a = 1;sup f = bud(x) { (x + a) };sup s = \"${a}\";f(s)", 3},
+		// without its ; a statement runs on into the next
+		{Edit{Offset: 51, Deleted: 1, Inserted: " +"}, "sup a = 1;sup f = bud(x) { (x + a) };sup s = (\"${a}\" + f(s));", 1},
+		{Edit{Offset: 9, Deleted: 27}, "sup a = 1;sup s = \"${a}\";f(s)", 2},
+		{Edit{Offset: len(src), Inserted: "match true { true => 1 }"}, "sup a = 1;sup f = bud(x) { (x + a) };sup s = \"${a}\";f(s);match true { true => 1 }", 2},
+		{Edit{Offset: 46, Inserted: "s "}, "sup a = 1;sup f = bud(x) { (x + a) };sup s = \"s ${a}\";f(s)", 2},
+	}
+
+	for _, tt := range tests {
+		doc := NewDocument(src)
+		old := doc.Program()
+		oldJSON, _ := ast.MarshalNode(old)
+		if err := doc.Edit(tt.edit); err != nil {
+			t.Fatalf("edit %+v failed: %s", tt.edit, err)
+		}
+		checkDocument(t, doc)
+		if got := doc.Program().String(); got != tt.expected {
+			t.Errorf("wrong program after %+v. expected=%q, got=%q", tt.edit, tt.expected, got)
+		}
+		if doc.reused != tt.reused {
+			t.Errorf("edit %+v reused %d statements, want %d", tt.edit, doc.reused, tt.reused)
+		}
+		// the program from before the edit is as it was, positions too
+		if got, _ := ast.MarshalNode(old); !bytes.Equal(got, oldJSON) {
+			t.Errorf("edit %+v changed the program from before it", tt.edit)
+		}
+	}
+
+	doc := NewDocument("sup b = match x { true => 1 };\nsup c = 2;")
+	doc.Edit(Edit{Offset: 0, Inserted: "\n\n"})
+	checkDocument(t, doc)
+	if len(doc.Warnings()) != 1 || doc.Warnings()[0] != "Line 3: match on a boolean does not cover false" {
+		t.Errorf("warning not moved along. got=%q", doc.Warnings())
+	}
+
+	if err := doc.Edit(Edit{Offset: 5, Deleted: 100}); err == nil {
+		t.Errorf("an edit past the end of the source did not fail")
+	}
+}
+
+func TestDocumentEditSequence(t *testing.T) {
+	// typing a program out a character at a time, with mistakes
+	// along the way, then taking it apart again
+	final := "infixl 5 <+> = bud(a, b) { a + b };\nsup xs = [1, 2];\nsup [p, q] = xs;\n\"${p <+> q}\""
+	doc := NewDocument("")
+	for i, r := range final {
+		if err := doc.Edit(Edit{Offset: i, Inserted: string(r)}); err != nil {
+			t.Fatal(err)
+		}
+		checkDocument(t, doc)
+	}
+	for len(doc.Source()) > 0 {
+		doc.Edit(Edit{Offset: len(doc.Source()) / 2, Deleted: 1})
+		checkDocument(t, doc)
+	}
+}
+
+func FuzzDocumentEdit(f *testing.F) {
+	seeds := []string{
+		"sup a = 1;\nsup b = a + 2;\nb",
+		"sup f = bud(x) { x }; f(1)",
+		"a\nb\nc",
+		"sup s = \"${a} and ${ {\"k\": b}[\"k\"] }\";",
+		"match x { [a, ...r] => a, _ => 0 };\nrecord P { x } P{x: 1}",
+		"if (a) { b } else { c }; [1, 2][0]",
+	}
+	for _, seed := range seeds {
+		f.Add(seed, len(seed)/2, 1, ";")
+		f.Add(seed, 0, 0, "x")
+		f.Add(seed, len(seed), 0, "\n(")
+	}
+
+	f.Fuzz(func(t *testing.T, src string, offset, deleted int, inserted string) {
+		doc := NewDocument(src)
+		if offset < 0 || deleted < 0 || offset > len(src) || deleted > len(src)-offset {
+			if doc.Edit(Edit{Offset: offset, Deleted: deleted, Inserted: inserted}) == nil {
+				t.Fatalf("edit of %d at %d did not fail", deleted, offset)
+			}
+			return
+		}
+		if err := doc.Edit(Edit{Offset: offset, Deleted: deleted, Inserted: inserted}); err != nil {
+			t.Fatal(err)
+		}
+		checkDocument(t, doc)
+	})
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/pro0o/sup-bud/ast"
 	"github.com/pro0o/sup-bud/lexer"
@@ -16,12 +18,22 @@ type Parser struct {
 	curToken   token.Token
 	peekToken  token.Token
 	errors     []string
+	lexErrors  int // how many of the lexer's errors are in errors
+	warnings   []warning
 	lineErrors map[int][]string // Track errors by line number
 
+	// how many brackets deep curToken is, and the depth at which {
+	// may not start a record literal, as after match Point
+	depth      int
+	noRecordAt int
+
 	prefixParseFns map[token.TokenType]prefixParseFn // nuds <- null denotations
 	infixParseFns  map[token.TokenType]infixParseFn  // leds <- left denotations
-	debugMode      bool                              // New field for enabling debug output
-	depth          int
+
+	operators map[string]operator // declared with infixl and friends
+
+	tracer     Tracer
+	traceLevel int
 }
 
 type (
@@ -38,18 +50,26 @@ func (p *Parser) registerInfix(tokenType token.TokenType, bud infixParseFn) {
 }
 
 // operator precedence
-// _ ident being 0 to call being 7
+// ten times the level of a fixity declaration plus ten, so that
+// declared operators fit in between the built-in ones. + is at the
+// level of infixl 6, * at 7 and == at 4. prefix operators and calls
+// bind tighter than any declared operator.
 const (
-	_ int = iota
-	LOWEST
-	EQUALS      // ==
-	LESSGREATER // > or <
-	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -X or !X
-	CALL        // func(X)
+	LOWEST      = 1
+	EQUALS      = 50  // ==
+	LESSGREATER = 55  // > or <
+	SUM         = 70  // +
+	PRODUCT     = 80  // *
+	UPDATE      = 105 // r with {x: 1}
+	PREFIX      = 110 // -X or !X
+	CALL        = 120 // func(X) or Point{x: X}
+	MEMBER      = 130 // m.name
+	INDEX       = 140 // array[index]
 )
 
+// highest level a fixity declaration may give
+const maxOperatorLevel = 9
+
 var precedences = map[token.TokenType]int{
 	token.EQ:       EQUALS,
 	token.NOT_EQ:   EQUALS,
@@ -59,17 +79,17 @@ var precedences = map[token.TokenType]int{
 	token.MINUS:    SUM,
 	token.SLASH:    PRODUCT,
 	token.ASTERISK: PRODUCT,
+	token.WITH:     UPDATE,
 	token.LPAREN:   CALL,
+	token.LBRACE:   CALL,
+	token.DOT:      MEMBER,
+	token.LBRACKET: INDEX,
 }
 
-// Add new method to enable/disable debug mode
-func (p *Parser) SetDebugMode(enabled bool) {
-	p.debugMode = enabled
-}
-
-// Add helper for indentation
-func (p *Parser) indent() string {
-	return strings.Repeat("  ", p.depth)
+// an operator declared by the script
+type operator struct {
+	precedence int
+	fixity     token.TokenType // INFIX, INFIXL or INFIXR
 }
 
 func New(lex *lexer.Lexer) *Parser {
@@ -77,11 +97,14 @@ func New(lex *lexer.Lexer) *Parser {
 		l:          lex,
 		errors:     []string{},
 		lineErrors: make(map[int][]string),
+		operators:  make(map[string]operator),
+		noRecordAt: -1,
 	}
 
 	// Check if lexer has errors before proceeding
 	if lex.HasErrors() {
 		p.errors = append(p.errors, lex.Errors()...)
+		p.lexErrors = len(lex.Errors())
 	}
 
 	// fill in cur and peek token
@@ -92,6 +115,8 @@ func New(lex *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[token.TokenType]prefixParseFn)
 	p.registerPrefix(token.IDENT, p.parseIdentifier)
 	p.registerPrefix(token.INT, p.parseIntegerLiteral)
+	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE_START, p.parseInterpolatedString)
 	p.registerPrefix(token.BANG, p.parsePrefixExpression)
 	p.registerPrefix(token.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(token.TRUE, p.parseBoolean)
@@ -99,6 +124,11 @@ func New(lex *lexer.Lexer) *Parser {
 	p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+	p.registerPrefix(token.MACRO, p.parseMacroLiteral)
+	p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
+	p.registerPrefix(token.SELECT, p.parseSelectExpression)
+	p.registerPrefix(token.MATCH, p.parseMatchExpression)
 
 	// leds <- traversal
 	p.infixParseFns = make(map[token.TokenType]infixParseFn)
@@ -111,17 +141,32 @@ func New(lex *lexer.Lexer) *Parser {
 	p.registerInfix(token.LT, p.parseInfixExpression)
 	p.registerInfix(token.GT, p.parseInfixExpression)
 	p.registerInfix(token.LPAREN, p.parseCallExpression)
+	p.registerInfix(token.DOT, p.parseMemberExpression)
+	p.registerInfix(token.LBRACKET, p.parseIndexExpression)
+	p.registerInfix(token.LBRACE, p.parseRecordLiteral)
+	p.registerInfix(token.WITH, p.parseWithExpression)
+	p.registerInfix(token.OPERATOR, p.parseOperatorExpression)
 
 	return p
 }
 
 func (p *Parser) parseIdentifier() ast.Expression {
+	defer p.untrace(p.trace("parseIdentifier"))
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
 
 func (p *Parser) nextToken() {
+	switch p.curToken.Type {
+	case token.LPAREN, token.LBRACKET, token.LBRACE:
+		p.depth++
+	}
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+	switch p.curToken.Type {
+	case token.RPAREN, token.RBRACKET, token.RBRACE:
+		p.depth--
+	}
+	p.traceToken(p.curToken)
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -147,6 +192,23 @@ func (p *Parser) Errors() []string {
 	return p.errors
 }
 
+// Warnings are about programs that parse but likely do not do what
+// was meant, like a match on a boolean missing false.
+func (p *Parser) Warnings() []string {
+	var out []string
+	for _, w := range p.warnings {
+		out = append(out, fmt.Sprintf("Line %d: %s", p.l.GetLineNumber(w.pos), w.msg))
+	}
+	return out
+}
+
+// a warning is kept with where it is, a Document moves it along
+// with the statement it is in
+type warning struct {
+	pos int
+	msg string
+}
+
 // Enhanced error reporting with token line information
 func (p *Parser) peekError(t token.TokenType) {
 	line := p.l.GetLineNumber(p.peekToken.Position)
@@ -161,10 +223,8 @@ func (p *Parser) peekError(t token.TokenType) {
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
-	if p.debugMode {
-		fmt.Println("Starting program parse")
-	}
-
+	defer p.untrace(p.trace("ParseProgram"))
+	p.traceToken(p.curToken) // read by New, before there was a tracer
 	program := &ast.Program{}
 	program.Statements = []ast.Statement{}
 
@@ -173,41 +233,66 @@ func (p *Parser) ParseProgram() *ast.Program {
 		return program
 	}
 
+	program.Statements, _ = p.parseStatements(nil)
+	return program
+}
+
+// parses top level statements until EOF, or until stop, if given,
+// says to leave the statement starting at an offset unparsed. it
+// also returns the offset each statement starts at.
+func (p *Parser) parseStatements(stop func(offset int) bool) ([]ast.Statement, []int) {
+	statements := []ast.Statement{}
+	var starts []int
 	for p.curToken.Type != token.EOF {
-		if p.debugMode {
-			fmt.Printf("%sToken: %s (%s)\n", p.indent(), p.curToken.Type, p.curToken.Literal)
+		if stop != nil && stop(p.curToken.Position) {
+			break
 		}
-
+		start := p.curToken.Position
 		stmt := p.parseStatement()
 		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
-			if p.debugMode {
-				fmt.Printf("%sStatement AST: %s\n", p.indent(), stmt.String())
-			}
+			statements = append(statements, stmt)
+			starts = append(starts, start)
 		}
 		p.nextToken()
 	}
 
-	if p.debugMode {
-		fmt.Println("\nFull Program AST:")
-		fmt.Println(program.String())
+	// the lexer finds some mistakes, like bad UTF-8 in a string,
+	// without giving the parser a token it trips on
+	if late := p.l.Errors()[p.lexErrors:]; len(late) > 0 {
+		p.errors = append(p.errors, late...)
+		p.lexErrors += len(late)
 	}
-
-	return program
+	return statements, starts
 }
 
 func (p *Parser) parseStatement() ast.Statement {
+	defer p.untrace(p.trace("parseStatement"))
 	switch p.curToken.Type {
 	case token.LET:
+		if p.peekTokenIs(token.LBRACKET) || p.peekTokenIs(token.LBRACE) {
+			if stmt := p.parseDestructureStatement(); stmt != nil {
+				return stmt
+			}
+			return nil
+		}
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.IMPORT:
+		return p.parseImportStatement()
+	case token.EXPORT:
+		return p.parseExportStatement()
+	case token.INFIX, token.INFIXL, token.INFIXR:
+		return p.parseOperatorDeclaration()
+	case token.RECORD:
+		return p.parseRecordStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
 }
 
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+	defer p.untrace(p.trace("parseReturnStatement"))
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 	p.nextToken()
 
@@ -225,6 +310,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 }
 
 func (p *Parser) parseLetStatement() *ast.LetStatement {
+	defer p.untrace(p.trace("parseLetStatement"))
 	stmt := &ast.LetStatement{Token: p.curToken}
 
 	if !p.expectPeek(token.IDENT) {
@@ -233,6 +319,147 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		if stmt.Type = p.parseType(); stmt.Type == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// sup [a, ...rest] = xs; or sup {name, age} = h;
+func (p *Parser) parseDestructureStatement() *ast.DestructureStatement {
+	defer p.untrace(p.trace("parseDestructureStatement"))
+	stmt := &ast.DestructureStatement{Token: p.curToken}
+
+	p.nextToken()
+	if stmt.Pattern = p.parsePattern(); stmt.Pattern == nil || !p.uniqueBindings(stmt.Pattern) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		p.nextToken()
+		if stmt.Type = p.parseType(); stmt.Type == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// import "path/to/mod.sb" as m;
+func (p *Parser) parseImportStatement() ast.Statement {
+	defer p.untrace(p.trace("parseImportStatement"))
+	stmt := &ast.ImportStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+
+	if !p.expectPeek(token.AS) {
+		return nil
+	}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	stmt.Alias = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// export sup name = value; or export record Name { ... }
+func (p *Parser) parseExportStatement() ast.Statement {
+	defer p.untrace(p.trace("parseExportStatement"))
+	stmt := &ast.ExportStatement{Token: p.curToken}
+
+	if p.peekTokenIs(token.RECORD) {
+		p.nextToken()
+		stmt.Statement = p.parseRecordStatement()
+	} else {
+		if !p.expectPeek(token.LET) {
+			return nil
+		}
+		stmt.Statement = p.parseLetStatement()
+	}
+
+	if stmt.Statement == nil {
+		return nil
+	}
+	return stmt
+}
+
+// infixl 6 <+> = bud(a, b) { ... };
+// the operator can be used from here on, in its own body too.
+func (p *Parser) parseOperatorDeclaration() ast.Statement {
+	defer p.untrace(p.trace("parseOperatorDeclaration"))
+	stmt := &ast.LetStatement{Token: p.curToken}
+	line := p.l.GetLineNumber(p.curToken.Position)
+
+	// the token after the level, peek is the level already
+	p.l.ExpectOperator()
+	if !p.expectPeek(token.INT) {
+		return nil
+	}
+	level, err := strconv.Atoi(p.curToken.Literal)
+	if err != nil || level > maxOperatorLevel {
+		p.addError(fmt.Sprintf("Line %d: operator level must be 0 to %d, got %s",
+			line, maxOperatorLevel, p.curToken.Literal))
+		return nil
+	}
+	stmt.Precedence = level
+
+	p.nextToken()
+	op := p.curToken.Literal
+	if !p.curTokenIs(token.OPERATOR) {
+		if _, ok := token.LookupOperator(op); ok {
+			p.addError(fmt.Sprintf("Line %d: cannot redeclare built-in operator %s", line, op))
+		} else {
+			p.addError(fmt.Sprintf("Line %d: expected an operator to declare, got %s", line, p.curToken.Type))
+		}
+		return nil
+	}
+	if _, ok := p.operators[op]; ok {
+		p.addError(fmt.Sprintf("Line %d: operator %s is already declared", line, op))
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: op}
+
+	p.l.DeclareOperator(op)
+	p.operators[op] = operator{precedence: (level + 1) * 10, fixity: stmt.Token.Type}
+
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -247,7 +474,101 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
+// record Point { x, y; sup norm = bud() { ... }; }
+// bound like a sup of the name, methods come after the fields.
+func (p *Parser) parseRecordStatement() *ast.LetStatement {
+	defer p.untrace(p.trace("parseRecordStatement"))
+	def := &ast.RecordDefinition{Token: p.curToken}
+	stmt := &ast.LetStatement{Token: p.curToken, Value: def}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	line := p.l.GetLineNumber(p.curToken.Position)
+	if !isRecordName(p.curToken.Literal) {
+		p.addError(fmt.Sprintf("Line %d: record name must start with an upper case letter, got %s",
+			line, p.curToken.Literal))
+		return nil
+	}
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	def.Name = stmt.Name.Value
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	twice := func(name string) bool {
+		if seen[name] {
+			p.addError(fmt.Sprintf("Line %d: record %s has %s twice", line, def.Name, name))
+			return true
+		}
+		seen[name] = true
+		return false
+	}
+
+	for p.peekTokenIs(token.IDENT) {
+		p.nextToken()
+		field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if twice(field.Value) {
+			return nil
+		}
+		def.Fields = append(def.Fields, field)
+		if !p.peekTokenIs(token.COMMA) {
+			break
+		}
+		p.nextToken()
+	}
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+
+	for p.peekTokenIs(token.LET) {
+		p.nextToken()
+		method := p.parseLetStatement()
+		if method == nil {
+			return nil
+		}
+		if _, ok := method.Value.(*ast.FunctionLiteral); !ok {
+			p.addError(fmt.Sprintf("Line %d: method %s of %s must be a bud",
+				p.l.GetLineNumber(method.Token.Position), method.Name.Value, def.Name))
+			return nil
+		}
+		if twice(method.Name.Value) {
+			return nil
+		}
+		def.Methods = append(def.Methods, method)
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	if p.peekTokenIs(token.SEMICOLON) {
+		p.nextToken()
+	}
+	return stmt
+}
+
+// records are named like Point, which is what tells Point{x: 1}
+// apart from a name followed by a hash or a block
+func isRecordName(name string) bool {
+	r, _ := utf8.DecodeRuneInString(name)
+	return unicode.IsUpper(r)
+}
+
+func isRecordType(exp ast.Expression) bool {
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		return isRecordName(exp.Value)
+	case *ast.MemberExpression:
+		return isRecordName(exp.Member.Value)
+	}
+	return false
+}
+
 func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	defer p.untrace(p.trace("parseExpressionStatement"))
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
 	stmt.Expression = p.parseExpression(LOWEST)
@@ -265,6 +586,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
+	defer p.untrace(p.trace("parseExpression"))
 	// type assertion that if the curr token type prefix func exist in parser map.
 	prefix := p.prefixParseFns[p.curToken.Type]
 	if prefix == nil {
@@ -279,12 +601,17 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		return nil
 	}
 
-	for !p.peekTokenIs(token.SEMICOLON) && precedence < p.peekPrecedence() {
+	for !p.peekTokenIs(token.SEMICOLON) && p.binds(precedence) {
 		// type assertion that if the curr token type prefix func exist in parser map.
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
 		}
+		// { only goes on an expression as the start of a record
+		// literal, after anything else it starts something new
+		if p.peekTokenIs(token.LBRACE) && (!isRecordType(leftExp) || p.depth == p.noRecordAt) {
+			return leftExp
+		}
 
 		p.nextToken()
 
@@ -300,6 +627,7 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 }
 
 func (p *Parser) parsePrefixExpression() ast.Expression {
+	defer p.untrace(p.trace("parsePrefixExpression"))
 	// p.curToken is either of type token.BANG or token.MINUS
 	expression := &ast.PrefixExpression{
 		Token:    p.curToken,
@@ -322,6 +650,7 @@ func (p *Parser) parsePrefixExpression() ast.Expression {
 
 // string -> int64
 func (p *Parser) parseIntegerLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseIntegerLiteral"))
 	lit := &ast.IntegerLiteral{Token: p.curToken}
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 
@@ -339,25 +668,36 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
 	line := p.l.GetLineNumber(p.curToken.Position)
+	if t == token.OPERATOR {
+		p.addError(fmt.Sprintf("Line %d: unknown operator %s", line, p.curToken.Literal))
+		return
+	}
 	msg := fmt.Sprintf("Line %d: no prefix parse function for %s found", line, t)
 	p.addError(msg)
 }
 
 func (p *Parser) peekPrecedence() int {
-	if p, ok := precedences[p.peekToken.Type]; ok {
-		return p
-	}
-	return LOWEST
+	return p.precedence(p.peekToken)
 }
 
 func (p *Parser) curPrecedence() int {
-	if p, ok := precedences[p.curToken.Type]; ok {
+	return p.precedence(p.curToken)
+}
+
+func (p *Parser) precedence(tok token.Token) int {
+	if tok.Type == token.OPERATOR {
+		if op, ok := p.operators[tok.Literal]; ok {
+			return op.precedence
+		}
+	}
+	if p, ok := precedences[tok.Type]; ok {
 		return p
 	}
 	return LOWEST
 }
 
 func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseInfixExpression"))
 	expression := &ast.InfixExpression{
 		Token:    p.curToken,
 		Operator: p.curToken.Literal,
@@ -379,11 +719,112 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// a <+> b calls the function bound to <+> with a and b
+func (p *Parser) parseOperatorExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseOperatorExpression"))
+	op := p.operators[p.curToken.Literal]
+	exp := &ast.CallExpression{
+		Token:    p.curToken,
+		Function: &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal},
+	}
+
+	// one less lets the right side take an operator of the same level
+	precedence := op.precedence
+	if op.fixity == token.INFIXR {
+		precedence--
+	}
+	p.nextToken()
+
+	right := p.parseExpression(precedence)
+	if right == nil {
+		line := p.l.GetLineNumber(p.curToken.Position)
+		p.addError(fmt.Sprintf("Line %d: invalid right expression in operator '%s'",
+			line, exp.Token.Literal))
+		return nil
+	}
+
+	if p.peekChains(op) {
+		line := p.l.GetLineNumber(p.peekToken.Position)
+		p.addError(fmt.Sprintf("Line %d: cannot chain non-associative operators %s and %s, add parentheses",
+			line, exp.Token.Literal, p.peekToken.Literal))
+		// one error is enough for the chain. the rest of it is skipped
+		// and the call kept, so whatever the chain is part of parses
+		// on without piling up errors after this one
+		for p.peekChains(op) {
+			p.nextToken()
+			p.nextToken()
+			p.parseExpression(precedence)
+		}
+	}
+
+	exp.Arguments = []ast.Expression{left, right}
+	return exp
+}
+
+// a <=> b <=> c has no meaning when <=> was declared with infix
+func (p *Parser) peekChains(op operator) bool {
+	next, ok := p.operators[p.peekToken.Literal]
+	return ok && p.peekTokenIs(token.OPERATOR) && op.fixity == token.INFIX &&
+		next.fixity == token.INFIX && next.precedence == op.precedence
+}
+
+func (p *Parser) parseStringLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseStringLiteral"))
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
+// "a ${x} b", from the TEMPLATE_START
+func (p *Parser) parseInterpolatedString() ast.Expression {
+	defer p.untrace(p.trace("parseInterpolatedString"))
+	exp := &ast.InterpolatedString{Token: p.curToken, Parts: []string{p.curToken.Literal}}
+
+	for {
+		p.nextToken()
+		if p.curTokenIs(token.TEMPLATE_MIDDLE) || p.curTokenIs(token.TEMPLATE_END) {
+			line := p.l.GetLineNumber(p.curToken.Position)
+			p.addError(fmt.Sprintf("Line %d: empty ${} in string", line))
+			return nil
+		}
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil
+		}
+		exp.Values = append(exp.Values, value)
+
+		p.nextToken()
+		switch p.curToken.Type {
+		case token.TEMPLATE_MIDDLE:
+			exp.Parts = append(exp.Parts, p.curToken.Literal)
+		case token.TEMPLATE_END:
+			exp.Parts = append(exp.Parts, p.curToken.Literal)
+			return exp
+		default:
+			line := p.l.GetLineNumber(p.curToken.Position)
+			p.addError(fmt.Sprintf("Line %d: expected } to close ${ in string, got %s", line, p.curToken.Type))
+			return nil
+		}
+	}
+}
+
+func (p *Parser) parseMemberExpression(object ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseMemberExpression"))
+	exp := &ast.MemberExpression{Token: p.curToken, Object: object}
+
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+
+	exp.Member = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	return exp
+}
+
 func (p *Parser) parseBoolean() ast.Expression {
+	defer p.untrace(p.trace("parseBoolean"))
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
 }
 
 func (p *Parser) parseGroupedExpression() ast.Expression {
+	defer p.untrace(p.trace("parseGroupedExpression"))
 	p.nextToken()
 
 	exp := p.parseExpression(LOWEST)
@@ -400,12 +841,22 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 }
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
+	defer p.untrace(p.trace("parseBlockStatement"))
 	block := &ast.BlockStatement{Token: p.curToken}
 	block.Statements = []ast.Statement{}
 
 	p.nextToken()
 
 	for !p.curTokenIs(token.RBRACE) && !p.curTokenIs(token.EOF) {
+		// modules are resolved once per file and operators are
+		// declared for the rest of it, so keep them out of blocks
+		switch p.curToken.Type {
+		case token.IMPORT, token.EXPORT, token.INFIX, token.INFIXL, token.INFIXR:
+			line := p.l.GetLineNumber(p.curToken.Position)
+			p.addError(fmt.Sprintf("Line %d: %s is only allowed at the top level",
+				line, p.curToken.Literal))
+		}
+
 		stmt := p.parseStatement()
 		if stmt != nil {
 			block.Statements = append(block.Statements, stmt)
@@ -422,6 +873,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 }
 
 func (p *Parser) parseIfExpression() ast.Expression {
+	defer p.untrace(p.trace("parseIfExpression"))
 	expression := &ast.IfExpression{Token: p.curToken}
 
 	if !p.expectPeek(token.LPAREN) {
@@ -458,57 +910,553 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	return expression
 }
 
-func (p *Parser) parseFunctionLiteral() ast.Expression {
-	lit := &ast.FunctionLiteral{Token: p.curToken}
+func (p *Parser) parseSelectExpression() ast.Expression {
+	defer p.untrace(p.trace("parseSelectExpression"))
+	expression := &ast.SelectExpression{Token: p.curToken}
 
-	if !p.expectPeek(token.LPAREN) {
+	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
 
-	lit.Parameters = p.parseFunctionParameters()
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
 
-	if lit.Parameters == nil {
-		return nil
+		if p.curTokenIs(token.DEFAULT) {
+			if expression.Default != nil {
+				line := p.l.GetLineNumber(p.curToken.Position)
+				p.addError(fmt.Sprintf("Line %d: select has more than one default case", line))
+				return nil
+			}
+			if !p.expectPeek(token.LBRACE) {
+				return nil
+			}
+			expression.Default = p.parseBlockStatement()
+			continue
+		}
+
+		selectCase := p.parseSelectCase()
+		if selectCase == nil {
+			return nil
+		}
+		expression.Cases = append(expression.Cases, selectCase)
 	}
 
-	if !p.expectPeek(token.LBRACE) {
+	if !p.expectPeek(token.RBRACE) {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
-
-	return lit
+	return expression
 }
 
-func (p *Parser) parseFunctionParameters() []*ast.Identifier {
-	identifiers := []*ast.Identifier{}
+// recv(ch) as v { ... } or send(ch, value) { ... }
+func (p *Parser) parseSelectCase() *ast.SelectCase {
+	defer p.untrace(p.trace("parseSelectCase"))
+	selectCase := &ast.SelectCase{Token: p.curToken}
+	line := p.l.GetLineNumber(p.curToken.Position)
 
-	if p.peekTokenIs(token.RPAREN) {
-		p.nextToken()
-		return identifiers
+	if !p.curTokenIs(token.IDENT) || (p.curToken.Literal != "recv" && p.curToken.Literal != "send") {
+		p.addError(fmt.Sprintf("Line %d: select case must be recv, send or default, got %s",
+			line, p.curToken.Literal))
+		return nil
 	}
+	selectCase.Send = p.curToken.Literal == "send"
 
-	p.nextToken()
-
-	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
-	identifiers = append(identifiers, ident)
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
 
-	for p.peekTokenIs(token.COMMA) {
-		p.nextToken()
-		p.nextToken()
+	args := p.parseExpressionList(token.RPAREN)
+	if args == nil {
+		return nil
+	}
+
+	want := 1
+	if selectCase.Send {
+		want = 2
+	}
+	if len(args) != want {
+		p.addError(fmt.Sprintf("Line %d: %s in select takes %d arguments, got %d",
+			line, selectCase.Token.Literal, want, len(args)))
+		return nil
+	}
+	selectCase.Channel = args[0]
+	if selectCase.Send {
+		selectCase.Value = args[1]
+	}
+
+	if !selectCase.Send && p.peekTokenIs(token.AS) {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		selectCase.Binding = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	selectCase.Body = p.parseBlockStatement()
+
+	return selectCase
+}
+
+func (p *Parser) parseMatchExpression() ast.Expression {
+	defer p.untrace(p.trace("parseMatchExpression"))
+	expression := &ast.MatchExpression{Token: p.curToken}
+
+	// the { after the value starts the arms, match Point { ... } is
+	// not a record literal
+	p.nextToken()
+	outer := p.noRecordAt
+	p.noRecordAt = p.depth
+	expression.Subject = p.parseExpression(LOWEST)
+	p.noRecordAt = outer
+	if expression.Subject == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		arm := p.parseMatchArm()
+		if arm == nil {
+			return nil
+		}
+		expression.Arms = append(expression.Arms, arm)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	p.checkBooleanArms(expression)
+	return expression
+}
+
+// pattern if guard => body
+func (p *Parser) parseMatchArm() *ast.MatchArm {
+	defer p.untrace(p.trace("parseMatchArm"))
+	pattern := p.parsePattern()
+	if pattern == nil || !p.uniqueBindings(pattern) {
+		return nil
+	}
+
+	var guard ast.Expression
+	if p.peekTokenIs(token.IF) {
+		p.nextToken()
+		p.nextToken()
+		if guard = p.parseExpression(LOWEST); guard == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.FAT_ARROW) {
+		return nil
+	}
+	arm := &ast.MatchArm{Token: p.curToken, Pattern: pattern, Guard: guard}
+
+	p.nextToken()
+	if arm.Body = p.parseExpression(LOWEST); arm.Body == nil {
+		return nil
+	}
+	return arm
+}
+
+func (p *Parser) uniqueBindings(pattern ast.Pattern) bool {
+	seen := make(map[string]bool)
+	for _, name := range ast.Bindings(pattern) {
+		if seen[name.Value] {
+			line := p.l.GetLineNumber(name.Token.Position)
+			p.addError(fmt.Sprintf("Line %d: pattern binds %s twice", line, name.Value))
+			return false
+		}
+		seen[name.Value] = true
+	}
+	return true
+}
+
+func (p *Parser) parsePattern() ast.Pattern {
+	defer p.untrace(p.trace("parsePattern"))
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	case token.INT:
+		lit, _ := p.parseIntegerLiteral().(*ast.IntegerLiteral)
+		if lit == nil {
+			return nil
+		}
+		return lit
+	case token.MINUS:
+		// -1, the one place a literal is negative
+		minus := p.curToken
+		if !p.expectPeek(token.INT) {
+			return nil
+		}
+		lit, _ := p.parseIntegerLiteral().(*ast.IntegerLiteral)
+		if lit == nil {
+			return nil
+		}
+		lit.Token.Position = minus.Position
+		lit.Token.Literal = "-" + lit.Token.Literal
+		lit.Value = -lit.Value
+		return lit
+	case token.STRING:
+		return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	case token.TRUE, token.FALSE:
+		return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(token.TRUE)}
+	case token.LBRACKET:
+		return p.parseArrayPattern()
+	case token.LBRACE:
+		return p.parseHashPattern()
+	}
+	line := p.l.GetLineNumber(p.curToken.Position)
+	p.addError(fmt.Sprintf("Line %d: expected a pattern, got %s", line, p.curToken.Literal))
+	return nil
+}
+
+// [first, second, ...rest]
+func (p *Parser) parseArrayPattern() ast.Pattern {
+	defer p.untrace(p.trace("parseArrayPattern"))
+	pattern := &ast.ArrayPattern{Token: p.curToken, Elements: []ast.Pattern{}}
+
+	for !p.peekTokenIs(token.RBRACKET) {
+		p.nextToken()
+		if p.curTokenIs(token.ELLIPSIS) {
+			if !p.expectPeek(token.IDENT) {
+				return nil
+			}
+			pattern.Rest = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			if !p.peekTokenIs(token.RBRACKET) {
+				line := p.l.GetLineNumber(p.curToken.Position)
+				p.addError(fmt.Sprintf("Line %d: ...%s must come last in an array pattern",
+					line, pattern.Rest.Value))
+				return nil
+			}
+			break
+		}
+
+		el := p.parsePattern()
+		if el == nil {
+			return nil
+		}
+		pattern.Elements = append(pattern.Elements, el)
+
+		if !p.peekTokenIs(token.RBRACKET) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
+		return nil
+	}
+	return pattern
+}
+
+// {"kind": k, name}, the keys are literals
+func (p *Parser) parseHashPattern() ast.Pattern {
+	defer p.untrace(p.trace("parseHashPattern"))
+	pattern := &ast.HashPattern{Token: p.curToken}
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		switch {
+		case p.curTokenIs(token.IDENT) && !p.peekTokenIs(token.COLON):
+			name := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+			key := &ast.StringLiteral{Token: token.Token{
+				Type:     token.STRING,
+				Literal:  name.Value,
+				Position: p.curToken.Position,
+			}, Value: name.Value}
+			pattern.Keys = append(pattern.Keys, key)
+			pattern.Values = append(pattern.Values, name)
+		case p.curTokenIs(token.IDENT), p.curTokenIs(token.LBRACKET), p.curTokenIs(token.LBRACE):
+			line := p.l.GetLineNumber(p.curToken.Position)
+			p.addError(fmt.Sprintf("Line %d: hash pattern key must be a literal, got %s",
+				line, p.curToken.Literal))
+			return nil
+		default:
+			key, ok := p.parsePattern().(ast.Expression)
+			if !ok || !p.expectPeek(token.COLON) {
+				return nil
+			}
+			p.nextToken()
+			value := p.parsePattern()
+			if value == nil {
+				return nil
+			}
+			pattern.Keys = append(pattern.Keys, key)
+			pattern.Values = append(pattern.Values, value)
+		}
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+	return pattern
+}
+
+// warns about a match whose arms test for true or false but not both,
+// with nothing after to take the other
+func (p *Parser) checkBooleanArms(expression *ast.MatchExpression) {
+	covered := map[bool]bool{}
+	boolean := false
+	for _, arm := range expression.Arms {
+		switch pattern := arm.Pattern.(type) {
+		case *ast.Boolean:
+			boolean = true
+			if arm.Guard == nil {
+				covered[pattern.Value] = true
+			}
+		case *ast.Identifier:
+			if arm.Guard == nil {
+				return
+			}
+		}
+	}
+	if !boolean {
+		return
+	}
+	for _, value := range []bool{true, false} {
+		if !covered[value] {
+			p.warnings = append(p.warnings, warning{expression.Token.Position,
+				fmt.Sprintf("match on a boolean does not cover %t", value)})
+		}
+	}
+}
+
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseFunctionLiteral"))
+	lit := &ast.FunctionLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters, lit.ParameterTypes, lit.Patterns = p.parseFunctionParameters()
+
+	if lit.Parameters == nil {
+		return nil
+	}
+
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken()
+		if lit.ReturnType = p.parseType(); lit.ReturnType == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseMacroLiteral"))
+	lit := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	var types []*ast.TypeExpression
+	var patterns []ast.Pattern
+	lit.Parameters, types, patterns = p.parseFunctionParameters()
+
+	if lit.Parameters == nil {
+		return nil
+	}
+	if types != nil {
+		line := p.l.GetLineNumber(lit.Token.Position)
+		p.addError(fmt.Sprintf("Line %d: macro parameters cannot have types", line))
+		return nil
+	}
+	if patterns != nil {
+		line := p.l.GetLineNumber(lit.Token.Position)
+		p.addError(fmt.Sprintf("Line %d: macro parameters cannot be patterns", line))
+		return nil
+	}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseBlockStatement()
+
+	return lit
+}
+
+// the parameters, their types and their patterns, the last two are
+// nil when no parameter has one
+func (p *Parser) parseFunctionParameters() ([]*ast.Identifier, []*ast.TypeExpression, []ast.Pattern) {
+	defer p.untrace(p.trace("parseFunctionParameters"))
+	identifiers := []*ast.Identifier{}
+	types := []*ast.TypeExpression{}
+	patterns := []ast.Pattern{}
+	typed, destructured := false, false
+
+	if p.peekTokenIs(token.RPAREN) {
+		p.nextToken()
+		return identifiers, nil, nil
+	}
+
+	parameter := func() bool {
+		var pattern ast.Pattern
+		if p.curTokenIs(token.LBRACKET) || p.curTokenIs(token.LBRACE) {
+			if pattern = p.parsePattern(); pattern == nil || !p.uniqueBindings(pattern) {
+				return false
+			}
+			destructured = true
+		}
+		patterns = append(patterns, pattern)
 
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		switch pattern := pattern.(type) {
+		// named after the pattern, which no reference can be
+		case *ast.ArrayPattern:
+			ident = &ast.Identifier{Token: pattern.Token, Value: pattern.String()}
+		case *ast.HashPattern:
+			ident = &ast.Identifier{Token: pattern.Token, Value: pattern.String()}
+		}
 		identifiers = append(identifiers, ident)
+
+		var typ *ast.TypeExpression
+		if p.peekTokenIs(token.COLON) {
+			p.nextToken()
+			p.nextToken()
+			if typ = p.parseType(); typ == nil {
+				return false
+			}
+			typed = true
+		}
+		types = append(types, typ)
+		return true
+	}
+
+	p.nextToken()
+	if !parameter() {
+		return nil, nil, nil
+	}
+
+	for p.peekTokenIs(token.COMMA) {
+		p.nextToken()
+		p.nextToken()
+		if !parameter() {
+			return nil, nil, nil
+		}
 	}
 
 	if !p.expectPeek(token.RPAREN) {
-		return nil
+		return nil, nil, nil
 	}
 
-	return identifiers
+	if !typed {
+		types = nil
+	}
+	if !destructured {
+		patterns = nil
+	}
+	return identifiers, types, patterns
+}
+
+// the names a type can have, anything else in a type is a mistake
+var typeNames = map[string]bool{
+	"int":    true,
+	"bool":   true,
+	"string": true,
+	"null":   true,
+	"any":    true,
+}
+
+// int, [int], {string: int} or bud(int) -> int, starting at the current token
+func (p *Parser) parseType() *ast.TypeExpression {
+	defer p.untrace(p.trace("parseType"))
+	typ := &ast.TypeExpression{Token: p.curToken}
+
+	switch p.curToken.Type {
+	case token.IDENT:
+		if !typeNames[p.curToken.Literal] {
+			line := p.l.GetLineNumber(p.curToken.Position)
+			p.addError(fmt.Sprintf("Line %d: unknown type %s", line, p.curToken.Literal))
+			return nil
+		}
+		typ.Name = p.curToken.Literal
+
+	case token.LBRACKET:
+		p.nextToken()
+		if typ.Element = p.parseType(); typ.Element == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACKET) {
+			return nil
+		}
+
+	case token.LBRACE:
+		p.nextToken()
+		if typ.Key = p.parseType(); typ.Key == nil {
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		if typ.Value = p.parseType(); typ.Value == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+
+	case token.FUNCTION:
+		if !p.expectPeek(token.LPAREN) {
+			return nil
+		}
+		typ.Parameters = []*ast.TypeExpression{}
+		for !p.peekTokenIs(token.RPAREN) {
+			if len(typ.Parameters) > 0 && !p.expectPeek(token.COMMA) {
+				return nil
+			}
+			p.nextToken()
+			param := p.parseType()
+			if param == nil {
+				return nil
+			}
+			typ.Parameters = append(typ.Parameters, param)
+		}
+		p.nextToken()
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.nextToken()
+		if typ.Return = p.parseType(); typ.Return == nil {
+			return nil
+		}
+
+	default:
+		line := p.l.GetLineNumber(p.curToken.Position)
+		p.addError(fmt.Sprintf("Line %d: expected a type, got %s", line, p.curToken.Type))
+		return nil
+	}
+	return typ
 }
 
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseCallExpression"))
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseCallArguments()
 
@@ -520,11 +1468,18 @@ func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 }
 
 func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+	defer p.untrace(p.trace("parseCallArguments"))
+	return p.parseExpressionList(token.RPAREN)
+}
 
-	if p.peekTokenIs(token.RPAREN) {
+// comma separated expressions up to the end token
+func (p *Parser) parseExpressionList(end token.TokenType) []ast.Expression {
+	defer p.untrace(p.trace("parseExpressionList"))
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
 		p.nextToken()
-		return args
+		return list
 	}
 
 	p.nextToken()
@@ -534,7 +1489,7 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 		return nil
 	}
 
-	args = append(args, expr)
+	list = append(list, expr)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
@@ -545,14 +1500,154 @@ func (p *Parser) parseCallArguments() []ast.Expression {
 			return nil
 		}
 
-		args = append(args, expr)
+		list = append(list, expr)
 	}
 
-	if !p.expectPeek(token.RPAREN) {
+	if !p.expectPeek(end) {
+		return nil
+	}
+
+	return list
+}
+
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseArrayLiteral"))
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(token.RBRACKET)
+
+	if array.Elements == nil {
+		return nil
+	}
+
+	return array
+}
+
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseIndexExpression"))
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if exp.Index == nil {
+		return nil
+	}
+
+	if !p.expectPeek(token.RBRACKET) {
 		return nil
 	}
 
-	return args
+	return exp
+}
+
+func (p *Parser) parseHashLiteral() ast.Expression {
+	defer p.untrace(p.trace("parseHashLiteral"))
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = make(map[ast.Expression]ast.Expression)
+
+	for !p.peekTokenIs(token.RBRACE) {
+		p.nextToken()
+		key := p.parseExpression(LOWEST)
+
+		if key == nil {
+			return nil
+		}
+
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+
+		if value == nil {
+			return nil
+		}
+
+		hash.Keys = append(hash.Keys, key)
+		hash.Pairs[key] = value
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil
+	}
+
+	return hash
+}
+
+// Point{x: 1, y: 2}
+func (p *Parser) parseRecordLiteral(typ ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseRecordLiteral"))
+	lit := &ast.RecordLiteral{Token: p.curToken, Type: typ}
+
+	var ok bool
+	if lit.Fields, lit.Values, ok = p.parseFieldList(); !ok {
+		return nil
+	}
+	return lit
+}
+
+// p with {x: 3}
+func (p *Parser) parseWithExpression(record ast.Expression) ast.Expression {
+	defer p.untrace(p.trace("parseWithExpression"))
+	exp := &ast.WithExpression{Token: p.curToken, Record: record}
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	var ok bool
+	if exp.Fields, exp.Values, ok = p.parseFieldList(); !ok {
+		return nil
+	}
+	return exp
+}
+
+// {name: value, ...} of a record literal or a with, from the {
+func (p *Parser) parseFieldList() ([]*ast.Identifier, []ast.Expression, bool) {
+	defer p.untrace(p.trace("parseFieldList"))
+	fields := []*ast.Identifier{}
+	values := []ast.Expression{}
+	seen := make(map[string]bool)
+
+	for !p.peekTokenIs(token.RBRACE) {
+		if !p.expectPeek(token.IDENT) {
+			return nil, nil, false
+		}
+		field := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		if seen[field.Value] {
+			line := p.l.GetLineNumber(p.curToken.Position)
+			p.addError(fmt.Sprintf("Line %d: field %s is given twice", line, field.Value))
+			return nil, nil, false
+		}
+		seen[field.Value] = true
+
+		if !p.expectPeek(token.COLON) {
+			return nil, nil, false
+		}
+
+		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		if value == nil {
+			return nil, nil, false
+		}
+
+		fields = append(fields, field)
+		values = append(values, value)
+
+		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
+			return nil, nil, false
+		}
+	}
+
+	if !p.expectPeek(token.RBRACE) {
+		return nil, nil, false
+	}
+	return fields, values, true
 }
 
 // Helper method to add error messages with current context
@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/pro0o/sup-bud/ast"
@@ -353,7 +355,7 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 		},
 		{
 			"3 + 4; -5 * 5",
-			"(3 + 4)((-5) * 5)",
+			"(3 + 4);((-5) * 5)",
 		},
 		{
 			"5 > 4 == 3 < 4",
@@ -422,6 +424,14 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
 	}
 	for _, tt := range tests {
 		l := lexer.New(tt.input)
@@ -644,3 +654,544 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
+
+func TestImportExportParsing(t *testing.T) {
+	input := `import "lib/math.sb" as m;
+	export sup two = m.add(1, 1);`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d",
+			len(program.Statements))
+	}
+	imp, ok := program.Statements[0].(*ast.ImportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ImportStatement. got=%T",
+			program.Statements[0])
+	}
+	if imp.Path.Value != "lib/math.sb" {
+		t.Errorf("imp.Path.Value not %q. got=%q", "lib/math.sb", imp.Path.Value)
+	}
+	if !testIdentifier(t, imp.Alias, "m") {
+		return
+	}
+	exp, ok := program.Statements[1].(*ast.ExportStatement)
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.ExportStatement. got=%T",
+			program.Statements[1])
+	}
+	if !testLetStatement(t, exp.Statement, "two") {
+		return
+	}
+	if got := exp.Statement.Value.String(); got != "(m.add)(1, 1)" {
+		t.Errorf("export value wrong. got=%q", got)
+	}
+}
+
+func TestImportOnlyAtTopLevel(t *testing.T) {
+	l := lexer.New(`bud() { import "a.sb" as a; }`)
+	p := New(l)
+	p.ParseProgram()
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected an error for a nested import")
+	}
+}
+
+func TestParsingHashLiteral(t *testing.T) {
+	input := `{"one": 1, "two": 2, 3: "three"}`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+	if got := hash.String(); got != `{"one": 1, "two": 2, 3: "three"}` {
+		t.Errorf("hash.String() wrong. got=%q", got)
+	}
+}
+
+func TestSelectExpressionParsing(t *testing.T) {
+	input := `select { recv(a) as v { v } send(b, 1 + 2) { 0 } default { 1 } }`
+	l := lexer.New(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.SelectExpression)
+	if !ok {
+		t.Fatalf("exp is not ast.SelectExpression. got=%T", stmt.Expression)
+	}
+	if len(exp.Cases) != 2 || exp.Default == nil {
+		t.Fatalf("wrong select cases. got=%d cases, default=%v", len(exp.Cases), exp.Default != nil)
+	}
+	if !testIdentifier(t, exp.Cases[0].Binding, "v") {
+		return
+	}
+	if !exp.Cases[1].Send {
+		t.Errorf("second case should be a send")
+	}
+	testInfixExpression(t, exp.Cases[1].Value, 1, "+", 2)
+
+	for _, bad := range []string{
+		`select { wait(a) { 1 } }`,
+		`select { send(a) { 1 } }`,
+		`select { default { 1 } default { 2 } }`,
+	} {
+		p := New(lexer.New(bad))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 {
+			t.Errorf("expected parser errors for %q", bad)
+		}
+	}
+}
+
+func TestOperatorDeclarations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"infixl 6 <+> = bud(a, b) { a }; 1 <+> 2 <+> 3",
+			"infixl 6 <+> = bud(a, b) { a };((1 <+> 2) <+> 3)"},
+		{"infixr 6 <+> = f; 1 <+> 2 <+> 3", "infixr 6 <+> = f;(1 <+> (2 <+> 3))"},
+		// same level as + and -, tighter than ==
+		{"infixl 6 <+> = f; 1 + 2 <+> 3 - 4 == 5", "infixl 6 <+> = f;((((1 + 2) <+> 3) - 4) == 5)"},
+		{"infixr 5 ++ = f; 1 + 2 ++ 3 * 4", "infixr 5 ++ = f;((1 + 2) ++ (3 * 4))"},
+		{"infixl 9 |> = f; -a |> b(c)", "infixl 9 |> = f;((-a) |> b(c))"},
+		{"infix 4 <=> = f; a <=> b < c", "infix 4 <=> = f;(a <=> (b < c))"},
+		// declared operators take precedence over the ones they start with
+		{"infixl 7 *> = f; a*>b*c", "infixl 7 *> = f;((a *> b) * c)"},
+		// usable in their own body
+		{"infixl 6 <+> = bud(a, b) { a <+> b }", "infixl 6 <+> = bud(a, b) { (a <+> b) };"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong parse of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	call := func(input string) *ast.CallExpression {
+		p := New(lexer.New(input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		stmt := program.Statements[len(program.Statements)-1].(*ast.ExpressionStatement)
+		return stmt.Expression.(*ast.CallExpression)
+	}
+	exp := call("infixl 6 <+> = f; x <+> 1")
+	if !testIdentifier(t, exp.Function, "<+>") || len(exp.Arguments) != 2 {
+		t.Fatalf("wrong call for x <+> 1: %s", exp)
+	}
+	testIdentifier(t, exp.Arguments[0], "x")
+	testIntegerLiteral(t, exp.Arguments[1], 1)
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"1 ?? 2", "Line 1: unknown operator ??"},
+		{"infixl 10 <+> = f", "Line 1: operator level must be 0 to 9, got 10"},
+		{"infixl 6 + = f", "Line 1: cannot redeclare built-in operator +"},
+		{"infixl 6 <+> = f; infixr 6 <+> = g", "Line 1: operator <+> is already declared"},
+		{"bud() { infixl 6 <+> = f }", "Line 1: infixl is only allowed at the top level"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected %q first, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	// a chain of non-associative operators is one error, however long
+	// and wherever it is
+	chain := "Line 1: cannot chain non-associative operators <=> and <=>, add parentheses"
+	chains := []struct {
+		input    string
+		expected []string
+	}{
+		{"infix 4 <=> = f; a <=> b <=> c", []string{chain}},
+		{"infix 4 <=> = f; a <=> b <=> c <=> d; e", []string{chain}},
+		{"infix 4 <=> = f; (a <=> b <=> c) + 1", []string{chain}},
+		{"infix 4 <=> = f; [a <=> b <=> c, d]", []string{chain}},
+		{"infix 4 <=> = f; infix 4 =/= = g; a <=> b =/= c",
+			[]string{"Line 1: cannot chain non-associative operators <=> and =/=, add parentheses"}},
+	}
+	for _, tt := range chains {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if !reflect.DeepEqual(p.Errors(), tt.expected) {
+			t.Errorf("wrong errors for %q. expected %q, got %q", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	p := New(lexer.New(`macro(x, y) { x + y; }`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("exp is not ast.MacroLiteral. got=%T", stmt.Expression)
+	}
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d", len(macro.Parameters))
+	}
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d", len(macro.Body.Statements))
+	}
+	body := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	testInfixExpression(t, body.Expression, "x", "+", "y")
+}
+
+func TestTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sup x: int = 1;", "sup x: int = 1;"},
+		{"sup xs: [string] = [];", "sup xs: [string] = [];"},
+		{"sup h: {string: [int]} = h;", "sup h: {string: [int]} = h;"},
+		{"sup f: bud(int, bool) -> any = f;", "sup f: bud(int, bool) -> any = f;"},
+		{"sup g: bud() -> null = g;", "sup g: bud() -> null = g;"},
+		{"bud(a: int, b) -> int { a }", "bud(a: int, b) -> int { a }"},
+		{"bud(a) -> {string: int} { a }", "bud(a) -> {string: int} { a }"},
+		{"bud(f: bud(int) -> int) { f(1) }", "bud(f: bud(int) -> int) { f(1) }"},
+		{"export sup x: int = 1;", "export sup x: int = 1;"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong parse of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("bud(a, b: int) { a }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.ParameterTypes) != 2 || fn.ParameterTypes[0] != nil || fn.ParameterTypes[1].Name != "int" {
+		t.Errorf("parameter types not lined up with parameters: %v", fn.ParameterTypes)
+	}
+	p = New(lexer.New("bud(a, b) { a }"))
+	program = p.ParseProgram()
+	fn = program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if fn.ParameterTypes != nil || fn.ReturnType != nil {
+		t.Errorf("unannotated bud has types: %v %v", fn.ParameterTypes, fn.ReturnType)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"sup x: integer = 1;", "Line 1: unknown type integer"},
+		{"sup x: 5 = 1;", "Line 1: expected a type, got INT"},
+		{"sup x: [int = 1;", "Line 1: expected next token to be ], got = instead"},
+		{"sup f: bud(int) = f;", "Line 1: expected next token to be ->, got = instead"},
+		{"bud(a:) { a }", "Line 1: expected a type, got )"},
+		{"macro(a: int) { a }", "Line 1: macro parameters cannot have types"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected %q first, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestRecordParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"record Point { x, y }", "record Point { x, y }"},
+		{"record Unit {}", "record Unit { }"},
+		{"record P { x; sup get = bud() { self.x }; }", "record P { x; sup get = bud() { (self.x) }; }"},
+		{"record P { sup one = bud() { 1 } }", "record P { sup one = bud() { 1 }; }"},
+		{"export record P { x }", "export record P { x }"},
+		{"Point{x: 1, y: 2 + 3}", "Point{x: 1, y: (2 + 3)}"},
+		{"Point{}", "Point{}"},
+		{"m.Point{x: 1}", "(m.Point){x: 1}"},
+		{"Point{x: 1}.x", "(Point{x: 1}.x)"},
+		{"p with {x: 3}", "(p with {x: 3})"},
+		{"p with {x: 1} with {y: 2}", "((p with {x: 1}) with {y: 2})"},
+		// with binds tighter than any operator, looser than a call
+		{"p with {x: 1} == q", "((p with {x: 1}) == q)"},
+		{"f(p) with {x: 1}.y", "((f(p) with {x: 1}).y)"},
+		// only a record name starts a record literal, x {} is x and a hash
+		{"x {}", "x;{}"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong parse of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("record Point { x, y; sup norm = bud() { self.x } }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("record is not bound by a sup. got=%T", program.Statements[0])
+	}
+	testIdentifier(t, stmt.Name, "Point")
+	def, ok := stmt.Value.(*ast.RecordDefinition)
+	if !ok {
+		t.Fatalf("value is not ast.RecordDefinition. got=%T", stmt.Value)
+	}
+	if def.Name != "Point" || len(def.Fields) != 2 || len(def.Methods) != 1 || def.Methods[0].Name.Value != "norm" {
+		t.Errorf("wrong record definition: %s", def)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"record point { x }", "Line 1: record name must start with an upper case letter, got point"},
+		{"record P { x, x }", "Line 1: record P has x twice"},
+		{"record P { x; sup x = bud() { 1 }; }", "Line 1: record P has x twice"},
+		{"record P { x; sup m = 1; }", "Line 1: method m of P must be a bud"},
+		{"record P { x y }", "Line 1: expected next token to be }, got IDENT instead"},
+		{"P{x: 1, x: 2}", "Line 1: field x is given twice"},
+		{"P{1: 2}", "Line 1: expected next token to be IDENT, got INT instead"},
+		{"p with 3", "Line 1: expected next token to be {, got INT instead"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected %q first, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestMatchParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { 1 => a, _ => b }", "match x { 1 => a, _ => b }"},
+		{`match x { "a" => 1, true => 2, -3 => 3, }`, `match x { "a" => 1, true => 2, -3 => 3 }`},
+		{"match xs { [] => 0, [x] => x, [x, _, ...rest] => rest }", "match xs { [] => 0, [x] => x, [x, _, ...rest] => rest }"},
+		{`match h { {"kind": k, name} => k, {1: [a]} => a }`, `match h { {"kind": k, "name": name} => k, {1: [a]} => a }`},
+		{"match n { x if x > 0 => x + 1, _ => 0 }", "match n { x if (x > 0) => (x + 1), _ => 0 }"},
+		{"match x {}", "match x { }"},
+		// the { after the value starts the arms, not a record literal
+		{"match Point { p => p }", "match Point { p => p }"},
+		{"match (Point{x: 1}) { p => p }", "match (Point{x: 1}) { p => p }"},
+		{"match a { x => match x { y => y } }", "match a { x => match x { y => y } }"},
+		{"match a { x => Point{x: x} }", "match a { x => Point{x: x} }"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong parse of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("match xs { [a, ...r] if a => r }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	exp, ok := stmt.Expression.(*ast.MatchExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MatchExpression. got=%T", stmt.Expression)
+	}
+	testIdentifier(t, exp.Subject, "xs")
+	if len(exp.Arms) != 1 {
+		t.Fatalf("wrong number of arms. got=%d", len(exp.Arms))
+	}
+	pattern, ok := exp.Arms[0].Pattern.(*ast.ArrayPattern)
+	if !ok {
+		t.Fatalf("pattern is not ast.ArrayPattern. got=%T", exp.Arms[0].Pattern)
+	}
+	if len(pattern.Elements) != 1 || pattern.Rest == nil || pattern.Rest.Value != "r" {
+		t.Errorf("wrong array pattern: %s", pattern)
+	}
+	testIdentifier(t, exp.Arms[0].Guard, "a")
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"match x { 1 + 2 => 3 }", "Line 1: expected next token to be =>, got + instead"},
+		{"match x { bud() { 1 } => 3 }", "Line 1: expected a pattern, got bud"},
+		{"match x { [...r, a] => 3 }", "Line 1: ...r must come last in an array pattern"},
+		{"match x { [a, a] => 3 }", "Line 1: pattern binds a twice"},
+		{"match x { {k: v} => v }", "Line 1: hash pattern key must be a literal, got k"},
+		{"match x { 1 => 2 3 => 4 }", "Line 1: expected next token to be ,, got INT instead"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected %q first, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+
+	warnings := []struct {
+		input    string
+		expected []string
+	}{
+		{"match b { true => 1, false => 0 }", nil},
+		{"match b { true => 1, _ => 0 }", nil},
+		{"match b {\n true => 1 }", []string{"Line 1: match on a boolean does not cover false"}},
+		{"match b { false => 0, x if x => 1 }", []string{"Line 1: match on a boolean does not cover true"}},
+		{"match b { true if c => 1, false => 0 }", []string{"Line 1: match on a boolean does not cover true"}},
+		{"match n { 1 => 1 }", nil},
+	}
+	for _, tt := range warnings {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		checkParserErrors(t, p)
+		if strings.Join(p.Warnings(), "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong warnings for %q. expected %q, got %q", tt.input, tt.expected, p.Warnings())
+		}
+	}
+}
+
+func TestDestructuringParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sup [a, b, ...rest] = xs;", "sup [a, b, ...rest] = xs;"},
+		{"sup {name, age} = h", `sup {"name": name, "age": age} = h;`},
+		{`sup {"pos": [x, y]} = h;`, `sup {"pos": [x, y]} = h;`},
+		{"sup [a, b]: [int] = xs;", "sup [a, b]: [int] = xs;"},
+		{"bud([a, b], c) { a }", "bud([a, b], c) { a }"},
+		{"bud({x, y}: {string: int}) { x }", `bud({"x": x, "y": y}: {string: int}) { x }`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong parse of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New("bud(a, [b, _]) { b }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fn.Parameters) != 2 || len(fn.Patterns) != 2 {
+		t.Fatalf("wrong parameters. got=%d parameters and %d patterns", len(fn.Parameters), len(fn.Patterns))
+	}
+	if fn.Patterns[0] != nil {
+		t.Errorf("a plain parameter got a pattern: %s", fn.Patterns[0])
+	}
+	if _, ok := fn.Patterns[1].(*ast.ArrayPattern); !ok {
+		t.Errorf("pattern is not ast.ArrayPattern. got=%T", fn.Patterns[1])
+	}
+	program = New(lexer.New("bud(a, b) { a }")).ParseProgram()
+	if fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral); fn.Patterns != nil {
+		t.Errorf("a bud without patterns got patterns: %v", fn.Patterns)
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{"sup [a, a] = xs;", "Line 1: pattern binds a twice"},
+		{"sup [a, ...r, b] = xs;", "Line 1: ...r must come last in an array pattern"},
+		{"sup [a] xs;", "Line 1: expected next token to be =, got IDENT instead"},
+		{"bud([a, a]) { a }", "Line 1: pattern binds a twice"},
+		{"macro([a]) { a }", "Line 1: macro parameters cannot be patterns"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected %q first, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestInterpolationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello ${name}"`, `"hello ${name}"`},
+		{`"${a} and ${b + 1}!"`, `"${a} and ${(b + 1)}!"`},
+		{`"${ {"k": 1}["k"] }"`, `"${({"k": 1}["k"])}"`},
+		{`"${"in ${x}"}"`, `"${"in ${x}"}"`},
+		{`"\${x} ${y}"`, `"\${x} ${y}"`},
+		{`"a" + "${b}"`, `("a" + "${b}")`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+		if program.String() != tt.expected {
+			t.Errorf("wrong parse of %q. expected=%q, got=%q", tt.input, tt.expected, program.String())
+		}
+	}
+
+	p := New(lexer.New(`"a ${x} b ${y}"`))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+	is, ok := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InterpolatedString)
+	if !ok {
+		t.Fatalf("exp is not ast.InterpolatedString. got=%T", program.Statements[0].(*ast.ExpressionStatement).Expression)
+	}
+	if len(is.Parts) != 3 || is.Parts[0] != "a " || is.Parts[1] != " b " || is.Parts[2] != "" {
+		t.Errorf("wrong parts. got=%q", is.Parts)
+	}
+	if len(is.Values) != 2 {
+		t.Errorf("wrong number of values. got=%d", len(is.Values))
+	}
+
+	errors := []struct {
+		input    string
+		expected string
+	}{
+		{`"a ${} b"`, "Line 1: empty ${} in string"},
+		{`"a ${x y} b"`, "Line 1: expected } to close ${ in string, got IDENT"},
+	}
+	for _, tt := range errors {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+		if len(p.Errors()) == 0 || p.Errors()[0] != tt.expected {
+			t.Errorf("wrong errors for %q. expected %q first, got %v", tt.input, tt.expected, p.Errors())
+		}
+	}
+}
+
+func TestLateLexerErrors(t *testing.T) {
+	// nothing the parser trips on, the string still is not UTF-8
+	p := New(lexer.New("sup x = 1;\nsup s = \"a\xffb\";"))
+	p.ParseProgram()
+	expected := "Line 2, Column 11: invalid UTF-8 byte 0xff"
+	if len(p.Errors()) != 1 || p.Errors()[0] != expected {
+		t.Errorf("wrong errors. expected=%q, got=%q", expected, p.Errors())
+	}
+}
@@ -1,32 +1,132 @@
 package parser
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
 	"strings"
+
+	"github.com/pro0o/sup-bud/token"
+)
+
+// kinds of trace events
+const (
+	TraceEnter      = "enter"      // the parse function Rule starts
+	TraceExit       = "exit"       // and is done
+	TraceToken      = "token"      // the parser moved on to Token
+	TracePrecedence = "precedence" // parseExpression looked at the infix operator Token
 )
 
-var traceLevel int = 0
+// TraceEvent is one step of a parse. for precedence events
+// Precedence is what the expression being parsed binds with and
+// PeekPrecedence that of the operator after it, the operator takes
+// the expression as its left side when Binds is set.
+type TraceEvent struct {
+	Kind           string       `json:"kind"`
+	Rule           string       `json:"rule,omitempty"`
+	Level          int          `json:"level"`
+	Token          *token.Token `json:"token,omitempty"`
+	Precedence     int          `json:"precedence,omitempty"`
+	PeekPrecedence int          `json:"peekPrecedence,omitempty"`
+	Binds          bool         `json:"binds,omitempty"`
+}
+
+// Tracer gets every event of a parse in order.
+type Tracer func(TraceEvent)
+
+// SetTracer traces the parse to t, nil turns tracing off.
+func (p *Parser) SetTracer(t Tracer) {
+	p.tracer = t
+}
 
-const traceIdentPlaceholder string = "\t"
+// SetDebugMode prints an indented trace to stdout.
+//
+// Deprecated: use SetTracer with TextTracer.
+func (p *Parser) SetDebugMode(enabled bool) {
+	if enabled {
+		p.tracer = TextTracer(os.Stdout)
+	} else {
+		p.tracer = nil
+	}
+}
 
-func identLevel() string {
-	return strings.Repeat(traceIdentPlaceholder, traceLevel-1)
+// TextTracer writes the trace indented by level, like
+//
+//	BEGIN parseExpression
+//		token INT "1"
+//		precedence + 70 > 1
+func TextTracer(w io.Writer) Tracer {
+	return func(ev TraceEvent) {
+		fmt.Fprintf(w, "%s%s\n", strings.Repeat("\t", ev.Level), ev.text())
+	}
 }
 
-func tracePrint(fs string) {
-	fmt.Printf("%s%s\n", identLevel(), fs)
+// JSONTracer writes every event as a line of JSON.
+func JSONTracer(w io.Writer) Tracer {
+	enc := json.NewEncoder(w)
+	return func(ev TraceEvent) {
+		enc.Encode(ev)
+	}
 }
 
-func incIdent() { traceLevel = traceLevel + 1 }
-func decIdent() { traceLevel = traceLevel - 1 }
+func (ev TraceEvent) text() string {
+	switch ev.Kind {
+	case TraceEnter:
+		return "BEGIN " + ev.Rule
+	case TraceExit:
+		return "END " + ev.Rule
+	case TraceToken:
+		return fmt.Sprintf("token %s %q", ev.Token.Type, ev.Token.Literal)
+	case TracePrecedence:
+		op := ev.Token.Literal
+		if op == "" {
+			op = string(ev.Token.Type) // EOF
+		}
+		if ev.Binds {
+			return fmt.Sprintf("precedence %s %d > %d", op, ev.PeekPrecedence, ev.Precedence)
+		}
+		return fmt.Sprintf("precedence %s %d <= %d, done", op, ev.PeekPrecedence, ev.Precedence)
+	}
+	return ev.Kind
+}
+
+func (p *Parser) emit(ev TraceEvent) {
+	ev.Level = p.traceLevel
+	p.tracer(ev)
+}
+
+// defer p.untrace(p.trace("parseLetStatement"))
+func (p *Parser) trace(rule string) string {
+	if p.tracer != nil {
+		p.emit(TraceEvent{Kind: TraceEnter, Rule: rule})
+		p.traceLevel++
+	}
+	return rule
+}
+
+func (p *Parser) untrace(rule string) {
+	if p.tracer != nil {
+		p.traceLevel--
+		p.emit(TraceEvent{Kind: TraceExit, Rule: rule})
+	}
+}
 
-func trace(msg string) string {
-	incIdent()
-	tracePrint("BEGIN " + msg)
-	return msg
+func (p *Parser) traceToken(tok token.Token) {
+	if p.tracer != nil {
+		p.emit(TraceEvent{Kind: TraceToken, Token: &tok})
+	}
 }
 
-func untrace(msg string) {
-	tracePrint("END " + msg)
-	decIdent()
+// whether the operator after the current expression binds tighter
+// than precedence, the Pratt loop in parseExpression goes on if so
+func (p *Parser) binds(precedence int) bool {
+	peek := p.peekPrecedence()
+	binds := precedence < peek
+	if p.tracer != nil {
+		tok := p.peekToken
+		p.emit(TraceEvent{Kind: TracePrecedence, Token: &tok, Precedence: precedence,
+			PeekPrecedence: peek, Binds: binds})
+	}
+	return binds
 }
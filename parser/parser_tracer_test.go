@@ -0,0 +1,131 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pro0o/sup-bud/lexer"
+)
+
+func TestTextTracer(t *testing.T) {
+	var out strings.Builder
+	p := New(lexer.New("1 + 2 * 3"))
+	p.SetTracer(TextTracer(&out))
+	p.ParseProgram()
+
+	expected := `BEGIN ParseProgram
+	token INT "1"
+	BEGIN parseStatement
+		BEGIN parseExpressionStatement
+			BEGIN parseExpression
+				BEGIN parseIntegerLiteral
+				END parseIntegerLiteral
+				precedence + 70 > 1
+				token + "+"
+				BEGIN parseInfixExpression
+					token INT "2"
+					BEGIN parseExpression
+						BEGIN parseIntegerLiteral
+						END parseIntegerLiteral
+						precedence * 80 > 70
+						token * "*"
+						BEGIN parseInfixExpression
+							token INT "3"
+							BEGIN parseExpression
+								BEGIN parseIntegerLiteral
+								END parseIntegerLiteral
+								precedence EOF 1 <= 80, done
+							END parseExpression
+						END parseInfixExpression
+						precedence EOF 1 <= 70, done
+					END parseExpression
+				END parseInfixExpression
+				precedence EOF 1 <= 1, done
+			END parseExpression
+		END parseExpressionStatement
+	END parseStatement
+	token EOF ""
+END ParseProgram
+`
+	if out.String() != expected {
+		t.Errorf("wrong trace.\nexpected:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
+
+func TestJSONTracer(t *testing.T) {
+	var out strings.Builder
+	p := New(lexer.New("a * b"))
+	p.SetTracer(JSONTracer(&out))
+	p.ParseProgram()
+
+	var decisions []TraceEvent
+	depth := 0
+	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	for scanner.Scan() {
+		var ev TraceEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("bad JSON line %q: %v", scanner.Text(), err)
+		}
+		switch ev.Kind {
+		case TraceEnter:
+			if ev.Level != depth {
+				t.Errorf("enter %s at level %d, expected %d", ev.Rule, ev.Level, depth)
+			}
+			depth++
+		case TraceExit:
+			depth--
+		case TracePrecedence:
+			decisions = append(decisions, ev)
+		}
+	}
+	if depth != 0 {
+		t.Errorf("enter and exit do not pair up, %d left open", depth)
+	}
+
+	if len(decisions) != 3 {
+		t.Fatalf("expected 3 precedence decisions, got %d", len(decisions))
+	}
+	first := decisions[0]
+	if first.Token.Literal != "*" || first.Precedence != LOWEST || first.PeekPrecedence != PRODUCT || !first.Binds {
+		t.Errorf("wrong first decision: %+v", first)
+	}
+	if decisions[1].Binds || decisions[2].Binds {
+		t.Errorf("EOF should not bind: %+v", decisions[1:])
+	}
+}
+
+// tracing lives on the parser, parsers in different goroutines do
+// not share indentation or output
+func TestTracersAreIndependent(t *testing.T) {
+	inputs := []string{"sup x = 1;", "if (a) { b } else { c }", "bud(x) { x * 2 }(3)", "[1, 2][0]"}
+
+	expected := make([]string, len(inputs))
+	for i, input := range inputs {
+		var out strings.Builder
+		p := New(lexer.New(input))
+		p.SetTracer(TextTracer(&out))
+		p.ParseProgram()
+		expected[i] = out.String()
+	}
+
+	var wg sync.WaitGroup
+	for round := 0; round < 10; round++ {
+		for i, input := range inputs {
+			wg.Add(1)
+			go func(i int, input string) {
+				defer wg.Done()
+				var out strings.Builder
+				p := New(lexer.New(input))
+				p.SetTracer(TextTracer(&out))
+				p.ParseProgram()
+				if out.String() != expected[i] {
+					t.Errorf("trace of %q differs when parsed concurrently", input)
+				}
+			}(i, input)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,362 @@
+package supbud
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/pro0o/sup-bud/eval"
+	"github.com/pro0o/sup-bud/object"
+)
+
+var (
+	objectType = reflect.TypeOf((*object.Object)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// ToObject converts Go values into sup-bud objects:
+// integers, bools, strings, slices, maps and funcs.
+// object.Object values pass through untouched.
+func (in *Interpreter) ToObject(value interface{}) (object.Object, error) {
+	if value == nil {
+		return eval.NULL, nil
+	}
+	if obj, ok := value.(object.Object); ok {
+		return obj, nil
+	}
+	return in.toObject(reflect.ValueOf(value))
+}
+
+func (in *Interpreter) toObject(v reflect.Value) (object.Object, error) {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return eval.TRUE, nil
+		}
+		return eval.FALSE, nil
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return eval.NewInteger(v.Int()), nil
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		if u > 1<<63-1 {
+			return nil, fmt.Errorf("%d overflows INTEGER", u)
+		}
+		return eval.NewInteger(int64(u)), nil
+
+	case reflect.String:
+		return &object.String{Value: v.String()}, nil
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return eval.NULL, nil
+		}
+		elements := make([]object.Object, v.Len())
+		for i := range elements {
+			el, err := in.toObject(v.Index(i))
+			if err != nil {
+				return nil, fmt.Errorf("index %d: %w", i, err)
+			}
+			elements[i] = el
+		}
+		return &object.Array{Elements: elements}, nil
+
+	case reflect.Map:
+		if v.IsNil() {
+			return eval.NULL, nil
+		}
+		pairs := make(map[object.HashKey]object.HashPair, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := in.toObject(iter.Key())
+			if err != nil {
+				return nil, fmt.Errorf("map key: %w", err)
+			}
+			hashable, ok := key.(object.Hashable)
+			if !ok {
+				return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
+			}
+			value, err := in.toObject(iter.Value())
+			if err != nil {
+				return nil, fmt.Errorf("map value for %s: %w", key.Inspect(), err)
+			}
+			pairs[hashable.HashKey()] = object.HashPair{Key: key, Value: value}
+		}
+		return &object.Hash{Pairs: pairs}, nil
+
+	case reflect.Func:
+		if v.IsNil() {
+			return eval.NULL, nil
+		}
+		return in.wrapFunc(v), nil
+
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			return eval.NULL, nil
+		}
+		if obj, ok := v.Interface().(object.Object); ok {
+			return obj, nil
+		}
+		if v.Kind() == reflect.Interface {
+			return in.toObject(v.Elem())
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %s to a sup-bud value", v.Type())
+}
+
+// FromObject converts sup-bud objects back into plain Go values.
+// INTEGER is int64, ARRAY is []interface{} and HASH is
+// map[string]interface{} when every key is a string, otherwise
+// map[interface{}]interface{}. Objects without a Go counterpart,
+// like functions and modules, are returned as they are.
+func FromObject(obj object.Object) interface{} {
+	switch obj := obj.(type) {
+	case nil, *object.Null:
+		return nil
+	case *object.Integer:
+		return obj.Value
+	case *object.Boolean:
+		return obj.Value
+	case *object.String:
+		return obj.Value
+	case *object.ReturnValue:
+		return FromObject(obj.Value)
+	case *object.Array:
+		elements := make([]interface{}, len(obj.Elements))
+		for i, el := range obj.Elements {
+			elements[i] = FromObject(el)
+		}
+		return elements
+	case *object.Hash:
+		stringKeys := true
+		for _, pair := range obj.Pairs {
+			if pair.Key.Type() != object.STRING_OBJ {
+				stringKeys = false
+				break
+			}
+		}
+		if stringKeys {
+			m := make(map[string]interface{}, len(obj.Pairs))
+			for _, pair := range obj.Pairs {
+				m[pair.Key.(*object.String).Value] = FromObject(pair.Value)
+			}
+			return m
+		}
+		m := make(map[interface{}]interface{}, len(obj.Pairs))
+		for _, pair := range obj.Pairs {
+			m[FromObject(pair.Key)] = FromObject(pair.Value)
+		}
+		return m
+	default:
+		return obj
+	}
+}
+
+// converts a script value into a host func parameter of type t, ctx
+// is the one of the evaluation calling the host func
+func (in *Interpreter) toValue(ctx context.Context, obj object.Object, t reflect.Type) (reflect.Value, error) {
+	if t == objectType {
+		return reflect.ValueOf(&obj).Elem(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() == 0 {
+			if v := FromObject(obj); v != nil {
+				return reflect.ValueOf(v), nil
+			}
+			return reflect.Zero(t), nil
+		}
+
+	case reflect.Bool:
+		if b, ok := obj.(*object.Boolean); ok {
+			return reflect.ValueOf(b.Value).Convert(t), nil
+		}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, ok := obj.(*object.Integer); ok {
+			v := reflect.New(t).Elem()
+			if v.OverflowInt(i.Value) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetInt(i.Value)
+			return v, nil
+		}
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if i, ok := obj.(*object.Integer); ok {
+			v := reflect.New(t).Elem()
+			if i.Value < 0 || v.OverflowUint(uint64(i.Value)) {
+				return reflect.Value{}, fmt.Errorf("%d overflows %s", i.Value, t)
+			}
+			v.SetUint(uint64(i.Value))
+			return v, nil
+		}
+
+	case reflect.String:
+		if s, ok := obj.(*object.String); ok {
+			return reflect.ValueOf(s.Value).Convert(t), nil
+		}
+
+	case reflect.Slice:
+		if obj == eval.NULL {
+			return reflect.Zero(t), nil
+		}
+		if arr, ok := obj.(*object.Array); ok {
+			v := reflect.MakeSlice(t, len(arr.Elements), len(arr.Elements))
+			for i, el := range arr.Elements {
+				ev, err := in.toValue(ctx, el, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("index %d: %w", i, err)
+				}
+				v.Index(i).Set(ev)
+			}
+			return v, nil
+		}
+
+	case reflect.Map:
+		if obj == eval.NULL {
+			return reflect.Zero(t), nil
+		}
+		if hash, ok := obj.(*object.Hash); ok {
+			v := reflect.MakeMapWithSize(t, len(hash.Pairs))
+			for _, pair := range hash.Pairs {
+				kv, err := in.toValue(ctx, pair.Key, t.Key())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("map key: %w", err)
+				}
+				vv, err := in.toValue(ctx, pair.Value, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("map value for %s: %w", pair.Key.Inspect(), err)
+				}
+				v.SetMapIndex(kv, vv)
+			}
+			return v, nil
+		}
+
+	case reflect.Func:
+		switch obj.(type) {
+		case *object.Function, *object.Builtin:
+			return in.makeFunc(ctx, obj, t), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("cannot use %s as %s", obj.Type(), t)
+}
+
+// turns a host func into a builtin, arguments and results are
+// converted on every call and a trailing error result becomes
+// a sup-bud error.
+func (in *Interpreter) wrapFunc(fn reflect.Value) *object.Builtin {
+	t := fn.Type()
+	name := t.String()
+
+	return &object.Builtin{
+		Name: name,
+		FnContext: func(ctx context.Context, args ...object.Object) (result object.Object) {
+			defer func() {
+				if r := recover(); r != nil {
+					result = &object.Error{Message: fmt.Sprintf("%s panicked: %v", name, r)}
+				}
+			}()
+
+			numIn := t.NumIn()
+			if t.IsVariadic() {
+				if len(args) < numIn-1 {
+					return &object.Error{Message: fmt.Sprintf(
+						"wrong number of arguments: want at least %d, got=%d", numIn-1, len(args))}
+				}
+			} else if len(args) != numIn {
+				return &object.Error{Message: fmt.Sprintf(
+					"wrong number of arguments: want=%d, got=%d", numIn, len(args))}
+			}
+
+			values := make([]reflect.Value, len(args))
+			for i, arg := range args {
+				var paramType reflect.Type
+				if t.IsVariadic() && i >= numIn-1 {
+					paramType = t.In(numIn - 1).Elem()
+				} else {
+					paramType = t.In(i)
+				}
+				v, err := in.toValue(ctx, arg, paramType)
+				if err != nil {
+					return &object.Error{Message: fmt.Sprintf("argument %d: %v", i, err)}
+				}
+				values[i] = v
+			}
+
+			out := fn.Call(values)
+
+			if n := len(out); n > 0 && t.Out(n-1) == errorType {
+				if err, _ := out[n-1].Interface().(error); err != nil {
+					return &object.Error{Message: err.Error()}
+				}
+				out = out[:n-1]
+			}
+
+			switch len(out) {
+			case 0:
+				return eval.NULL
+			case 1:
+				obj, err := in.toObject(out[0])
+				if err != nil {
+					return &object.Error{Message: err.Error()}
+				}
+				return obj
+			default:
+				elements := make([]object.Object, len(out))
+				for i, v := range out {
+					obj, err := in.toObject(v)
+					if err != nil {
+						return &object.Error{Message: err.Error()}
+					}
+					elements[i] = obj
+				}
+				return &object.Array{Elements: elements}
+			}
+		},
+	}
+}
+
+// turns a script function into a Go func of type t, used when a
+// host func takes a callback. the callback runs under ctx, the
+// context of the evaluation that handed it over, see callbackContext.
+func (in *Interpreter) makeFunc(ctx context.Context, fn object.Object, t reflect.Type) reflect.Value {
+	return reflect.MakeFunc(t, func(args []reflect.Value) []reflect.Value {
+		results := make([]reflect.Value, t.NumOut())
+		for i := range results {
+			results[i] = reflect.Zero(t.Out(i))
+		}
+		fail := func(err error) []reflect.Value {
+			if n := t.NumOut(); n > 0 && t.Out(n-1) == errorType {
+				results[n-1] = reflect.ValueOf(&err).Elem()
+				return results
+			}
+			panic(err)
+		}
+
+		objs := make([]object.Object, len(args))
+		for i, arg := range args {
+			obj, err := in.toObject(arg)
+			if err != nil {
+				return fail(err)
+			}
+			objs[i] = obj
+		}
+
+		evaluated := eval.ApplyFunction(callbackContext(ctx), fn, objs, in.opts)
+		if errObj, ok := evaluated.(*object.Error); ok {
+			return fail(fmt.Errorf("%s", errObj.Message))
+		}
+
+		if t.NumOut() > 0 && t.Out(0) != errorType {
+			v, err := in.toValue(ctx, evaluated, t.Out(0))
+			if err != nil {
+				return fail(err)
+			}
+			results[0] = v
+		}
+		return results
+	})
+}
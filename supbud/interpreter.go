@@ -0,0 +1,135 @@
+// Package supbud embeds the sup-bud interpreter in Go programs.
+//
+//	in := supbud.New(supbud.DefaultOptions())
+//	in.Define("add", func(a, b int64) int64 { return a + b })
+//	result, err := in.Run(ctx, "add(2, 3)") // int64(5)
+package supbud
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pro0o/sup-bud/eval"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/object"
+	"github.com/pro0o/sup-bud/parser"
+	"github.com/pro0o/sup-bud/typecheck"
+)
+
+// same limits the playground runs with
+func DefaultOptions() eval.EvalOptions {
+	return eval.EvalOptions{
+		MaxCallDepth: 200,
+		Timeout:      5 * time.Second,
+	}
+}
+
+// Interpreter keeps one global environment alive across runs,
+// so bindings from an earlier Run or Define are visible to later ones.
+// Runs and Calls may overlap, each with its own context.
+type Interpreter struct {
+	env  *object.Environment
+	opts eval.EvalOptions
+}
+
+func New(opts eval.EvalOptions) *Interpreter {
+	return &Interpreter{
+		env:  object.NewEnvironment(),
+		opts: opts,
+	}
+}
+
+// Run evaluates src and converts the result with FromObject.
+// Lexer, parser, type and runtime errors all come back as err,
+// programs are only type checked when they have an annotation.
+func (in *Interpreter) Run(ctx context.Context, src string) (interface{}, error) {
+	l := lexer.New(src)
+	p := parser.New(l)
+	program := p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		return nil, errors.New(strings.TrimSpace(p.FormatErrors()))
+	}
+	if typecheck.Annotated(program) {
+		if errs := typecheck.Check(program); len(errs) != 0 {
+			return nil, errors.New(strings.TrimSpace(typecheck.FormatErrors(src, errs)))
+		}
+	}
+
+	ctx, end := begin(ctx)
+	defer end()
+	evaluated := eval.EvalWithContext(ctx, program, in.env, in.opts)
+	return in.result(evaluated)
+}
+
+// Define binds a Go value in the global environment,
+// funcs become builtins callable from scripts.
+func (in *Interpreter) Define(name string, value interface{}) error {
+	obj, err := in.ToObject(value)
+	if err != nil {
+		return fmt.Errorf("define %s: %w", name, err)
+	}
+	in.env.Set(name, obj)
+	return nil
+}
+
+// Call invokes a function bound to name with Go arguments.
+func (in *Interpreter) Call(name string, args ...interface{}) (interface{}, error) {
+	return in.CallContext(context.Background(), name, args...)
+}
+
+func (in *Interpreter) CallContext(ctx context.Context, name string, args ...interface{}) (interface{}, error) {
+	fn, ok := in.env.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("call %s: identifier not found", name)
+	}
+
+	objs := make([]object.Object, len(args))
+	for i, arg := range args {
+		obj, err := in.ToObject(arg)
+		if err != nil {
+			return nil, fmt.Errorf("call %s: argument %d: %w", name, i, err)
+		}
+		objs[i] = obj
+	}
+
+	ctx, end := begin(ctx)
+	defer end()
+	evaluated := eval.ApplyFunction(ctx, fn, objs, in.opts)
+	return in.result(evaluated)
+}
+
+// marks the context of a Run or Call while it is in progress
+type callKey struct{}
+
+type call struct {
+	done atomic.Bool
+}
+
+// the context for a Run or Call, end marks it finished
+func begin(ctx context.Context) (context.Context, func()) {
+	c := &call{}
+	return context.WithValue(ctx, callKey{}, c), func() { c.done.Store(true) }
+}
+
+// a script callback runs under the context of the evaluation that
+// handed it to the host, so it is cancelled and timed out with its
+// caller. a host that kept one past that Run or Call calls it with
+// nothing to cancel it but its own timeout.
+func callbackContext(ctx context.Context) context.Context {
+	if c, ok := ctx.Value(callKey{}).(*call); !ok || c.done.Load() {
+		return context.Background()
+	}
+	return ctx
+}
+
+func (in *Interpreter) result(obj object.Object) (interface{}, error) {
+	if errObj, ok := obj.(*object.Error); ok {
+		return nil, errors.New(errObj.Message)
+	}
+	return FromObject(obj), nil
+}
@@ -0,0 +1,260 @@
+package supbud
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pro0o/sup-bud/eval"
+)
+
+func TestRunKeepsBindings(t *testing.T) {
+	in := New(DefaultOptions())
+	ctx := context.Background()
+
+	if _, err := in.Run(ctx, "sup double = bud(x) { x * 2 };"); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	got, err := in.Run(ctx, "double(21)")
+	if err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	if got != int64(42) {
+		t.Errorf("wrong result. got=%#v, want=42", got)
+	}
+}
+
+func TestDefineGoValues(t *testing.T) {
+	in := New(DefaultOptions())
+
+	definitions := map[string]interface{}{
+		"add":   func(a, b int64) int64 { return a + b },
+		"join":  func(parts []string, sep string) string { return strings.Join(parts, sep) },
+		"count": func(m map[string]int) int { return len(m) },
+		"sum": func(xs ...int) int {
+			n := 0
+			for _, x := range xs {
+				n += x
+			}
+			return n
+		},
+		"fail":   func() (int64, error) { return 0, errors.New("host said no") },
+		"apply":  func(f func(int64) int64, x int64) int64 { return f(x) },
+		"limit":  int64(10),
+		"name":   "bud",
+		"primes": []int{2, 3, 5},
+		"ages":   map[string]int64{"ada": 36},
+	}
+	for name, value := range definitions {
+		if err := in.Define(name, value); err != nil {
+			t.Fatalf("Define(%q) returned error: %v", name, err)
+		}
+	}
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`add(2, 3)`, int64(5)},
+		{`add(limit, primes[2])`, int64(15)},
+		{`join(["a", "b", name], "-")`, "a-b-bud"},
+		{`count({"x": 1, "y": 2})`, int64(2)},
+		{`sum()`, int64(0)},
+		{`sum(1, 2, 3)`, int64(6)},
+		{`apply(bud(x) { x * x }, 7)`, int64(49)},
+		{`ages["ada"]`, int64(36)},
+		{`primes`, []interface{}{int64(2), int64(3), int64(5)}},
+		{`{"k": true}`, map[string]interface{}{"k": true}},
+		{`if (false) { 1 }`, nil},
+	}
+	for _, tt := range tests {
+		got, err := in.Run(context.Background(), tt.input)
+		if err != nil {
+			t.Errorf("Run(%q) returned error: %v", tt.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("Run(%q) wrong result. got=%#v, want=%#v", tt.input, got, tt.expected)
+		}
+	}
+
+	errorTests := []struct {
+		input    string
+		expected string
+	}{
+		{`fail()`, "host said no"},
+		{`add(1)`, "wrong number of arguments"},
+		{`add(1, "two")`, "cannot use STRING as int64"},
+		{`sup x = ;`, "Parser errors"},
+	}
+	for _, tt := range errorTests {
+		_, err := in.Run(context.Background(), tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("Run(%q) wrong error. expected to contain %q, got=%v", tt.input, tt.expected, err)
+		}
+	}
+}
+
+func TestCall(t *testing.T) {
+	in := New(DefaultOptions())
+	if _, err := in.Run(context.Background(), `sup greet = bud(name, n) { name + "!" };`); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+
+	got, err := in.Call("greet", "sup", 1)
+	if err != nil {
+		t.Fatalf("Call returned error: %v", err)
+	}
+	if got != "sup!" {
+		t.Errorf("wrong result. got=%#v", got)
+	}
+
+	if _, err := in.Call("missing"); err == nil {
+		t.Errorf("expected an error calling an unknown function")
+	}
+	if _, err := in.Call("greet", 1.5, 1); err == nil {
+		t.Errorf("expected an error converting a float")
+	}
+}
+
+func TestRunHonorsContext(t *testing.T) {
+	in := New(DefaultOptions())
+	if err := in.Define("sleep", func() { time.Sleep(time.Second) }); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := in.Run(ctx, "sleep()")
+	if err == nil || !strings.Contains(err.Error(), "cancelled") {
+		t.Fatalf("expected a cancellation error. got=%v", err)
+	}
+}
+
+func TestRunChecksAnnotatedPrograms(t *testing.T) {
+	in := New(DefaultOptions())
+	ctx := context.Background()
+
+	_, err := in.Run(ctx, "sup inc = bud(n: int) -> int { n + 1 };\ninc(true)")
+	expected := "Type errors:\n  - Line 2: argument 1 to inc: cannot use bool as int"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("wrong error.\ngot=%v\nwant=%s", err, expected)
+	}
+
+	// nothing ran, so inc is not bound
+	if _, err := in.Run(ctx, "inc"); err == nil || !strings.Contains(err.Error(), "identifier not found") {
+		t.Errorf("a program with type errors ran. got=%v", err)
+	}
+
+	// without annotations mistakes are left to the runtime, and code
+	// that never runs cannot fail
+	got, err := in.Run(ctx, "if (false) { 1 + true } else { 7 }")
+	if err != nil || got != int64(7) {
+		t.Errorf("unannotated program did not run as before. got=%v, %v", got, err)
+	}
+	if _, err := in.Run(ctx, "1 + true"); err == nil || err.Error() != "type mismatch: INTEGER + BOOLEAN" {
+		t.Errorf("wrong runtime error. got=%v", err)
+	}
+}
+
+func TestCallbacksRunUnderTheCallersContext(t *testing.T) {
+	in := New(eval.EvalOptions{MaxCallDepth: 200})
+	stopped := make(chan error, 1)
+	err := in.Define("each", func(f func(int64) (int64, error)) int64 {
+		_, err := f(0)
+		stopped <- err
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	in.Run(ctx, "sup loop = bud(n) { loop(n + 1) }; each(loop)")
+	select {
+	case err := <-stopped:
+		if err == nil || !strings.Contains(err.Error(), "cancelled") {
+			t.Errorf("expected the callback to be cancelled. got=%v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the callback kept running after its caller was cancelled")
+	}
+}
+
+// a Run finishing while another is in progress leaves the other's
+// callbacks under the other's context
+func TestOverlappingRunsKeepTheirContexts(t *testing.T) {
+	in := New(eval.EvalOptions{MaxCallDepth: 200})
+	holding, release := make(chan struct{}), make(chan struct{})
+	calling, call := make(chan struct{}), make(chan struct{})
+	stopped := make(chan error, 1)
+	err := in.Define("hold", func() {
+		close(holding)
+		<-release
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = in.Define("each", func(f func(int64) (int64, error)) int64 {
+		close(calling)
+		<-call
+		_, err := f(0)
+		stopped <- err
+		return 0
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := make(chan error, 1)
+	go func() {
+		_, err := in.Run(context.Background(), "hold()")
+		first <- err
+	}()
+	<-holding
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	go in.Run(ctx, "sup loop = bud(n) { loop(n + 1) }; each(loop)")
+	<-calling
+
+	// the first Run ends after the second began
+	close(release)
+	if err := <-first; err != nil {
+		t.Fatalf("first Run returned error: %v", err)
+	}
+	close(call)
+
+	select {
+	case err := <-stopped:
+		if err == nil || !strings.Contains(err.Error(), "cancelled") {
+			t.Errorf("expected the callback to be cancelled. got=%v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("the callback kept running after its caller was cancelled")
+	}
+}
+
+func TestKeptCallbacksOutliveTheirRun(t *testing.T) {
+	in := New(DefaultOptions())
+	var kept func(int64) (int64, error)
+	err := in.Define("keep", func(f func(int64) (int64, error)) {
+		kept = f
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, err := in.Run(ctx, "keep(bud(n) { n * 2 })"); err != nil {
+		t.Fatalf("Run returned error: %v", err)
+	}
+	cancel()
+
+	if got, err := kept(21); err != nil || got != 42 {
+		t.Errorf("wrong result from a kept callback. got=%d, err=%v", got, err)
+	}
+}
@@ -12,8 +12,17 @@ const (
 	ILLEGAL = "ILLEGAL"
 	EOF     = "EOF"
 
-	IDENT = "IDENT"
-	INT   = "INT"
+	IDENT  = "IDENT"
+	INT    = "INT"
+	STRING = "STRING"
+
+	// "a ${x} b ${y} c" is TEMPLATE_START "a ", the tokens of x,
+	// TEMPLATE_MIDDLE " b ", the tokens of y and TEMPLATE_END " c"
+	TEMPLATE_START  = "TEMPLATE_START"
+	TEMPLATE_MIDDLE = "TEMPLATE_MIDDLE"
+	TEMPLATE_END    = "TEMPLATE_END"
+
+	OPERATOR = "OPERATOR" // a run of symbols that is no built-in operator, like <+>
 
 	ASSIGN   = "="
 	PLUS     = "+"
@@ -29,12 +38,20 @@ const (
 
 	COMMA     = ","
 	SEMICOLON = ";"
+	DOT       = "."
+	COLON     = ":"
+	ARROW     = "->"  // before the return type of a bud
+	FAT_ARROW = "=>"  // between the pattern and the result of a match arm
+	ELLIPSIS  = "..." // the rest of an array pattern
 
 	LPAREN = "("
 	RPAREN = ")"
 	LBRACE = "{"
 	RBRACE = "}"
 
+	LBRACKET = "["
+	RBRACKET = "]"
+
 	FUNCTION = "BUD"
 	LET      = "SUP"
 	TRUE     = "TRUE"
@@ -42,16 +59,55 @@ const (
 	IF       = "IF"
 	ELSE     = "ELSE"
 	RETURN   = "RETURN"
+	IMPORT   = "IMPORT"
+	EXPORT   = "EXPORT"
+	AS       = "AS"
+	SELECT   = "SELECT"
+	DEFAULT  = "DEFAULT"
+	INFIX    = "INFIX"
+	INFIXL   = "INFIXL"
+	INFIXR   = "INFIXR"
+	MACRO    = "MACRO"
+	RECORD   = "RECORD"
+	WITH     = "WITH"
+	MATCH    = "MATCH"
 )
 
 var keywords = map[string]TokenType{
-	"bud":    FUNCTION,
-	"sup":    LET,
-	"true":   TRUE,
-	"false":  FALSE,
-	"if":     IF,
-	"else":   ELSE,
-	"return": RETURN,
+	"bud":     FUNCTION,
+	"sup":     LET,
+	"true":    TRUE,
+	"false":   FALSE,
+	"if":      IF,
+	"else":    ELSE,
+	"return":  RETURN,
+	"import":  IMPORT,
+	"export":  EXPORT,
+	"as":      AS,
+	"select":  SELECT,
+	"default": DEFAULT,
+	"infix":   INFIX,
+	"infixl":  INFIXL,
+	"infixr":  INFIXR,
+	"macro":   MACRO,
+	"record":  RECORD,
+	"with":    WITH,
+	"match":   MATCH,
+}
+
+var operators = map[string]TokenType{
+	"=":  ASSIGN,
+	"==": EQ,
+	"!=": NOT_EQ,
+	"+":  PLUS,
+	"-":  MINUS,
+	"!":  BANG,
+	"*":  ASTERISK,
+	"/":  SLASH,
+	"<":  LT,
+	">":  GT,
+	"->": ARROW,
+	"=>": FAT_ARROW,
 }
 
 func LookupIdent(ident string) TokenType {
@@ -60,3 +116,9 @@ func LookupIdent(ident string) TokenType {
 	}
 	return IDENT
 }
+
+// LookupOperator reports the token type of a built-in operator.
+func LookupOperator(op string) (TokenType, bool) {
+	tok, ok := operators[op]
+	return tok, ok
+}
@@ -0,0 +1,19 @@
+package typecheck
+
+// types of the evaluator's builtins, looked up after the scope the
+// same way. those missing here, like the task builtins, are any.
+var builtins = map[string]scheme{
+	"len":   {t: &function{params: []typ{tAny}, ret: tInt}},
+	"first": forall(func(a typ) typ { return &function{params: []typ{&array{element: a}}, ret: a} }),
+	"last":  forall(func(a typ) typ { return &function{params: []typ{&array{element: a}}, ret: a} }),
+	"rest":  forall(func(a typ) typ { return &function{params: []typ{&array{element: a}}, ret: &array{element: a}} }),
+	"push": forall(func(a typ) typ {
+		return &function{params: []typ{&array{element: a}, a}, ret: &array{element: a}}
+	}),
+}
+
+// the scheme of f(a) for any type a
+func forall(f func(a typ) typ) scheme {
+	a := &variable{}
+	return scheme{vars: []*variable{a}, t: f(a)}
+}
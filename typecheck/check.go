@@ -0,0 +1,748 @@
+// Package typecheck finds type errors in a program before it runs.
+//
+// Annotations are optional:
+//
+//	sup x: int = 1;
+//	sup add = bud(a: int, b: int) -> int { a + b };
+//
+// whatever is left out is inferred, Hindley-Milner style, so
+//
+//	sup twice = bud(f, x) { f(f(x)) };
+//
+// gets the type bud(bud(a) -> a, a) -> a and can be used with ints
+// and strings alike. The checker is gradual: code it cannot follow,
+// like imports, member access, task builtins and names bound by an
+// earlier run, has type any, which goes along with every other type.
+// If branches and returns of different types make the result any too,
+// since the program can still be fine at runtime. Errors are reported
+// where a value is certain to be used wrongly: operators on the wrong
+// types, calls with wrong arguments, values that do not match their
+// annotations.
+//
+// Hosts only check programs with an annotation in them, see
+// Annotated, so programs without any run exactly as they always did.
+package typecheck
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/token"
+)
+
+// Error is a type error at Position, the offset in the source of the
+// code at fault.
+type Error struct {
+	Position int
+	Message  string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Annotated reports whether program has a type annotation anywhere.
+func Annotated(program *ast.Program) bool {
+	found := false
+	ast.Inspect(program, func(node ast.Node) bool {
+		if _, ok := node.(*ast.TypeExpression); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// Check infers the types of program and returns the errors it finds,
+// in source order.
+func Check(program *ast.Program) []*Error {
+	c := &checker{scope: newScope(nil)}
+	for _, stmt := range program.Statements {
+		c.statement(stmt)
+	}
+	sort.SliceStable(c.errors, func(i, j int) bool {
+		return c.errors[i].Position < c.errors[j].Position
+	})
+	return c.errors
+}
+
+// Messages turns errs into messages like the parser's errors, with
+// the line each is on in src.
+func Messages(src string, errs []*Error) []string {
+	out := make([]string, len(errs))
+	for i, err := range errs {
+		out[i] = fmt.Sprintf("Line %d: %s", lineOf(src, err.Position), err.Message)
+	}
+	return out
+}
+
+// FormatErrors lists errs the way the parser's FormatErrors does.
+func FormatErrors(src string, errs []*Error) string {
+	if len(errs) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString("Type errors:\n")
+	for _, msg := range Messages(src, errs) {
+		out.WriteString("  - " + msg + "\n")
+	}
+	return out.String()
+}
+
+func lineOf(src string, position int) int {
+	if position > len(src) {
+		position = len(src)
+	}
+	if position < 0 {
+		position = 0
+	}
+	return strings.Count(src[:position], "\n") + 1
+}
+
+type binding struct {
+	s     scheme
+	macro bool // arguments to macros are code, not values
+}
+
+type scope struct {
+	names map[string]binding
+	outer *scope
+}
+
+func newScope(outer *scope) *scope {
+	return &scope{names: make(map[string]binding), outer: outer}
+}
+
+func (s *scope) lookup(name string) (binding, bool) {
+	for ; s != nil; s = s.outer {
+		if b, ok := s.names[name]; ok {
+			return b, true
+		}
+	}
+	return binding{}, false
+}
+
+// the bud being checked
+type bud struct {
+	ret      typ
+	declared bool // ret is annotated, returns have to match it
+	mixed    bool // returns of different types, the result is any
+}
+
+type checker struct {
+	scope  *scope
+	fn     *bud
+	level  int
+	nextID int
+	trail  []change
+	errors []*Error
+}
+
+// a variable as it was before unify touched it
+type change struct {
+	v     *variable
+	bound typ
+	level int
+}
+
+func (c *checker) errorf(node ast.Node, format string, a ...interface{}) {
+	c.errors = append(c.errors, &Error{Position: ast.SpanOf(node).Start, Message: fmt.Sprintf(format, a...)})
+}
+
+func (c *checker) fresh() *variable {
+	c.nextID++
+	return &variable{id: c.nextID, level: c.level}
+}
+
+// makes a and b the same type, or leaves both as they were and
+// returns false when they cannot be
+func (c *checker) unify(a, b typ) bool {
+	mark := len(c.trail)
+	if !c.unifyVars(a, b) {
+		for i := len(c.trail) - 1; i >= mark; i-- {
+			ch := c.trail[i]
+			ch.v.bound, ch.v.level = ch.bound, ch.level
+		}
+		c.trail = c.trail[:mark]
+		return false
+	}
+	c.trail = c.trail[:mark]
+	return true
+}
+
+func (c *checker) unifyVars(a, b typ) bool {
+	a, b = prune(a), prune(b)
+	if a == b {
+		return true
+	}
+	// any fits a variable without deciding it, len(xs) leaves xs to
+	// be an array of something later
+	if a == tAny || b == tAny {
+		return true
+	}
+	if v, ok := a.(*variable); ok {
+		return c.bind(v, b)
+	}
+	if v, ok := b.(*variable); ok {
+		return c.bind(v, a)
+	}
+
+	switch a := a.(type) {
+	case *array:
+		b, ok := b.(*array)
+		return ok && c.unifyVars(a.element, b.element)
+	case *hash:
+		b, ok := b.(*hash)
+		return ok && c.unifyVars(a.key, b.key) && c.unifyVars(a.value, b.value)
+	case *function:
+		b, ok := b.(*function)
+		if !ok || len(a.params) != len(b.params) {
+			return false
+		}
+		for i := range a.params {
+			if !c.unifyVars(a.params[i], b.params[i]) {
+				return false
+			}
+		}
+		return c.unifyVars(a.ret, b.ret)
+	}
+	return false
+}
+
+func (c *checker) bind(v *variable, t typ) bool {
+	if occurs(v, t) {
+		return false
+	}
+	c.trail = append(c.trail, change{v: v, level: v.level})
+	v.bound = t
+	// what v is bound to lives as long as v does
+	for _, w := range free(t, nil) {
+		if w.level > v.level {
+			c.trail = append(c.trail, change{v: w, level: w.level})
+			w.level = v.level
+		}
+	}
+	return true
+}
+
+// the type both a and b fit, any when there is none
+func (c *checker) join(a, b typ) typ {
+	if c.unify(a, b) {
+		return a
+	}
+	return tAny
+}
+
+// keeps the variables of t from being generalized by a sup further out
+func (c *checker) lower(t typ) {
+	for _, v := range free(t, nil) {
+		if v.level > c.level {
+			v.level = c.level
+		}
+	}
+}
+
+func (c *checker) generalize(t typ) scheme {
+	var vars []*variable
+	for _, v := range free(t, nil) {
+		if v.level > c.level {
+			vars = append(vars, v)
+		}
+	}
+	return scheme{vars: vars, t: t}
+}
+
+func (c *checker) instantiate(s scheme) typ {
+	if len(s.vars) == 0 {
+		return s.t
+	}
+	fresh := make(map[*variable]typ, len(s.vars))
+	for _, v := range s.vars {
+		fresh[v] = c.fresh()
+	}
+	var copyType func(t typ) typ
+	copyType = func(t typ) typ {
+		switch t := prune(t).(type) {
+		case *variable:
+			if f, ok := fresh[t]; ok {
+				return f
+			}
+			return t
+		case *array:
+			return &array{element: copyType(t.element)}
+		case *hash:
+			return &hash{key: copyType(t.key), value: copyType(t.value)}
+		case *function:
+			params := make([]typ, len(t.params))
+			for i, param := range t.params {
+				params[i] = copyType(param)
+			}
+			return &function{params: params, ret: copyType(t.ret)}
+		default:
+			return t
+		}
+	}
+	return copyType(s.t)
+}
+
+// the type an annotation stands for
+func (c *checker) annotation(te *ast.TypeExpression) typ {
+	switch te.Token.Type {
+	case token.LBRACKET:
+		return &array{element: c.annotation(te.Element)}
+	case token.LBRACE:
+		return &hash{key: c.annotation(te.Key), value: c.annotation(te.Value)}
+	case token.FUNCTION:
+		params := make([]typ, len(te.Parameters))
+		for i, param := range te.Parameters {
+			params[i] = c.annotation(param)
+		}
+		return &function{params: params, ret: c.annotation(te.Return)}
+	}
+	switch t := basic(te.Name); t {
+	case tInt, tBool, tString, tNull, tAny:
+		return t
+	}
+	c.errorf(te, "unknown type %s", te.Name)
+	return tAny
+}
+
+// the type of a statement's value, a block has the one of its last
+func (c *checker) statement(stmt ast.Statement) typ {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.let(stmt)
+	case *ast.DestructureStatement:
+		c.destructure(stmt)
+	case *ast.ExportStatement:
+		if stmt.Statement != nil {
+			c.let(stmt.Statement)
+		}
+	case *ast.ImportStatement:
+		if stmt.Alias != nil {
+			c.scope.names[stmt.Alias.Value] = binding{s: scheme{t: tAny}}
+		}
+	case *ast.ReturnStatement:
+		t := c.expression(stmt.ReturnValue)
+		c.returns(stmt.ReturnValue, t)
+		// the statements after it never see a value
+		return c.fresh()
+	case *ast.ExpressionStatement:
+		return c.expression(stmt.Expression)
+	case *ast.BlockStatement:
+		return c.block(stmt)
+	}
+	return tNull
+}
+
+func (c *checker) block(block *ast.BlockStatement) typ {
+	if block == nil {
+		return tNull
+	}
+	var t typ = tNull
+	for _, stmt := range block.Statements {
+		t = c.statement(stmt)
+	}
+	return t
+}
+
+func (c *checker) let(stmt *ast.LetStatement) {
+	if stmt.Name == nil {
+		return
+	}
+	name := stmt.Name.Value
+	if _, ok := stmt.Value.(*ast.MacroLiteral); ok {
+		c.scope.names[name] = binding{s: scheme{t: tAny}, macro: true}
+		return
+	}
+
+	var declared typ
+	if stmt.Type != nil {
+		declared = c.annotation(stmt.Type)
+	}
+
+	c.level++
+	// a bud can call itself, with the one type it is being given
+	_, recursive := stmt.Value.(*ast.FunctionLiteral)
+	var self typ
+	if recursive {
+		self = declared
+		if self == nil {
+			self = c.fresh()
+		}
+		c.scope.names[name] = binding{s: scheme{t: self}}
+	}
+	t := c.expression(stmt.Value)
+	if recursive && !c.unify(self, t) && declared == nil {
+		t = tAny
+	}
+	c.level--
+
+	if declared != nil {
+		if !c.unify(declared, t) {
+			s := show(declared, t)
+			c.errorf(stmt.Value, "sup %s is declared %s, got %s", name, s[0], s[1])
+		}
+		c.lower(declared)
+		c.scope.names[name] = binding{s: scheme{t: declared}}
+		return
+	}
+	if recursive {
+		c.scope.names[name] = binding{s: c.generalize(t)}
+		return
+	}
+	c.lower(t)
+	c.scope.names[name] = binding{s: scheme{t: t}}
+}
+
+func (c *checker) destructure(stmt *ast.DestructureStatement) {
+	t := c.expression(stmt.Value)
+	if stmt.Type != nil {
+		declared := c.annotation(stmt.Type)
+		if !c.unify(declared, t) {
+			s := show(declared, t)
+			c.errorf(stmt.Value, "sup %s is declared %s, got %s", stmt.Pattern, s[0], s[1])
+		}
+		t = declared
+	}
+	c.bindPattern(stmt.Pattern, t)
+	c.lower(t)
+}
+
+// binds the names in pattern, taking t apart as far as its shape is
+// known. records are any, so the values of a hash pattern are too
+// unless t is a hash.
+func (c *checker) bindPattern(pattern ast.Pattern, t typ) {
+	switch pattern := pattern.(type) {
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			c.scope.names[pattern.Value] = binding{s: scheme{t: t}}
+		}
+	case *ast.ArrayPattern:
+		var element typ = c.fresh()
+		if !c.unify(t, &array{element: element}) {
+			c.errorf(pattern, "cannot take %s apart with %s", show(t)[0], pattern)
+			element = tAny
+		}
+		for _, el := range pattern.Elements {
+			c.bindPattern(el, element)
+		}
+		if pattern.Rest != nil {
+			c.bindPattern(pattern.Rest, &array{element: element})
+		}
+	case *ast.HashPattern:
+		var value typ = tAny
+		if h, ok := prune(t).(*hash); ok {
+			value = h.value
+		}
+		for _, v := range pattern.Values {
+			c.bindPattern(v, value)
+		}
+	}
+}
+
+// a value t leaving the bud being checked
+func (c *checker) returns(node ast.Node, t typ) {
+	if c.fn == nil {
+		return // the program stops, with anything
+	}
+	if c.unify(c.fn.ret, t) {
+		return
+	}
+	if c.fn.declared {
+		s := show(t, c.fn.ret)
+		c.errorf(node, "cannot return %s from a bud returning %s", s[0], s[1])
+		return
+	}
+	c.fn.mixed = true
+}
+
+func (c *checker) function(lit *ast.FunctionLiteral) typ {
+	outer, outerFn := c.scope, c.fn
+	c.scope = newScope(outer)
+	defer func() { c.scope, c.fn = outer, outerFn }()
+
+	params := make([]typ, len(lit.Parameters))
+	for i, param := range lit.Parameters {
+		if i < len(lit.ParameterTypes) && lit.ParameterTypes[i] != nil {
+			params[i] = c.annotation(lit.ParameterTypes[i])
+		} else {
+			params[i] = c.fresh()
+		}
+		c.scope.names[param.Value] = binding{s: scheme{t: params[i]}}
+		if i < len(lit.Patterns) && lit.Patterns[i] != nil {
+			c.bindPattern(lit.Patterns[i], params[i])
+		}
+	}
+	c.fn = &bud{}
+	if lit.ReturnType != nil {
+		c.fn.ret, c.fn.declared = c.annotation(lit.ReturnType), true
+	} else {
+		c.fn.ret = c.fresh()
+	}
+
+	body := c.block(lit.Body)
+	var last ast.Node = lit
+	if lit.Body != nil && len(lit.Body.Statements) > 0 {
+		last = lit.Body.Statements[len(lit.Body.Statements)-1]
+	}
+	c.returns(last, body)
+
+	if c.fn.mixed {
+		return &function{params: params, ret: tAny}
+	}
+	return &function{params: params, ret: c.fn.ret}
+}
+
+func (c *checker) expression(exp ast.Expression) typ {
+	switch exp := exp.(type) {
+	case nil:
+		return tNull
+	case *ast.IntegerLiteral:
+		return tInt
+	case *ast.Boolean:
+		return tBool
+	case *ast.StringLiteral:
+		return tString
+	case *ast.InterpolatedString:
+		// anything inspects to a string
+		for _, value := range exp.Values {
+			c.expression(value)
+		}
+		return tString
+	case *ast.Identifier:
+		if b, ok := c.scope.lookup(exp.Value); ok {
+			return c.instantiate(b.s)
+		}
+		if s, ok := builtins[exp.Value]; ok {
+			return c.instantiate(s)
+		}
+		return tAny // bound by an earlier run, or an error the evaluator reports
+	case *ast.PrefixExpression:
+		return c.prefix(exp)
+	case *ast.InfixExpression:
+		return c.infix(exp)
+	case *ast.IfExpression:
+		c.expression(exp.Condition) // anything is true or false
+		consequence := c.block(exp.Consequence)
+		if exp.Alternative == nil {
+			return c.join(consequence, tNull)
+		}
+		return c.join(consequence, c.block(exp.Alternative))
+	case *ast.FunctionLiteral:
+		return c.function(exp)
+	case *ast.CallExpression:
+		return c.call(exp)
+	case *ast.ArrayLiteral:
+		var element typ = c.fresh()
+		for _, el := range exp.Elements {
+			element = c.join(element, c.expression(el))
+		}
+		return &array{element: element}
+	case *ast.HashLiteral:
+		var key, value typ = c.fresh(), c.fresh()
+		for _, k := range exp.Keys {
+			key = c.join(key, c.expression(k))
+			value = c.join(value, c.expression(exp.Pairs[k]))
+		}
+		return &hash{key: key, value: value}
+	case *ast.IndexExpression:
+		return c.index(exp)
+	case *ast.MemberExpression:
+		c.expression(exp.Object)
+		return tAny
+	case *ast.SelectExpression:
+		for _, sc := range exp.Cases {
+			c.expression(sc.Channel)
+			c.expression(sc.Value)
+			outer := c.scope
+			c.scope = newScope(outer)
+			if sc.Binding != nil {
+				c.scope.names[sc.Binding.Value] = binding{s: scheme{t: tAny}}
+			}
+			c.block(sc.Body)
+			c.scope = outer
+		}
+		c.block(exp.Default)
+		return tAny
+	case *ast.MatchExpression:
+		// a plain name gets the type of the value, the parts of
+		// arrays and hashes are any
+		subject := c.expression(exp.Subject)
+		var result typ
+		for _, arm := range exp.Arms {
+			outer := c.scope
+			c.scope = newScope(outer)
+			for _, name := range ast.Bindings(arm.Pattern) {
+				c.scope.names[name.Value] = binding{s: scheme{t: tAny}}
+			}
+			if name, ok := arm.Pattern.(*ast.Identifier); ok && name.Value != "_" {
+				c.scope.names[name.Value] = binding{s: scheme{t: subject}}
+			}
+			c.expression(arm.Guard)
+			body := c.expression(arm.Body)
+			if result == nil {
+				result = body
+			} else {
+				result = c.join(result, body)
+			}
+			c.scope = outer
+		}
+		if result == nil {
+			return tAny
+		}
+		return result
+	case *ast.RecordDefinition:
+		// records are not typed, their fields and self are any
+		outer := c.scope
+		c.scope = newScope(outer)
+		c.scope.names["self"] = binding{s: scheme{t: tAny}}
+		for _, method := range exp.Methods {
+			c.expression(method.Value)
+		}
+		c.scope = outer
+		return tAny
+	case *ast.RecordLiteral:
+		c.expression(exp.Type)
+		for _, value := range exp.Values {
+			c.expression(value)
+		}
+		return tAny
+	case *ast.WithExpression:
+		c.expression(exp.Record)
+		for _, value := range exp.Values {
+			c.expression(value)
+		}
+		return tAny
+	}
+	return tAny
+}
+
+func (c *checker) prefix(exp *ast.PrefixExpression) typ {
+	right := c.expression(exp.Right)
+	switch exp.Operator {
+	case "!":
+		return tBool
+	case "-":
+		if !c.unify(right, tInt) {
+			c.errorf(exp, "unknown operator: -%s", show(right)[0])
+		}
+		return tInt
+	}
+	return tAny
+}
+
+func (c *checker) infix(exp *ast.InfixExpression) typ {
+	left := c.expression(exp.Left)
+	right := c.expression(exp.Right)
+	comparison := exp.Operator == "==" || exp.Operator == "!=" || exp.Operator == "<" || exp.Operator == ">"
+
+	if !c.unify(left, right) {
+		s := show(left, right)
+		c.errorf(exp, "type mismatch: %s %s %s", s[0], exp.Operator, s[1])
+		if comparison {
+			return tBool
+		}
+		return tAny
+	}
+
+	t := prune(left)
+	unknown := func() {
+		s := show(t)
+		c.errorf(exp, "unknown operator: %s %s %s", s[0], exp.Operator, s[0])
+	}
+	switch exp.Operator {
+	case "==", "!=":
+		return tBool
+	case "<", ">":
+		if !c.unify(t, tInt) {
+			unknown()
+		}
+		return tBool
+	case "-", "*", "/":
+		if !c.unify(t, tInt) {
+			unknown()
+		}
+		return tInt
+	case "+":
+		switch t {
+		case tInt, tString, tAny:
+			return t
+		}
+		if _, ok := t.(*variable); ok {
+			return t // an int or a string, whichever the caller has
+		}
+		unknown()
+	}
+	return tAny
+}
+
+func (c *checker) index(exp *ast.IndexExpression) typ {
+	left := prune(c.expression(exp.Left))
+	index := c.expression(exp.Index)
+	switch l := left.(type) {
+	case *array:
+		if !c.unify(index, tInt) {
+			c.errorf(exp.Index, "array index must be int, got %s", show(index)[0])
+		}
+		return l.element
+	case *hash:
+		if !c.unify(index, l.key) {
+			s := show(l.key, index)
+			c.errorf(exp.Index, "hash key must be %s, got %s", s[0], s[1])
+		}
+		return l.value
+	case *variable:
+		return tAny // an array or a hash, not known which
+	}
+	if left == tAny {
+		return tAny
+	}
+	c.errorf(exp, "index operator not supported: %s", show(left)[0])
+	return tAny
+}
+
+func (c *checker) call(call *ast.CallExpression) typ {
+	name := "bud"
+	if id, ok := call.Function.(*ast.Identifier); ok {
+		name = id.Value
+		if name == "quote" || name == "unquote" {
+			return tAny // code, not values
+		}
+		if b, ok := c.scope.lookup(name); ok && b.macro {
+			return tAny
+		}
+	}
+
+	fn := prune(c.expression(call.Function))
+	args := make([]typ, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		args[i] = c.expression(arg)
+	}
+
+	switch f := fn.(type) {
+	case *function:
+		if len(f.params) != len(args) {
+			c.errorf(call, "wrong number of arguments to %s: want=%d, got=%d", name, len(f.params), len(args))
+			return tAny
+		}
+		for i, arg := range args {
+			if !c.unify(f.params[i], arg) {
+				s := show(arg, f.params[i])
+				c.errorf(call.Arguments[i], "argument %d to %s: cannot use %s as %s", i+1, name, s[0], s[1])
+			}
+		}
+		return f.ret
+	case *variable:
+		ret := c.fresh()
+		if !c.unify(f, &function{params: args, ret: ret}) {
+			return tAny
+		}
+		return ret
+	}
+	if fn == tAny {
+		return tAny
+	}
+	c.errorf(call.Function, "not a function: %s", show(fn)[0])
+	return tAny
+}
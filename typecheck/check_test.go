@@ -0,0 +1,175 @@
+package typecheck
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pro0o/sup-bud/ast"
+	"github.com/pro0o/sup-bud/lexer"
+	"github.com/pro0o/sup-bud/parser"
+)
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors for %q: %v", input, p.Errors())
+	}
+	return program
+}
+
+// the type the program's top level ends up giving name
+func typeOf(t *testing.T, input, name string) string {
+	t.Helper()
+	c := &checker{scope: newScope(nil)}
+	for _, stmt := range parse(t, input).Statements {
+		c.statement(stmt)
+	}
+	if len(c.errors) != 0 {
+		t.Fatalf("unexpected errors for %q: %s", input, c.errors[0])
+	}
+	b, ok := c.scope.lookup(name)
+	if !ok {
+		t.Fatalf("%s not bound by %q", name, input)
+	}
+	return show(b.s.t)[0]
+}
+
+func TestInference(t *testing.T) {
+	tests := []struct {
+		input    string
+		name     string
+		expected string
+	}{
+		{"sup x = 1;", "x", "int"},
+		{`sup s = "a" + "b";`, "s", "string"},
+		{"sup b = 1 < 2;", "b", "bool"},
+		{"sup id = bud(x) { x };", "id", "bud(a) -> a"},
+		{"sup add = bud(a, b) { a + b };", "add", "bud(a, a) -> a"},
+		{"sup inc = bud(a) { a + 1 };", "inc", "bud(int) -> int"},
+		{"sup twice = bud(f, x) { f(f(x)) };", "twice", "bud(bud(a) -> a, a) -> a"},
+		{"sup k = bud(x, y) { x };", "k", "bud(a, b) -> a"},
+		// polymorphic uses of one bud
+		{"sup id = bud(x) { x }; sup n = id(1); sup s = id(\"a\");", "s", "string"},
+		{"sup fact = bud(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };", "fact", "bud(int) -> int"},
+		{
+			"sup map = bud(f, xs) { if (len(xs) == 0) { [] } else { push(map(f, rest(xs)), f(first(xs))) } };",
+			"map", "bud(bud(a) -> b, [a]) -> [b]",
+		},
+		{"sup xs = [1, 2, 3];", "xs", "[int]"},
+		{"sup xs = [];", "xs", "[a]"},
+		{`sup h = {"a": 1};`, "h", "{string: int}"},
+		{"sup x = [1, 2][0];", "x", "int"},
+		{"sup x = first([true]);", "x", "bool"},
+		{"sup xs = push([1], 2);", "xs", "[int]"},
+		{"sup n = len(\"abc\");", "n", "int"},
+		{"sup f = bud(x: int) -> int { x };", "f", "bud(int) -> int"},
+		{"sup g: bud(int) -> int = bud(x) { x };", "g", "bud(int) -> int"},
+		// what could be either is any
+		{`sup x = if (true) { 1 } else { "a" };`, "x", "any"},
+		{`sup xs = [1, "a"];`, "xs", "[any]"},
+		{`sup f = bud(x) { if (x) { return 1; } "a" };`, "f", "bud(a) -> any"},
+		{"sup x = if (true) { 1 };", "x", "any"},
+		{"sup x = if (true) { return 1; } else { 2 };", "x", "int"},
+		{`import "m.sb" as m; sup x = m.f(1);`, "x", "any"},
+		{"sup x = spawn(bud() { 1 });", "x", "any"},
+		{"sup x = unbound + 1;", "x", "any"},
+		{"sup m = macro(a) { quote(unquote(a)) }; sup x = m(1 + true);", "x", "any"},
+		{"record P { x } sup p = P{x: 1} with {x: 2};", "p", "any"},
+		{`sup x = match 1 { 0 => "zero", n => "some" };`, "x", "string"},
+		{"sup f = bud(n) { match n { 0 => 1, m => m * 2 } };", "f", "bud(int) -> int"},
+		{`sup x = match [1] { [a] => a, _ => "a" };`, "x", "any"},
+		{"sup [a, ...r] = [1, 2];", "r", "[int]"},
+		{`sup {k} = {"k": "v"};`, "k", "string"},
+		{"sup f = bud([a, b]) { a + b + 1 };", "f", "bud([int]) -> int"},
+		{`sup s = "n=${1 + 1}";`, "s", "string"},
+	}
+
+	for _, tt := range tests {
+		if got := typeOf(t, tt.input, tt.name); got != tt.expected {
+			t.Errorf("%q: %s has type %s, want %s", tt.input, tt.name, got, tt.expected)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"1 + true", []string{"type mismatch: int + bool"}},
+		{"1 == \"a\"", []string{"type mismatch: int == string"}},
+		{"-true", []string{"unknown operator: -bool"}},
+		{"true + false", []string{"unknown operator: bool + bool"}},
+		{`"a" - "b"`, []string{"unknown operator: string - string"}},
+		{"sup x: int = \"a\";", []string{"sup x is declared int, got string"}},
+		{"sup xs: [string] = [1];", []string{"sup xs is declared [string], got [int]"}},
+		{"sup f = bud(a: int) { a }; f(true);", []string{"argument 1 to f: cannot use bool as int"}},
+		{"sup f = bud(a, b) { a }; f(1);", []string{"wrong number of arguments to f: want=2, got=1"}},
+		{"sup f = bud() -> int { \"a\" };", []string{"cannot return string from a bud returning int"}},
+		{"sup f = bud(x) -> string { if (x) { return 1; } \"a\" };", []string{"cannot return int from a bud returning string"}},
+		{"sup x = 1; x(2);", []string{"not a function: int"}},
+		{"5[0]", []string{"index operator not supported: int"}},
+		{`[1][true]`, []string{"array index must be int, got bool"}},
+		{`{"a": 1}[2]`, []string{"hash key must be string, got int"}},
+		// inferred types catch misuse of unannotated code too
+		{"sup inc = bud(a) { a + 1 }; inc(\"a\");", []string{"argument 1 to inc: cannot use string as int"}},
+		{"sup twice = bud(f, x) { f(f(x)) }; twice(bud(n) { n + 1 }, true);", []string{"argument 2 to twice: cannot use bool as int"}},
+		{"sup add: bud(int, int) -> int = bud(a, b) { a + b }; add(1, \"2\");", []string{"argument 2 to add: cannot use string as int"}},
+		{"match 1 { n => n + true }", []string{"type mismatch: int + bool"}},
+		{"sup [a, b] = 1;", []string{"cannot take int apart with [a, b]"}},
+		{"sup [a]: [string] = [1];", []string{"sup [a] is declared [string], got [int]"}},
+		{"sup f = bud([a]) { a + 1 }; f([true]);", []string{"argument 1 to f: cannot use [bool] as [int]"}},
+		// methods are checked like any bud
+		{"record P { x; sup f = bud() -> int { \"a\" }; }", []string{"cannot return string from a bud returning int"}},
+		// one error per mistake, in source order
+		{"sup a: int = true;\nsup b = 1 + \"c\";", []string{"sup a is declared int, got bool", "type mismatch: int + string"}},
+		// any goes with everything
+		{"sup f = bud(a: any) -> int { a }; f(\"s\") + 1;", nil},
+		{`import "m.sb" as m; sup x: int = m.value;`, nil},
+		{"sup x: int = unbound;", nil},
+		{`sup xs = [1, "a"]; sup n: int = xs[0];`, nil},
+	}
+
+	for _, tt := range tests {
+		errs := Check(parse(t, tt.input))
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Message)
+		}
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: wrong errors.\ngot=%q\nwant=%q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestFormatErrors(t *testing.T) {
+	input := "sup a = 1;\n\nsup b: string = a;"
+	got := FormatErrors(input, Check(parse(t, input)))
+	expected := "Type errors:\n  - Line 3: sup b is declared string, got int\n"
+	if got != expected {
+		t.Errorf("wrong output.\ngot=%q\nwant=%q", got, expected)
+	}
+	if FormatErrors(input, nil) != "" {
+		t.Errorf("no errors should format to nothing")
+	}
+}
+
+func TestAnnotated(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"sup x = 1 + true;", false},
+		{"sup f = bud(a, b) { a };", false},
+		{"sup x: int = 1;", true},
+		{"sup f = bud(a: int) { a };", true},
+		{"if (true) { bud() -> int { 1 } }", true},
+	}
+	for _, tt := range tests {
+		if got := Annotated(parse(t, tt.input)); got != tt.expected {
+			t.Errorf("Annotated(%q) = %t, want %t", tt.input, got, tt.expected)
+		}
+	}
+}
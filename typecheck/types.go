@@ -0,0 +1,137 @@
+package typecheck
+
+import (
+	"strings"
+)
+
+// a type as the checker sees it. any is the type of whatever the
+// checker cannot follow, like imports and task builtins, and goes
+// along with every other type.
+type typ interface{}
+
+type basic string
+
+const (
+	tInt    basic = "int"
+	tBool   basic = "bool"
+	tString basic = "string"
+	tNull   basic = "null"
+	tAny    basic = "any"
+)
+
+type array struct{ element typ }
+
+type hash struct{ key, value typ }
+
+type function struct {
+	params []typ
+	ret    typ
+}
+
+// a type not known yet. level is how many sups deep it was made,
+// those made deeper than a sup are generalized when it binds them.
+type variable struct {
+	id, level int
+	bound     typ
+}
+
+// a type with variables that are fresh at every use, like the one
+// of bud(x) { x }
+type scheme struct {
+	vars []*variable
+	t    typ
+}
+
+// the type t stands for, through the variables bound so far
+func prune(t typ) typ {
+	for {
+		v, ok := t.(*variable)
+		if !ok || v.bound == nil {
+			return t
+		}
+		t = v.bound
+	}
+}
+
+func occurs(v *variable, t typ) bool {
+	switch t := prune(t).(type) {
+	case *variable:
+		return t == v
+	case *array:
+		return occurs(v, t.element)
+	case *hash:
+		return occurs(v, t.key) || occurs(v, t.value)
+	case *function:
+		for _, param := range t.params {
+			if occurs(v, param) {
+				return true
+			}
+		}
+		return occurs(v, t.ret)
+	}
+	return false
+}
+
+// the variables of t no binding holds yet
+func free(t typ, out []*variable) []*variable {
+	switch t := prune(t).(type) {
+	case *variable:
+		for _, v := range out {
+			if v == t {
+				return out
+			}
+		}
+		return append(out, t)
+	case *array:
+		return free(t.element, out)
+	case *hash:
+		return free(t.value, free(t.key, out))
+	case *function:
+		for _, param := range t.params {
+			out = free(param, out)
+		}
+		return free(t.ret, out)
+	}
+	return out
+}
+
+// writes types the way annotations do, variables become a, b, ...
+type printer map[*variable]string
+
+func (p printer) String(t typ) string {
+	switch t := prune(t).(type) {
+	case basic:
+		return string(t)
+	case *array:
+		return "[" + p.String(t.element) + "]"
+	case *hash:
+		return "{" + p.String(t.key) + ": " + p.String(t.value) + "}"
+	case *function:
+		params := make([]string, len(t.params))
+		for i, param := range t.params {
+			params[i] = p.String(param)
+		}
+		return "bud(" + strings.Join(params, ", ") + ") -> " + p.String(t.ret)
+	case *variable:
+		name, ok := p[t]
+		if !ok {
+			name = string(rune('a' + len(p)%26))
+			if n := len(p) / 26; n > 0 {
+				name += strings.Repeat("'", n)
+			}
+			p[t] = name
+		}
+		return name
+	}
+	return "?"
+}
+
+// the types in one message, sharing variable names
+func show(types ...typ) []string {
+	p := printer{}
+	out := make([]string, len(types))
+	for i, t := range types {
+		out[i] = p.String(t)
+	}
+	return out
+}
@@ -194,7 +194,9 @@ function executeCode(code, outputElement, maxLength = 1000) {
         setTimeout(() => {
           try {
             const result = evaluateSupBud(trimmedCode);
-            outputElement.textContent = result.error ? "Error: " + result.error : result.result;
+            const warned = (result.warnings || []).map((w) => "Warning: " + w + "\n").join("");
+            const printed = result.output || "";
+            outputElement.textContent = warned + printed + (result.error ? "Error: " + result.error : result.result);
           } catch (error) {
             outputElement.textContent = "Error: " + error.message;
             console.error(error);